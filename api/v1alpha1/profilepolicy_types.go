@@ -0,0 +1,67 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ProfilePolicyRule gives the role profile to the HostedClusters its selector matches
+type ProfilePolicyRule struct {
+	// Priority orders the rules of every ProfilePolicy, the matching rule with the highest priority wins.
+	// Rules of equal priority are ordered by the name of their policy and their position in it
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// HostedClusterSelector selects HostedClusters by their labels, an empty selector matches every HostedCluster
+	HostedClusterSelector metav1.LabelSelector `json:"hostedClusterSelector"`
+
+	// Profile is the name of a role profile the controller is configured with
+	// +kubebuilder:validation:MinLength=1
+	Profile string `json:"profile"`
+}
+
+// ProfilePolicySpec defines the desired state of ProfilePolicy
+type ProfilePolicySpec struct {
+	// Rules map HostedCluster labels to role profiles
+	// +kubebuilder:validation:MinItems=1
+	Rules []ProfilePolicyRule `json:"rules"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// ProfilePolicy maps HostedClusters to the role profile given to their custom cluster admin group
+type ProfilePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ProfilePolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ProfilePolicyList contains a list of ProfilePolicy
+type ProfilePolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ProfilePolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ProfilePolicy{}, &ProfilePolicyList{})
+}
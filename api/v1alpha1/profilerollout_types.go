@@ -0,0 +1,132 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// RolloutProgressing means waves are still to be promoted or promoted HostedClusters are still to be updated
+	RolloutProgressing = "Progressing"
+	// RolloutPaused means more promoted HostedClusters failed than allowed, no more HostedClusters are updated
+	RolloutPaused = "Paused"
+	// RolloutComplete means every wave is promoted and every HostedCluster was updated
+	RolloutComplete = "Complete"
+)
+
+// RolloutWave selects the HostedClusters updated together, by percentage or by label selector
+type RolloutWave struct {
+	// Percentage of the HostedClusters in the wave, percentages are cumulative: a wave of 30 after a wave of 10
+	// adds 20% of the HostedClusters. HostedClusters are assigned by a hash of the rollout name and their namespace and name
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	Percentage int32 `json:"percentage,omitempty"`
+
+	// HostedClusterSelector selects the HostedClusters in the wave by their labels
+	// +optional
+	HostedClusterSelector *metav1.LabelSelector `json:"hostedClusterSelector,omitempty"`
+}
+
+// ProfileRolloutSpec defines the desired state of ProfileRollout
+type ProfileRolloutSpec struct {
+	// Profile is the name of the role profile being rolled out, as ProfilePolicies and the manager select it
+	// +kubebuilder:validation:MinLength=1
+	Profile string `json:"profile"`
+
+	// StableProfile is the name of the role profile HostedClusters are pinned to until their wave is promoted
+	// +kubebuilder:validation:MinLength=1
+	StableProfile string `json:"stableProfile"`
+
+	// Waves are the HostedClusters updated together, in order. A HostedCluster is in the first wave selecting it,
+	// HostedClusters no wave selects are in the last wave
+	// +kubebuilder:validation:MinItems=1
+	Waves []RolloutWave `json:"waves"`
+
+	// PromotedWaves is the number of waves, from the first, whose HostedClusters are given the profile
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	PromotedWaves int32 `json:"promotedWaves,omitempty"`
+
+	// MaxFailures is the number of updated HostedClusters that may fail before the rollout is paused
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxFailures int32 `json:"maxFailures,omitempty"`
+}
+
+// RolloutWaveStatus summarizes the HostedClusters of a wave
+type RolloutWaveStatus struct {
+	// Clusters is the number of HostedClusters in the wave
+	Clusters int32 `json:"clusters"`
+	// Updated is the number of HostedClusters of the wave given the profile
+	Updated int32 `json:"updated"`
+	// Failed is the number of updated HostedClusters of the wave whose access could not be applied or verified
+	Failed int32 `json:"failed"`
+}
+
+// ProfileRolloutStatus defines the observed state of ProfileRollout
+type ProfileRolloutStatus struct {
+	// ObservedGeneration is the generation of the spec the status was computed for
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Phase is Progressing, Paused or Complete
+	// +optional
+	Phase string `json:"phase,omitempty"`
+	// Clusters, Updated and Failed sum the waves
+	// +optional
+	Clusters int32 `json:"clusters,omitempty"`
+	// +optional
+	Updated int32 `json:"updated,omitempty"`
+	// +optional
+	Failed int32 `json:"failed,omitempty"`
+	// Waves summarizes every wave, in order
+	// +optional
+	Waves []RolloutWaveStatus `json:"waves,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Profile",type=string,JSONPath=`.spec.profile`
+//+kubebuilder:printcolumn:name="Promoted",type=integer,JSONPath=`.spec.promotedWaves`
+//+kubebuilder:printcolumn:name="Updated",type=integer,JSONPath=`.status.updated`
+//+kubebuilder:printcolumn:name="Clusters",type=integer,JSONPath=`.status.clusters`
+//+kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failed`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+
+// ProfileRollout rolls a changed role profile out to the HostedClusters given it in waves
+type ProfileRollout struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ProfileRolloutSpec   `json:"spec,omitempty"`
+	Status ProfileRolloutStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ProfileRolloutList contains a list of ProfileRollout
+type ProfileRolloutList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ProfileRollout `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ProfileRollout{}, &ProfileRolloutList{})
+}
@@ -17,21 +17,44 @@ limitations under the License.
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
+	"fmt"
+	permissionsv1alpha1 "github.com/dana-team/permission-granter-controller/api/v1alpha1"
+	"github.com/dana-team/permission-granter-controller/pkg/audit"
+	"github.com/dana-team/permission-granter-controller/pkg/cli"
+	"github.com/dana-team/permission-granter-controller/pkg/config"
 	"github.com/dana-team/permission-granter-controller/pkg/controllers"
+	"github.com/dana-team/permission-granter-controller/pkg/notify"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	"github.com/dana-team/permission-granter-controller/pkg/server"
+	"github.com/dana-team/permission-granter-controller/pkg/state"
+	"github.com/dana-team/permission-granter-controller/pkg/utils"
+	"github.com/dana-team/permission-granter-controller/pkg/version"
 	"github.com/go-logr/zapr"
+	"github.com/openshift/hypershift/api/v1alpha1"
 	"go.elastic.co/ecszap"
 	"go.uber.org/zap"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	//+kubebuilder:scaffold:imports
 )
@@ -39,37 +62,192 @@ import (
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
+	// subcommands run instead of the manager when their name is the first argument
+	subcommands = map[string]func(args []string, out io.Writer) error{
+		"audit":       cli.Audit,
+		"permissions": cli.Permissions,
+		"render":      cli.Render,
+		"report":      cli.Report,
+	}
 )
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(v1alpha1.AddToScheme(scheme))
+	utilruntime.Must(permissionsv1alpha1.AddToScheme(scheme))
 
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
-	var metricsAddr string
-	var enableLeaderElection bool
-	var probeAddr string
-	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
-	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
-	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			if err := subcommand(os.Args[2:], os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	var configFile string
+	cfg := config.Default()
+	flag.StringVar(&configFile, "config", "",
+		"Path to the configuration file of the manager, flags set on the command line take precedence over it.")
+	flag.StringVar(&cfg.Manager.MetricsBindAddress, "metrics-bind-address", cfg.Manager.MetricsBindAddress,
+		"The address the metric endpoint binds to.")
+	flag.StringVar(&cfg.Manager.HealthProbeBindAddress, "health-probe-bind-address", cfg.Manager.HealthProbeBindAddress,
+		"The address the probe endpoint binds to.")
+	flag.BoolVar(&cfg.Manager.LeaderElection.Enabled, "leader-elect", cfg.Manager.LeaderElection.Enabled,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&cfg.Reconciler.GroupNameTemplate, "group-name-template", cfg.Reconciler.GroupNameTemplate,
+		"Go template for the name of the custom cluster admin group created at each hosted cluster.")
+	flag.StringVar(&cfg.Reconciler.RBACDefinitionNameTemplate, "rbac-definition-name-template", cfg.Reconciler.RBACDefinitionNameTemplate,
+		"Go template for the name of the RBACDefinition created at each hosted cluster.")
+	flag.StringVar(&cfg.Audit.Namespace, "audit-namespace", cfg.Audit.Namespace,
+		"The namespace at the management cluster audit records are written to.")
+	flag.StringVar(&cfg.Audit.HMACKeyFile, "audit-hmac-key-file", cfg.Audit.HMACKeyFile,
+		"Sign the hashes of the audit records with the key in this file, e.g. a mounted Secret kept out of the audit namespace.")
+	flag.StringVar(&cfg.Audit.MirrorFile, "audit-mirror-file", cfg.Audit.MirrorFile,
+		"Also write every audit record as a JSON line to this file, '-' writes to stdout.")
+	flag.StringVar(&cfg.Audit.Syslog.Address, "audit-syslog-address", cfg.Audit.Syslog.Address,
+		"Also send every audit record as an RFC 5424 message to this syslog server, e.g. siem.example.com:6514.")
+	flag.StringVar(&cfg.Audit.Syslog.Network, "audit-syslog-network", cfg.Audit.Syslog.Network, "The syslog network: udp, tcp or tls.")
+	flag.StringVar(&cfg.Audit.Syslog.CAFile, "audit-syslog-ca-file", cfg.Audit.Syslog.CAFile,
+		"CA bundle the syslog server certificate is verified with, the system roots are used when empty.")
+	flag.StringVar(&cfg.Audit.WebhookURL, "audit-webhook-url", cfg.Audit.WebhookURL, "Also post every audit record as JSON to this URL.")
+	flag.IntVar(&cfg.Audit.QueueSize, "audit-queue-size", cfg.Audit.QueueSize,
+		"The number of audit records queued in memory for each syslog or webhook sink.")
+	flag.StringVar(&cfg.Audit.SpoolDir, "audit-spool-dir", cfg.Audit.SpoolDir,
+		"Directory audit records that do not fit in the queue of a syslog or webhook sink are spooled to.")
+	flag.StringVar(&cfg.Notify.SMTP.Address, "notify-smtp-address", cfg.Notify.SMTP.Address,
+		"Email users when they are given access through this SMTP server, e.g. smtp.example.com:587. "+
+			"The password of --notify-smtp-username is read from the NOTIFY_SMTP_PASSWORD environment variable.")
+	flag.StringVar(&cfg.Notify.SMTP.From, "notify-smtp-from", cfg.Notify.SMTP.From, "The sender of notification emails.")
+	flag.StringVar(&cfg.Notify.SMTP.Username, "notify-smtp-username", cfg.Notify.SMTP.Username, "The user to authenticate to the SMTP server with.")
+	flag.StringVar(&cfg.Notify.EmailDomain, "notify-email-domain", cfg.Notify.EmailDomain,
+		"Domain appended to users that are not email addresses when emailing them.")
+	flag.StringVar(&cfg.Notify.WebhookURL, "notify-webhook-url", cfg.Notify.WebhookURL, "Post a notification to this URL when a user is given access.")
+	flag.StringVar(&cfg.Notify.SubjectTemplate, "notify-subject-template", cfg.Notify.SubjectTemplate,
+		"Path to the go template of the notification subject, executed with the notification.")
+	flag.StringVar(&cfg.Notify.BodyTemplate, "notify-body-template", cfg.Notify.BodyTemplate,
+		"Path to the go template of the notification text, executed with the notification.")
+	flag.StringVar(&cfg.Reconciler.ConsoleURLTemplate, "console-url-template", cfg.Reconciler.ConsoleURLTemplate,
+		"Go template of the web console URL sent in notifications, executed with the HostedCluster.")
+	flag.StringVar(&cfg.Reconciler.OwnerNamespace, "owner-namespace", cfg.Reconciler.OwnerNamespace,
+		"The namespace at the hosted clusters the cluster-owner ConfigMap is published in. Set this to '' to publish nothing.")
+	flag.Var((*keysFlag)(&cfg.Reconciler.PropagateLabels), "propagate-labels",
+		"Comma separated HostedCluster label keys copied onto the guest group and namespaces, a key ending with * matches a prefix.")
+	flag.Var((*keysFlag)(&cfg.Reconciler.PropagateAnnotations), "propagate-annotations",
+		"Comma separated HostedCluster annotation keys copied onto the guest group and namespaces, a key ending with * matches a prefix.")
+	flag.Var((*keysFlag)(&cfg.Reconciler.ProtectedNamespaces), "protected-namespaces",
+		"Comma separated patterns of hosted cluster namespaces the role profile must not give access to.")
+	flag.BoolVar(&cfg.Reconciler.DryRun, "dry-run", cfg.Reconciler.DryRun,
+		"Send every change to the hosted clusters as a server-side dry-run request and only report the diff.")
+	flag.StringVar(&cfg.Profiles.Profile, "profile", cfg.Profiles.Profile,
+		"Path to the role profile given to the custom cluster admin group, the default profile is used when empty.")
+	flag.StringVar(&cfg.Profiles.Directory, "profiles-dir", cfg.Profiles.Directory,
+		"Directory of role profiles ProfilePolicies select by name, every YAML and JSON file in it is loaded.")
+	flag.StringVar(&cfg.Profiles.ConfigMap, "profiles-configmap", cfg.Profiles.ConfigMap,
+		"ConfigMap role profiles are hot-reloaded from, every YAML and JSON key in it is loaded. Nothing is loaded when empty.")
+	flag.StringVar(&cfg.Profiles.ConfigMapNamespace, "profiles-configmap-namespace", cfg.Profiles.ConfigMapNamespace,
+		"The namespace of --profiles-configmap, the namespace of the controller by default.")
+	flag.BoolVar(&cfg.Profiles.Policies, "profile-policies", cfg.Profiles.Policies,
+		"Select the role profile of every HostedCluster with the ProfilePolicies and roll profiles out with the ProfileRollouts, "+
+			"the ProfilePolicy and ProfileRollout CRDs must be installed. Off by default.")
+	flag.StringVar(&cfg.API.BindAddress, "api-bind-address", cfg.API.BindAddress,
+		"The address the read-only cluster state API binds to. Set this to '0' to disable the API.")
+	flag.StringVar(&cfg.API.TLSCertFile, "api-tls-cert-file", cfg.API.TLSCertFile, "TLS certificate the cluster state API is served with.")
+	flag.StringVar(&cfg.API.TLSKeyFile, "api-tls-key-file", cfg.API.TLSKeyFile, "TLS key the cluster state API is served with.")
 	flag.Parse()
+	if configFile != "" {
+		loaded, err := config.Load(configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to load configuration %s: %v\n", configFile, err)
+			os.Exit(1)
+		}
+		cfg = loaded
+		// the flags are parsed again onto the configuration file, the flags set on the command line take precedence
+		flag.Parse()
+	}
 
 	encoderConfig := ecszap.NewDefaultEncoderConfig()
-	core := ecszap.NewCore(encoderConfig, os.Stdout, zap.DebugLevel)
+	core := ecszap.NewCore(encoderConfig, os.Stdout, cfg.LogLevel())
 	logger := zap.New(core, zap.AddCaller())
 	ctrl.SetLogger(zapr.NewLogger(logger))
 
+	if err := cfg.Validate(); err != nil {
+		setupLog.Error(err, "invalid configuration")
+		os.Exit(1)
+	}
+	utils.KubeConfigSecretName = cfg.HostedClusters.KubeconfigSecretName
+	utils.KubeConfigSecretKey = cfg.HostedClusters.KubeconfigSecretKey
+
+	notifyTemplates, err := notify.LoadTemplates(cfg.Notify.SubjectTemplate, cfg.Notify.BodyTemplate)
+	if err != nil {
+		setupLog.Error(err, "unable to load notification templates")
+		os.Exit(1)
+	}
+	var notifiers notify.Multi
+	if cfg.Notify.SMTP.Address != "" {
+		notifiers = append(notifiers, &notify.SMTPNotifier{
+			Addr:      cfg.Notify.SMTP.Address,
+			From:      cfg.Notify.SMTP.From,
+			Username:  cfg.Notify.SMTP.Username,
+			Password:  os.Getenv("NOTIFY_SMTP_PASSWORD"),
+			Domain:    cfg.Notify.EmailDomain,
+			Templates: notifyTemplates,
+		})
+	}
+	if cfg.Notify.WebhookURL != "" {
+		notifiers = append(notifiers, &notify.WebhookNotifier{URL: cfg.Notify.WebhookURL, Templates: notifyTemplates})
+	}
+	var notifier notify.Notifier
+	if len(notifiers) > 0 {
+		notifier = notifiers
+	}
+
+	var profile *profiles.RoleProfile
+	if cfg.Profiles.Profile != "" {
+		var err error
+		if profile, err = profiles.LoadFile(cfg.Profiles.Profile); err != nil {
+			setupLog.Error(err, "unable to load role profile", "path", cfg.Profiles.Profile)
+			os.Exit(1)
+		}
+	}
+	var namedProfiles map[string]*profiles.RoleProfile
+	if cfg.Profiles.Directory != "" {
+		var err error
+		if namedProfiles, err = profiles.LoadDir(cfg.Profiles.Directory); err != nil {
+			setupLog.Error(err, "unable to load role profiles", "path", cfg.Profiles.Directory)
+			os.Exit(1)
+		}
+	}
+
+	var syncPeriod *time.Duration
+	if cfg.Manager.SyncPeriod.Duration > 0 {
+		syncPeriod = &cfg.Manager.SyncPeriod.Duration
+	}
+	var newCache cache.NewCacheFunc
+	if cfg.Profiles.ConfigMap != "" {
+		// the profile ConfigMap is the only ConfigMap read from the cache, every other ConfigMap is left out of it
+		newCache = cache.BuilderWithOptions(cache.Options{SelectorsByObject: cache.SelectorsByObject{
+			&corev1.ConfigMap{}: {Field: fields.SelectorFromSet(fields.Set{
+				"metadata.namespace": cfg.Profiles.ConfigMapNamespace,
+				"metadata.name":      cfg.Profiles.ConfigMap,
+			})},
+		}})
+	}
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
-		MetricsBindAddress:     metricsAddr,
-		Port:                   9443,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "59d79847.dana.io",
+		MetricsBindAddress:     cfg.Manager.MetricsBindAddress,
+		Port:                   cfg.Manager.WebhookPort,
+		HealthProbeBindAddress: cfg.Manager.HealthProbeBindAddress,
+		LeaderElection:         cfg.Manager.LeaderElection.Enabled,
+		LeaderElectionID:       cfg.Manager.LeaderElection.ResourceName,
+		SyncPeriod:             syncPeriod,
+		NewCache:               newCache,
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -87,16 +265,114 @@ func main() {
 		os.Exit(1)
 	}
 
+	auditStore := &audit.Store{Client: mgr.GetClient(), Reader: mgr.GetAPIReader(), Namespace: cfg.Audit.Namespace}
+	if cfg.Audit.HMACKeyFile != "" {
+		if auditStore.Key, err = audit.ReadKey(cfg.Audit.HMACKeyFile); err != nil {
+			setupLog.Error(err, "unable to read audit key", "path", cfg.Audit.HMACKeyFile)
+			os.Exit(1)
+		}
+	}
+	auditTrail := &audit.Trail{
+		Store: auditStore,
+		Log:   mgr.GetLogger().WithName("audit"),
+	}
+	switch cfg.Audit.MirrorFile {
+	case "":
+	case "-":
+		auditTrail.Mirrors = append(auditTrail.Mirrors, &audit.WriterSink{Writer: os.Stdout})
+	default:
+		mirrorFile, err := os.OpenFile(cfg.Audit.MirrorFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			setupLog.Error(err, "unable to open audit mirror file", "path", cfg.Audit.MirrorFile)
+			os.Exit(1)
+		}
+		defer mirrorFile.Close()
+		auditTrail.Mirrors = append(auditTrail.Mirrors, &audit.WriterSink{Writer: mirrorFile})
+	}
+	remoteSinks := map[string]audit.Sink{}
+	if cfg.Audit.Syslog.Address != "" {
+		syslogSink := &audit.SyslogSink{Network: cfg.Audit.Syslog.Network, Address: cfg.Audit.Syslog.Address}
+		if cfg.Audit.Syslog.Network == audit.SyslogTLS && cfg.Audit.Syslog.CAFile != "" {
+			if syslogSink.TLSConfig, err = tlsConfigWithCA(cfg.Audit.Syslog.CAFile); err != nil {
+				setupLog.Error(err, "unable to load audit syslog CA bundle", "path", cfg.Audit.Syslog.CAFile)
+				os.Exit(1)
+			}
+		}
+		remoteSinks["syslog"] = syslogSink
+	}
+	if cfg.Audit.WebhookURL != "" {
+		remoteSinks["webhook"] = &audit.WebhookSink{URL: cfg.Audit.WebhookURL}
+	}
+	for name, sink := range remoteSinks {
+		bufferedSink := &audit.BufferedSink{
+			Sink:     sink,
+			Capacity: cfg.Audit.QueueSize,
+			Log:      mgr.GetLogger().WithName("audit").WithName(name),
+		}
+		if cfg.Audit.SpoolDir != "" {
+			bufferedSink.SpoolDir = filepath.Join(cfg.Audit.SpoolDir, name)
+		}
+		if err := mgr.Add(bufferedSink); err != nil {
+			setupLog.Error(err, "unable to set up audit sink", "sink", name)
+			os.Exit(1)
+		}
+		auditTrail.Mirrors = append(auditTrail.Mirrors, bufferedSink)
+	}
+
+	clusterState := state.NewStore()
+	var policyReader client.Reader
+	if cfg.Profiles.Policies {
+		policyReader = mgr.GetClient()
+	}
 	if err = (&controllers.HostedClusterReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Log:    mgr.GetLogger(),
+		Client:                    mgr.GetClient(),
+		Scheme:                    mgr.GetScheme(),
+		Log:                       mgr.GetLogger(),
+		Recorder:                  mgr.GetEventRecorderFor("permission-granter-controller"),
+		Audit:                     auditTrail,
+		NameTemplates:             cfg.NameTemplates(),
+		Profile:                   profile,
+		Profiles:                  namedProfiles,
+		Policies:                  policyReader,
+		ProfileConfigMap:          types.NamespacedName{Namespace: cfg.Profiles.ConfigMapNamespace, Name: cfg.Profiles.ConfigMap},
+		OwnerNamespace:            cfg.Reconciler.OwnerNamespace,
+		Propagation:               cfg.Propagation(),
+		ProtectedNamespaces:       cfg.Reconciler.ProtectedNamespaces,
+		Notifier:                  notifier,
+		ConsoleURLTemplate:        cfg.Reconciler.ConsoleURLTemplate,
+		State:                     clusterState,
+		MaxConcurrentReconciles:   cfg.Reconciler.MaxConcurrentReconciles,
+		VerificationRetryInterval: cfg.Reconciler.VerificationRetryInterval.Duration,
+		DryRun:                    cfg.Reconciler.DryRun,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "HostedCluster")
 		os.Exit(1)
 	}
+	if cfg.Profiles.Policies {
+		if err = (&controllers.ProfileRolloutReconciler{
+			Client: mgr.GetClient(),
+			Log:    mgr.GetLogger().WithName("profile-rollout"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ProfileRollout")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
+	if cfg.API.BindAddress != "0" {
+		if err := mgr.Add(&server.Server{
+			Addr:          cfg.API.BindAddress,
+			CertFile:      cfg.API.TLSCertFile,
+			KeyFile:       cfg.API.TLSKeyFile,
+			State:         clusterState,
+			Authenticator: &server.KubernetesAuthenticator{Client: mgr.GetClient()},
+			Log:           mgr.GetLogger().WithName("api"),
+		}); err != nil {
+			setupLog.Error(err, "unable to set up cluster state API")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -106,9 +382,48 @@ func main() {
 		os.Exit(1)
 	}
 
-	setupLog.Info("starting manager")
+	setupLog.Info("starting manager", "version", version.Version, "dryRun", cfg.Reconciler.DryRun)
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// keysFlag is a flag of comma separated keys
+type keysFlag []string
+
+func (k *keysFlag) String() string {
+	if k == nil {
+		return ""
+	}
+	return strings.Join(*k, ",")
+}
+
+func (k *keysFlag) Set(list string) error {
+	*k = splitKeys(list)
+	return nil
+}
+
+// splitKeys returns the non empty keys of a comma separated list
+func splitKeys(list string) []string {
+	var keys []string
+	for _, key := range strings.Split(list, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// tlsConfigWithCA returns a TLS configuration trusting the CA bundle at path
+func tlsConfigWithCA(path string) (*tls.Config, error) {
+	bundle, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}, nil
+}
@@ -0,0 +1,184 @@
+package access
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The annotations below are the contract between the controller and the tools that grant access.
+// RequesterAnnotation holds the single user who requested the HostedCluster, GrantsAnnotation holds additional
+// grants as a JSON list and StatusAnnotation is written by the controller to report what it applied
+var (
+	RequesterAnnotation    = "dana.io/requester"
+	ClusterAdminAnnotation = "dana.io/addedclusteradmin"
+	GrantsAnnotation       = "dana.io/grants"
+	StatusAnnotation       = "dana.io/access-status"
+)
+
+// Sources describe where the access of a user to a hosted cluster comes from
+const (
+	SourceAnnotation = "annotation"
+	SourceGrant      = "grant"
+	SourceBreakGlass = "break-glass"
+)
+
+// Grant gives a user access to a hosted cluster, optionally until it expires
+type Grant struct {
+	User      string      `json:"user"`
+	GrantedBy string      `json:"grantedBy,omitempty"`
+	GrantedAt v1api.Time  `json:"grantedAt"`
+	ExpiresAt *v1api.Time `json:"expiresAt,omitempty"`
+}
+
+// Active returns true if the grant has not expired at the given time
+func (g Grant) Active(now time.Time) bool {
+	return g.ExpiresAt == nil || now.Before(g.ExpiresAt.Time)
+}
+
+// Status is reported by the controller on the HostedCluster after every reconcile that changed it
+type Status struct {
+	Group          string `json:"group,omitempty"`
+	RBACDefinition string `json:"rbacDefinition,omitempty"`
+	Profile        string `json:"profile,omitempty"`
+	// ProfilePolicy is the ProfilePolicy rule that selected the profile, empty when the configured profile is used
+	ProfilePolicy string `json:"profilePolicy,omitempty"`
+	// Rollout records the ProfileRollout of the selected profile, empty when the profile is not being rolled out
+	Rollout    *Rollout `json:"rollout,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	Violations []string `json:"violations,omitempty"`
+	// Protected are the ways the profile would reach protected namespaces, the profile is not applied while there are any
+	Protected []string `json:"protected,omitempty"`
+	// Verification is the result of the access checks of the profile, empty when the profile has none
+	Verification *Verification `json:"verification,omitempty"`
+	Users        []string      `json:"users,omitempty"`
+	// Unnotified are the users that were not told of their access yet, they are notified once the access passed verification
+	Unnotified []string `json:"unnotified,omitempty"`
+	// OwnerInfo is true while the owners of the hosted cluster may be published at it, so they are removed with the owner annotations
+	OwnerInfo bool       `json:"ownerInfo,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+	UpdatedAt v1api.Time `json:"updatedAt"`
+}
+
+// Rollout records where a HostedCluster is in the ProfileRollout of its profile
+type Rollout struct {
+	Name string `json:"name"`
+	Wave int    `json:"wave"`
+	// Promoted is true when the HostedCluster was given the profile being rolled out, false while it is pinned to the stable profile
+	Promoted bool `json:"promoted"`
+}
+
+// Failed returns true when the access of the status could not be applied, was rejected or did not pass verification
+func (s *Status) Failed() bool {
+	return s.LastError != "" || len(s.Violations) > 0 || len(s.Protected) > 0 || (s.Verification != nil && !s.Verification.Passed)
+}
+
+// Verification is the result of checking the effective permissions of the users at the hosted cluster
+type Verification struct {
+	Passed bool `json:"passed"`
+	// Failures describe the checks that did not have the expected result, e.g. "alice cannot create deployments.apps in apps"
+	Failures []string `json:"failures,omitempty"`
+}
+
+// GetGrants returns the grants recorded on the object, in the order they were added
+func GetGrants(obj client.Object) ([]Grant, error) {
+	value, ok := obj.GetAnnotations()[GrantsAnnotation]
+	if !ok || value == "" {
+		return nil, nil
+	}
+	var grants []Grant
+	if err := json.Unmarshal([]byte(value), &grants); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", GrantsAnnotation, err)
+	}
+	return grants, nil
+}
+
+// SetGrants records the grants on the object, removing the annotation when there are none
+func SetGrants(obj client.Object, grants []Grant) error {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	if len(grants) == 0 {
+		delete(annotations, GrantsAnnotation)
+		obj.SetAnnotations(annotations)
+		return nil
+	}
+	value, err := json.Marshal(grants)
+	if err != nil {
+		return err
+	}
+	annotations[GrantsAnnotation] = string(value)
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// AddGrant replaces any grant the user already has with the given grant
+func AddGrant(grants []Grant, grant Grant) []Grant {
+	return append(RemoveGrant(grants, grant.User), grant)
+}
+
+// RemoveGrant returns the grants without the ones given to user
+func RemoveGrant(grants []Grant, user string) []Grant {
+	var remaining []Grant
+	for _, grant := range grants {
+		if grant.User != user {
+			remaining = append(remaining, grant)
+		}
+	}
+	return remaining
+}
+
+// GetStatus returns the status the controller reported on the object, or nil if it never reported one
+func GetStatus(obj client.Object) (*Status, error) {
+	value, ok := obj.GetAnnotations()[StatusAnnotation]
+	if !ok || value == "" {
+		return nil, nil
+	}
+	status := &Status{}
+	if err := json.Unmarshal([]byte(value), status); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", StatusAnnotation, err)
+	}
+	return status, nil
+}
+
+// GetRequester gets a HostedCluster and returns the user who requested it, empty if it has none.
+// The requester annotation holds a single user name, it is not a list: a value like "a,b" is one user name
+func GetRequester(obj client.Object) string {
+	return strings.TrimSpace(obj.GetAnnotations()[RequesterAnnotation])
+}
+
+// Subjects gets a HostedCluster and the current time and returns the sorted users that should be members
+// of the custom cluster admin group: the requester and every active grant.
+// The second return value is the earliest time an active grant expires, zero if none expires
+func Subjects(obj client.Object, now time.Time) ([]string, time.Time, error) {
+	users := make(map[string]bool)
+	if requester := GetRequester(obj); requester != "" {
+		users[requester] = true
+	}
+	grants, err := GetGrants(obj)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var nextExpiry time.Time
+	for _, grant := range grants {
+		if !grant.Active(now) {
+			continue
+		}
+		users[grant.User] = true
+		if grant.ExpiresAt != nil && (nextExpiry.IsZero() || grant.ExpiresAt.Time.Before(nextExpiry)) {
+			nextExpiry = grant.ExpiresAt.Time
+		}
+	}
+	subjects := make([]string, 0, len(users))
+	for user := range users {
+		subjects = append(subjects, user)
+	}
+	sort.Strings(subjects)
+	return subjects, nextExpiry, nil
+}
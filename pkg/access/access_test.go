@@ -0,0 +1,73 @@
+package access
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+)
+
+func TestSubjects(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		annotations    map[string]string
+		want           []string
+		wantNextExpiry time.Time
+		wantErr        bool
+	}{
+		{
+			name: "no access",
+		},
+		{
+			name:        "requester only",
+			annotations: map[string]string{RequesterAnnotation: "requester"},
+			want:        []string{"requester"},
+		},
+		{
+			name:        "requester is a single user",
+			annotations: map[string]string{RequesterAnnotation: " alice,bob "},
+			want:        []string{"alice,bob"},
+		},
+		{
+			name:        "blank requester",
+			annotations: map[string]string{RequesterAnnotation: " "},
+		},
+		{
+			name: "requester and grants",
+			annotations: map[string]string{
+				RequesterAnnotation: "requester",
+				GrantsAnnotation: `[{"user":"bob","grantedAt":"2022-10-01T10:00:00Z","expiresAt":"2022-10-01T14:00:00Z"},
+					{"user":"alice","grantedAt":"2022-10-01T10:00:00Z","expiresAt":"2022-10-01T13:00:00Z"},
+					{"user":"expired","grantedAt":"2022-10-01T10:00:00Z","expiresAt":"2022-10-01T11:00:00Z"},
+					{"user":"requester","grantedAt":"2022-10-01T10:00:00Z"}]`,
+			},
+			want:           []string{"alice", "bob", "requester"},
+			wantNextExpiry: time.Date(2022, 10, 1, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "invalid grants",
+			annotations: map[string]string{GrantsAnnotation: "alice"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostedCluster := GetHostedClusterObject("test")
+			hostedCluster.SetAnnotations(tt.annotations)
+			got, nextExpiry, err := Subjects(hostedCluster, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Subjects() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != 0 || len(tt.want) != 0 {
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Subjects() got = %v, want %v", got, tt.want)
+				}
+			}
+			if !nextExpiry.Equal(tt.wantNextExpiry) {
+				t.Errorf("Subjects() next expiry got = %v, want %v", nextExpiry, tt.wantNextExpiry)
+			}
+		})
+	}
+}
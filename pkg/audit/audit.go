@@ -0,0 +1,183 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/version"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	RecordLabel        = "dana.io/audit-record"
+	HostedClusterLabel = "dana.io/hostedcluster"
+	RecordKey          = "record.json"
+	SequenceLabel      = "dana.io/audit-sequence"
+)
+
+// Actions describe what the controller did to the hosted cluster object
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionAdopt  = "adopt"
+)
+
+// Triggers describe why the controller made a change
+const (
+	TriggerRequester  = "requester"
+	TriggerGrant      = "grant"
+	TriggerExpiry     = "expiry"
+	TriggerRevoke     = "revoke"
+	TriggerBreakGlass = "break-glass"
+	TriggerAdopt      = "adopt"
+	TriggerReconcile  = "reconcile"
+)
+
+// ControllerActor is the actor of every change the controller makes, the users the HostedCluster annotations name are
+// not verified and are recorded as ClaimedBy
+const ControllerActor = "permission-granter-controller"
+
+// ObjectReference identifies the hosted cluster object a record is about
+type ObjectReference struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// Record is a single audit entry describing a change the controller made to a hosted cluster
+type Record struct {
+	// Sequence is the position of the record in the chain, starting at 1
+	Sequence uint64 `json:"sequence,omitempty"`
+	// PrevHash is the Hash of the record with the previous sequence, empty for the first record
+	PrevHash string `json:"prevHash,omitempty"`
+	// Hash is the hex encoded SHA-256 of the record with an empty Hash, or its HMAC-SHA256 with the audit key when Keyed
+	Hash             string    `json:"hash,omitempty"`
+	Keyed            bool      `json:"keyed,omitempty"`
+	Time             time.Time `json:"time"`
+	Cluster          string    `json:"cluster"`
+	ClusterNamespace string    `json:"clusterNamespace"`
+	// Actor is who made the change, ControllerActor
+	Actor   string `json:"actor"`
+	Trigger string `json:"trigger"`
+	// ClaimedBy is who the HostedCluster annotations claim asked for the change: the requester it added, the granters
+	// of the grants it added or the user given cluster-admin. Anyone allowed to edit the HostedCluster can write them,
+	// so they are not verified and never used as Actor
+	ClaimedBy string `json:"claimedBy,omitempty"`
+	Action    string `json:"action"`
+	// ControllerVersion is the version of the controller that made the change
+	ControllerVersion string          `json:"controllerVersion"`
+	Object            ObjectReference `json:"object"`
+	Previous          json.RawMessage `json:"previous,omitempty"`
+	New               json.RawMessage `json:"new,omitempty"`
+}
+
+// NewRecord gets the HostedCluster, the action and the previous and new state of an object and returns a Record for them,
+// attributed to the controller until Actor and Trigger are set. Either of the states may be nil
+func NewRecord(hostedCluster client.Object, action string, kind string, previous runtime.Object, new runtime.Object) (Record, error) {
+	record := Record{
+		Time:              time.Now().UTC(),
+		Cluster:           hostedCluster.GetName(),
+		ClusterNamespace:  hostedCluster.GetNamespace(),
+		Actor:             ControllerActor,
+		Trigger:           TriggerReconcile,
+		Action:            action,
+		ControllerVersion: version.Version,
+		Object:            ObjectReference{Kind: kind},
+	}
+	for _, state := range []struct {
+		obj    runtime.Object
+		target *json.RawMessage
+	}{{previous, &record.Previous}, {new, &record.New}} {
+		if state.obj == nil {
+			continue
+		}
+		raw, err := json.Marshal(state.obj)
+		if err != nil {
+			return Record{}, err
+		}
+		*state.target = raw
+		if accessor, ok := state.obj.(client.Object); ok {
+			record.Object.Name = accessor.GetName()
+		}
+	}
+	return record, nil
+}
+
+// Sink receives audit records
+type Sink interface {
+	Write(ctx context.Context, record Record) error
+}
+
+// Store writes audit records to the management cluster, it is append-only: records are never updated or deleted.
+// Records are chained, each one carries a sequence number and the hash of the record before it, see Append
+type Store struct {
+	Client    client.Client
+	Namespace string
+	// Key signs the hashes of the records with HMAC-SHA256 when set, so records cannot be rewritten by whoever can
+	// write ConfigMaps in Namespace. It must be kept outside of Namespace
+	Key []byte
+	// Reader reads the head of the chain, the API server is read through Client when it is nil.
+	// It should not be a cache since a stale head makes every append conflict until the cache catches up
+	Reader client.Reader
+
+	mu   sync.Mutex
+	head *Record
+}
+
+// Write appends the record to the chain
+func (s *Store) Write(ctx context.Context, record Record) error {
+	_, err := s.Append(ctx, record)
+	return err
+}
+
+// Trail writes every record to the Store and mirrors it to additional sinks.
+// A record is only considered written once the Store accepted it, a failing mirror is logged and does not fail the write
+type Trail struct {
+	Store   Sink
+	Mirrors []Sink
+	Log     logr.Logger
+}
+
+// Write writes the record to the Store and then to every mirror.
+// When the Store chains records the mirrors receive the chained record
+func (t *Trail) Write(ctx context.Context, record Record) error {
+	if appender, ok := t.Store.(Appender); ok {
+		chained, err := appender.Append(ctx, record)
+		if err != nil {
+			return err
+		}
+		record = chained
+	} else if err := t.Store.Write(ctx, record); err != nil {
+		return err
+	}
+	for _, mirror := range t.Mirrors {
+		if err := mirror.Write(ctx, record); err != nil {
+			t.Log.Error(err, "could not mirror audit record", "sink", fmt.Sprintf("%T", mirror), "cluster", record.Cluster)
+		}
+	}
+	return nil
+}
+
+// WriterSink writes every record as a JSON line, e.g. to stdout or a file collected by a log shipper
+type WriterSink struct {
+	Writer io.Writer
+	mu     sync.Mutex
+}
+
+// Write writes the record followed by a newline
+func (w *WriterSink) Write(_ context.Context, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = w.Writer.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/dana-team/permission-granter-controller/pkg/version"
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type failingSink struct{}
+
+func (failingSink) Write(_ context.Context, _ Record) error {
+	return errors.New("unavailable")
+}
+
+func TestTrail_Write(t *testing.T) {
+	hostedCluster := GetHostedClusterObject("test")
+	clusterRoleBinding := GetClusterRoleBinding("user")
+	record, err := NewRecord(hostedCluster, ActionCreate, "ClusterRoleBinding", nil, &clusterRoleBinding)
+	if err != nil {
+		t.Fatalf("NewRecord() error = %v", err)
+	}
+	if record.Object.Name != "user" || record.ControllerVersion != version.Version || record.Actor != ControllerActor {
+		t.Errorf("unexpected record %+v", record)
+	}
+
+	tests := []struct {
+		name        string
+		store       Sink
+		wantErr     bool
+		wantMirrors int
+	}{
+		{
+			name:        "writes to store and mirrors",
+			store:       &Store{Client: fake.NewClientBuilder().Build(), Namespace: "audit"},
+			wantMirrors: 1,
+		},
+		{
+			name:    "store failure fails the write",
+			store:   failingSink{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mirror := bytes.Buffer{}
+			trail := &Trail{Store: tt.store, Mirrors: []Sink{failingSink{}, &WriterSink{Writer: &mirror}}, Log: logr.Discard()}
+			if err := trail.Write(context.Background(), record); (err != nil) != tt.wantErr {
+				t.Fatalf("Write() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			lines := bytes.Count(mirror.Bytes(), []byte("\n"))
+			if lines != tt.wantMirrors {
+				t.Fatalf("mirrored records got: %d want %d", lines, tt.wantMirrors)
+			}
+			if store, ok := tt.store.(*Store); ok {
+				configMaps := corev1.ConfigMapList{}
+				if err := store.Client.List(context.Background(), &configMaps); err != nil {
+					t.Fatalf("could not list records: %v", err)
+				}
+				if len(configMaps.Items) != 1 || !*configMaps.Items[0].Immutable {
+					t.Fatalf("expected a single immutable record, got %v", configMaps.Items)
+				}
+				stored := Record{}
+				if err := json.Unmarshal([]byte(configMaps.Items[0].Data[RecordKey]), &stored); err != nil || stored.Action != ActionCreate {
+					t.Errorf("unexpected stored record %s: %v", configMaps.Items[0].Data[RecordKey], err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// ErrQueueFull is returned by BufferedSink when a record can neither be queued in memory nor spooled to disk
+var ErrQueueFull = errors.New("audit sink queue is full")
+
+// BufferedSink queues records and delivers them to Sink in the background, retrying failed deliveries with backoff,
+// so writing a record never waits for a slow or unavailable remote sink.
+// Records are kept in a bounded memory queue. When SpoolDir is set records that do not fit in memory, and the memory
+// queue when the sink stops, are written to files in SpoolDir which are delivered, in order, once it drains.
+// Records are delivered at least once and in the order they were written.
+// The sink must be started with Start, it implements manager.Runnable
+type BufferedSink struct {
+	Sink Sink
+	// Capacity is the number of records queued in memory, 1000 when zero
+	Capacity int
+	// SpoolDir is the directory records are spooled to, nothing is spooled when empty
+	SpoolDir string
+	// SpoolCapacity is the number of records kept in SpoolDir, 10000 when zero
+	SpoolCapacity int
+	// RetryInterval is the delay before the first retry of a failed delivery, doubled up to MaxRetryInterval
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	Log              logr.Logger
+
+	mu     sync.Mutex
+	queue  []queuedRecord
+	spool  []string
+	loaded bool
+	seq    uint64
+	notify chan struct{}
+}
+
+// queuedRecord is a record and the name of its spool file, derived from the time it was written so spool files sort in write order
+type queuedRecord struct {
+	record Record
+	name   string
+}
+
+// Write queues the record for delivery
+func (b *BufferedSink) Write(_ context.Context, record Record) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.loadSpool(); err != nil {
+		return err
+	}
+	b.seq++
+	queued := queuedRecord{record: record, name: fmt.Sprintf("%020d-%08d.json", time.Now().UnixNano(), b.seq)}
+	// once records were spooled new records are spooled behind them so they are delivered in order
+	if len(b.spool) == 0 && len(b.queue) < b.capacity() {
+		b.queue = append(b.queue, queued)
+	} else if err := b.spoolRecord(queued); err != nil {
+		return err
+	}
+	b.signal()
+	return nil
+}
+
+// Start delivers queued records until the context is cancelled, the memory queue is then spooled if SpoolDir is set
+func (b *BufferedSink) Start(ctx context.Context) error {
+	b.mu.Lock()
+	err := b.loadSpool()
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for {
+		queued, ok, err := b.next()
+		if err != nil {
+			b.Log.Error(err, "skipping spooled audit record that cannot be read")
+			continue
+		}
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return b.stop()
+			case <-b.notifyChan():
+				continue
+			}
+		}
+		if !b.deliver(ctx, queued.record) {
+			return b.stop()
+		}
+		b.pop(queued)
+	}
+}
+
+// NeedLeaderElection makes the sink run on every replica so records spooled by a replica that lost leadership
+// are still delivered
+func (b *BufferedSink) NeedLeaderElection() bool {
+	return false
+}
+
+// deliver writes the record to Sink until it succeeds, it returns false if the context was cancelled first
+func (b *BufferedSink) deliver(ctx context.Context, record Record) bool {
+	interval := b.RetryInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	maxInterval := b.MaxRetryInterval
+	if maxInterval == 0 {
+		maxInterval = time.Minute
+	}
+	for {
+		err := b.Sink.Write(ctx, record)
+		if err == nil {
+			return true
+		}
+		b.Log.Error(err, "could not deliver audit record, retrying", "sink", fmt.Sprintf("%T", b.Sink),
+			"sequence", record.Sequence, "retryIn", interval.String())
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+// next returns the oldest undelivered record without removing it from the queue
+func (b *BufferedSink) next() (queuedRecord, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.queue) > 0 {
+		return b.queue[0], true, nil
+	}
+	if len(b.spool) > 0 {
+		name := b.spool[0]
+		data, err := os.ReadFile(filepath.Join(b.SpoolDir, name))
+		record := Record{}
+		if err == nil {
+			err = json.Unmarshal(data, &record)
+		}
+		if err != nil {
+			// a spool file that cannot be read would block delivery forever, it is skipped
+			b.spool = b.spool[1:]
+			_ = os.Remove(filepath.Join(b.SpoolDir, name))
+			return queuedRecord{}, false, fmt.Errorf("%s: %w", name, err)
+		}
+		return queuedRecord{record: record, name: name}, true, nil
+	}
+	return queuedRecord{}, false, nil
+}
+
+// pop removes a delivered record from the queue or the spool
+func (b *BufferedSink) pop(queued queuedRecord) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.queue) > 0 && b.queue[0].name == queued.name {
+		b.queue = b.queue[1:]
+		return
+	}
+	if len(b.spool) > 0 && b.spool[0] == queued.name {
+		b.spool = b.spool[1:]
+		if err := os.Remove(filepath.Join(b.SpoolDir, queued.name)); err != nil {
+			b.Log.Error(err, "could not remove delivered audit record from the spool", "file", queued.name)
+		}
+	}
+}
+
+// stop spools the records left in memory so they are delivered after a restart
+func (b *BufferedSink) stop() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.SpoolDir == "" {
+		if len(b.queue) > 0 {
+			b.Log.Info("dropping undelivered audit records", "sink", fmt.Sprintf("%T", b.Sink), "count", len(b.queue))
+		}
+		return nil
+	}
+	var errs []string
+	for _, queued := range b.queue {
+		if err := b.writeSpoolFile(queued); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	b.queue = nil
+	if len(errs) > 0 {
+		return fmt.Errorf("could not spool audit records: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// loadSpool reads the names of the records left in SpoolDir by a previous run, it is called with the lock held
+func (b *BufferedSink) loadSpool() error {
+	if b.loaded || b.SpoolDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(b.SpoolDir, 0o700); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(b.SpoolDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			b.spool = append(b.spool, entry.Name())
+		}
+	}
+	sort.Strings(b.spool)
+	b.loaded = true
+	return nil
+}
+
+// spoolRecord writes a record that does not fit in memory to SpoolDir, it is called with the lock held
+func (b *BufferedSink) spoolRecord(queued queuedRecord) error {
+	if b.SpoolDir == "" || len(b.spool) >= b.spoolCapacity() {
+		return ErrQueueFull
+	}
+	if err := b.writeSpoolFile(queued); err != nil {
+		return err
+	}
+	b.spool = append(b.spool, queued.name)
+	return nil
+}
+
+// writeSpoolFile writes the record to a temporary file renamed into place so a partial file is never delivered
+func (b *BufferedSink) writeSpoolFile(queued queuedRecord) error {
+	data, err := json.Marshal(queued.record)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(b.SpoolDir, queued.name)
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// signal wakes up the delivery loop, it is called with the lock held
+func (b *BufferedSink) signal() {
+	if b.notify == nil {
+		b.notify = make(chan struct{}, 1)
+	}
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (b *BufferedSink) notifyChan() chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.notify == nil {
+		b.notify = make(chan struct{}, 1)
+	}
+	return b.notify
+}
+
+func (b *BufferedSink) capacity() int {
+	if b.Capacity == 0 {
+		return 1000
+	}
+	return b.Capacity
+}
+
+func (b *BufferedSink) spoolCapacity() int {
+	if b.SpoolCapacity == 0 {
+		return 10000
+	}
+	return b.SpoolCapacity
+}
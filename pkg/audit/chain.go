@@ -0,0 +1,268 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// appendRetries is how many times Append reloads the head of the chain when another writer appended first
+const appendRetries = 5
+
+// Appender is a Sink that chains records and returns them as they were stored
+type Appender interface {
+	Sink
+	Append(ctx context.Context, record Record) (Record, error)
+}
+
+// ComputeHash returns the hex encoded hash of the record with an empty Hash: the HMAC-SHA256 with key when the record is
+// Keyed, the SHA-256 otherwise. Without the key nobody can recompute the hash of a keyed record they rewrote
+func ComputeHash(record Record, key []byte) (string, error) {
+	record.Hash = ""
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	if !record.Keyed {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:]), nil
+	}
+	if len(key) == 0 {
+		return "", errors.New("the record is signed with the audit key and no key was given")
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// minKeySize is the shortest audit key accepted, the size of the SHA-256 the HMAC is built on
+const minKeySize = 32
+
+// ReadKey reads the audit key from a file, e.g. a mounted Secret, ignoring surrounding whitespace
+func ReadKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) < minKeySize {
+		return nil, fmt.Errorf("the audit key in %s is shorter than %d bytes", path, minKeySize)
+	}
+	return key, nil
+}
+
+// recordName returns the name of the ConfigMap holding the record with the given sequence.
+// The name is derived from the sequence so two writers can never store the same position of the chain twice
+func recordName(sequence uint64) string {
+	return fmt.Sprintf("audit-%012d", sequence)
+}
+
+// Append gets a record, links it to the last record of the chain and stores it as an immutable ConfigMap.
+// When another writer appended in the meantime the head of the chain is reloaded and the append is retried.
+// The function returns the record as it was stored
+func (s *Store) Append(ctx context.Context, record Record) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		if s.head == nil {
+			head, err := s.loadHead(ctx)
+			if err != nil {
+				return Record{}, err
+			}
+			s.head = &head
+		}
+		record.Sequence = s.head.Sequence + 1
+		record.PrevHash = s.head.Hash
+		record.Keyed = len(s.Key) > 0
+		hash, err := ComputeHash(record, s.Key)
+		if err != nil {
+			return Record{}, err
+		}
+		record.Hash = hash
+		err = s.create(ctx, record)
+		if err == nil {
+			s.head = &record
+			return record, nil
+		}
+		s.head = nil
+		if !apierrors.IsAlreadyExists(err) || attempt >= appendRetries {
+			return Record{}, err
+		}
+	}
+}
+
+// create stores a chained record as an immutable ConfigMap
+func (s *Store) create(ctx context.Context, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	immutable := true
+	configMap := corev1.ConfigMap{
+		ObjectMeta: v1api.ObjectMeta{
+			Name:      recordName(record.Sequence),
+			Namespace: s.Namespace,
+			Labels: map[string]string{
+				RecordLabel:        "true",
+				HostedClusterLabel: record.Cluster,
+				SequenceLabel:      strconv.FormatUint(record.Sequence, 10),
+			},
+		},
+		Immutable: &immutable,
+		Data:      map[string]string{RecordKey: string(data)},
+	}
+	return s.Client.Create(ctx, &configMap)
+}
+
+// loadHead returns the chained record with the highest sequence, an empty record when the chain is empty
+func (s *Store) loadHead(ctx context.Context) (Record, error) {
+	reader := s.Reader
+	if reader == nil {
+		reader = s.Client
+	}
+	records, err := ListRecords(ctx, reader, s.Namespace)
+	if err != nil {
+		return Record{}, err
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Sequence > 0 {
+			return records[i], nil
+		}
+	}
+	return Record{}, nil
+}
+
+// ListRecords returns the audit records stored in namespace sorted by sequence.
+// Records written before records were chained have no sequence and come first, ordered by time
+func ListRecords(ctx context.Context, reader client.Reader, namespace string) ([]Record, error) {
+	configMaps := corev1.ConfigMapList{}
+	if err := reader.List(ctx, &configMaps, client.InNamespace(namespace), client.MatchingLabels{RecordLabel: "true"}); err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(configMaps.Items))
+	for _, configMap := range configMaps.Items {
+		record := Record{}
+		if err := json.Unmarshal([]byte(configMap.Data[RecordKey]), &record); err != nil {
+			return nil, fmt.Errorf("invalid audit record %s: %w", configMap.GetName(), err)
+		}
+		records = append(records, record)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Sequence != records[j].Sequence {
+			return records[i].Sequence < records[j].Sequence
+		}
+		return records[i].Time.Before(records[j].Time)
+	})
+	return records, nil
+}
+
+// Problem is an inconsistency found while verifying the chain
+type Problem struct {
+	// Sequence is the position of the chain the problem is at, 0 for records outside of the chain
+	Sequence uint64 `json:"sequence"`
+	Reason   string `json:"reason"`
+}
+
+func (p Problem) String() string {
+	if p.Sequence == 0 {
+		return p.Reason
+	}
+	return fmt.Sprintf("sequence %d: %s", p.Sequence, p.Reason)
+}
+
+// Verify gets the records sorted by sequence and the audit key, nil when records are not signed, and walks the chain.
+// The function returns the missing sequences, the records whose content does not match their hash and the records that
+// do not link to the hash of the record before them. Records without a sequence predate the chain and are skipped, unless
+// they were written after the chain started, which means a chained record was rewritten to leave the chain.
+// With a key every record after the first keyed one, and the head of the chain, must be keyed, so a rewritten suffix
+// cannot fall back to unkeyed hashes. Records dropped from the end of the chain are only found by VerifyAnchors
+func Verify(records []Record, key []byte) []Problem {
+	var problems []Problem
+	var previous, firstChained *Record
+	for i := range records {
+		if records[i].Sequence > 0 {
+			firstChained = &records[i]
+			break
+		}
+	}
+	for i := range records {
+		record := records[i]
+		if record.Sequence == 0 {
+			if firstChained != nil && record.Time.After(firstChained.Time) {
+				problems = append(problems, Problem{Reason: fmt.Sprintf("record of %s at %s has no sequence but was written after the chain started",
+					record.Cluster, record.Time.Format(time.RFC3339))})
+			}
+			continue
+		}
+		expected := uint64(1)
+		if previous != nil {
+			expected = previous.Sequence + 1
+		}
+		switch {
+		case previous != nil && record.Sequence == previous.Sequence:
+			problems = append(problems, Problem{Sequence: record.Sequence, Reason: "sequence appears more than once"})
+		case record.Sequence > expected:
+			gap := fmt.Sprintf("record %d is missing", expected)
+			if record.Sequence-expected > 1 {
+				gap = fmt.Sprintf("records %d to %d are missing", expected, record.Sequence-1)
+			}
+			problems = append(problems, Problem{Sequence: expected, Reason: gap})
+		case previous != nil && record.PrevHash != previous.Hash:
+			problems = append(problems, Problem{Sequence: record.Sequence, Reason: "does not link to the hash of the previous record"})
+		case previous == nil && record.PrevHash != "":
+			problems = append(problems, Problem{Sequence: record.Sequence, Reason: "first record links to a previous record"})
+		}
+		switch hash, err := ComputeHash(record, key); {
+		case record.Keyed && len(key) == 0:
+			problems = append(problems, Problem{Sequence: record.Sequence, Reason: "signed with the audit key, verify it with the key"})
+		case !record.Keyed && previous != nil && previous.Keyed:
+			problems = append(problems, Problem{Sequence: record.Sequence, Reason: "not signed with the audit key although the records before it are"})
+		case err != nil || hash != record.Hash:
+			problems = append(problems, Problem{Sequence: record.Sequence, Reason: "content does not match its hash, the record was modified"})
+		}
+		previous = &records[i]
+	}
+	if previous != nil && !previous.Keyed && len(key) > 0 {
+		problems = append(problems, Problem{Sequence: previous.Sequence, Reason: "head of the chain is not signed with the audit key"})
+	}
+	return problems
+}
+
+// VerifyAnchors gets the records sorted by sequence and anchors, chained records kept outside the management cluster,
+// e.g. by the audit mirror file or a SIEM. The function returns a problem for every anchor the chain does not hold
+// with the same hash, which finds records dropped from the end of the chain and rewritten chains
+func VerifyAnchors(records []Record, anchors []Record) []Problem {
+	hashes := make(map[uint64]string, len(records))
+	for _, record := range records {
+		if record.Sequence > 0 {
+			hashes[record.Sequence] = record.Hash
+		}
+	}
+	var problems []Problem
+	for _, anchor := range anchors {
+		if anchor.Sequence == 0 {
+			continue
+		}
+		switch hash, ok := hashes[anchor.Sequence]; {
+		case !ok:
+			problems = append(problems, Problem{Sequence: anchor.Sequence, Reason: "anchored record is missing from the chain"})
+		case hash != anchor.Hash:
+			problems = append(problems, Problem{Sequence: anchor.Sequence, Reason: "hash differs from the anchored record"})
+		}
+	}
+	return problems
+}
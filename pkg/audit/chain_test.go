@@ -0,0 +1,224 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestStore_Append(t *testing.T) {
+	ctx := context.Background()
+	c := fake.NewClientBuilder().Build()
+	first := &Store{Client: c, Namespace: "audit"}
+	second := &Store{Client: c, Namespace: "audit"}
+	// the stores write alternately so each one has to recover from the other appending first
+	for i, store := range []*Store{first, second, first, first, second} {
+		record := Record{Time: time.Date(2022, 10, 1, 12, i, 0, 0, time.UTC), Cluster: fmt.Sprintf("cluster-%d", i), Action: ActionCreate}
+		stored, err := store.Append(ctx, record)
+		if err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+		if stored.Sequence != uint64(i+1) {
+			t.Errorf("sequence got: %d want %d", stored.Sequence, i+1)
+		}
+	}
+	records, err := ListRecords(ctx, c, "audit")
+	if err != nil {
+		t.Fatalf("ListRecords() error = %v", err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("records got: %d want 5", len(records))
+	}
+	if problems := Verify(records, nil); len(problems) != 0 {
+		t.Errorf("Verify() of an intact chain got: %v", problems)
+	}
+	configMap := corev1.ConfigMap{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "audit", Name: "audit-000000000003"}, &configMap); err != nil {
+		t.Errorf("record is not named after its sequence: %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	// keyedChain returns a chain of length records, the records from keyedFrom on are signed with key
+	keyedChain := func(length int, keyedFrom int) []Record {
+		var records []Record
+		previousHash := ""
+		for i := 1; i <= length; i++ {
+			record := Record{Sequence: uint64(i), PrevHash: previousHash, Cluster: "test", Action: ActionUpdate,
+				Time: time.Date(2022, 10, 1, 12, i, 0, 0, time.UTC), Keyed: keyedFrom > 0 && i >= keyedFrom}
+			record.Hash, _ = ComputeHash(record, key)
+			previousHash = record.Hash
+			records = append(records, record)
+		}
+		return records
+	}
+	chain := func(length int) []Record {
+		return keyedChain(length, 0)
+	}
+	modified := chain(3)
+	modified[1].Actor = "someone-else"
+	relinked := chain(3)
+	relinked[2].PrevHash = relinked[0].Hash
+	relinked[2].Hash, _ = ComputeHash(relinked[2], nil)
+	legacy := append([]Record{{Cluster: "test", Action: ActionAdopt}}, chain(2)...)
+	// a chained record rewritten without a sequence leaves the chain, its time gives it away
+	unsequenced := chain(3)
+	unsequenced[2] = Record{Cluster: "test", Action: ActionUpdate, Time: unsequenced[2].Time}
+	unsequenced = append([]Record{unsequenced[2]}, unsequenced[:2]...)
+	// without the key a rewritten suffix can only be hashed unkeyed
+	downgraded := keyedChain(3, 2)
+	downgraded[2].Keyed = false
+	downgraded[2].Actor = "someone-else"
+	downgraded[2].Hash, _ = ComputeHash(downgraded[2], nil)
+	unkeyedHead := chain(3)
+
+	tests := []struct {
+		name    string
+		records []Record
+		key     []byte
+		want    []Problem
+	}{
+		{
+			name:    "intact chain",
+			records: chain(4),
+		},
+		{
+			name:    "gap",
+			records: append(chain(4)[:1], chain(4)[3:]...),
+			want:    []Problem{{Sequence: 2, Reason: "records 2 to 3 are missing"}},
+		},
+		{
+			name:    "missing first record",
+			records: chain(3)[1:],
+			want:    []Problem{{Sequence: 1, Reason: "record 1 is missing"}},
+		},
+		{
+			name:    "modified record",
+			records: modified,
+			want: []Problem{
+				{Sequence: 2, Reason: "content does not match its hash, the record was modified"},
+			},
+		},
+		{
+			name:    "rewritten link",
+			records: relinked,
+			want:    []Problem{{Sequence: 3, Reason: "does not link to the hash of the previous record"}},
+		},
+		{
+			name:    "records before the chain are skipped",
+			records: legacy,
+		},
+		{
+			name:    "record without a sequence after the chain started",
+			records: unsequenced,
+			want:    []Problem{{Reason: "record of test at 2022-10-01T12:03:00Z has no sequence but was written after the chain started"}},
+		},
+		{
+			name:    "keyed chain",
+			records: keyedChain(3, 2),
+			key:     key,
+		},
+		{
+			name:    "keyed chain without the key",
+			records: keyedChain(2, 2),
+			want:    []Problem{{Sequence: 2, Reason: "signed with the audit key, verify it with the key"}},
+		},
+		{
+			name:    "keyed chain verified with another key",
+			records: keyedChain(2, 1),
+			key:     []byte("another key of at least 32 bytes.."),
+			want: []Problem{
+				{Sequence: 1, Reason: "content does not match its hash, the record was modified"},
+				{Sequence: 2, Reason: "content does not match its hash, the record was modified"},
+			},
+		},
+		{
+			name:    "rewritten suffix falls back to unkeyed hashes",
+			records: downgraded,
+			key:     key,
+			want: []Problem{
+				{Sequence: 3, Reason: "not signed with the audit key although the records before it are"},
+				{Sequence: 3, Reason: "head of the chain is not signed with the audit key"},
+			},
+		},
+		{
+			name:    "unkeyed head",
+			records: unkeyedHead,
+			key:     key,
+			want:    []Problem{{Sequence: 3, Reason: "head of the chain is not signed with the audit key"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.records, tt.key); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAnchors(t *testing.T) {
+	var records []Record
+	previousHash := ""
+	for i := 1; i <= 3; i++ {
+		record := Record{Sequence: uint64(i), PrevHash: previousHash, Cluster: "test", Action: ActionUpdate}
+		record.Hash, _ = ComputeHash(record, nil)
+		previousHash = record.Hash
+		records = append(records, record)
+	}
+	rewritten := append([]Record{}, records...)
+	rewritten[1].Actor = "someone-else"
+	rewritten[1].Hash, _ = ComputeHash(rewritten[1], nil)
+	tests := []struct {
+		name    string
+		records []Record
+		want    []Problem
+	}{
+		{name: "anchored chain", records: records},
+		{name: "dropped tail", records: records[:1], want: []Problem{
+			{Sequence: 2, Reason: "anchored record is missing from the chain"},
+			{Sequence: 3, Reason: "anchored record is missing from the chain"},
+		}},
+		{name: "rewritten record", records: rewritten, want: []Problem{{Sequence: 2, Reason: "hash differs from the anchored record"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyAnchors(tt.records, records); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("VerifyAnchors() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStore_AppendKeyed(t *testing.T) {
+	ctx := context.Background()
+	key := []byte("0123456789abcdef0123456789abcdef")
+	store := &Store{Client: fake.NewClientBuilder().Build(), Namespace: "audit", Key: key}
+	for i := 0; i < 2; i++ {
+		if _, err := store.Append(ctx, Record{Cluster: "test", Action: ActionCreate}); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+	records, err := ListRecords(ctx, store.Client, "audit")
+	if err != nil {
+		t.Fatalf("ListRecords() error = %v", err)
+	}
+	for _, record := range records {
+		if !record.Keyed {
+			t.Errorf("record %d is not keyed", record.Sequence)
+		}
+	}
+	if problems := Verify(records, key); len(problems) != 0 {
+		t.Errorf("Verify() with the key got: %v", problems)
+	}
+	if problems := Verify(records, nil); len(problems) == 0 {
+		t.Error("Verify() of a keyed chain without the key found no problems")
+	}
+}
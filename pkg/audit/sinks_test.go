@@ -0,0 +1,306 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// selfSignedTLS returns a server configuration with a certificate for 127.0.0.1 and a client configuration trusting it
+func selfSignedTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "syslog"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return server, &tls.Config{RootCAs: pool}
+}
+
+// readFramed reads an octet counted syslog message
+func readFramed(reader *bufio.Reader) (string, error) {
+	length, err := reader.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	size, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil {
+		return "", err
+	}
+	message := make([]byte, size)
+	_, err = io.ReadFull(reader, message)
+	return string(message), err
+}
+
+func TestSyslogSink_Write(t *testing.T) {
+	record := Record{Sequence: 7, Time: time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC), Cluster: "test", Action: ActionCreate}
+	serverTLS, clientTLS := selfSignedTLS(t)
+	tests := []struct {
+		name    string
+		network string
+	}{
+		{name: "udp", network: SyslogUDP},
+		{name: "tcp", network: SyslogTCP},
+		{name: "tls", network: SyslogTLS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := make(chan string, 2)
+			var address string
+			if tt.network == SyslogUDP {
+				conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+				address = conn.LocalAddr().String()
+				go func() {
+					buffer := make([]byte, 65536)
+					for {
+						n, _, err := conn.ReadFrom(buffer)
+						if err != nil {
+							return
+						}
+						messages <- string(buffer[:n])
+					}
+				}()
+			} else {
+				var listener net.Listener
+				var err error
+				if tt.network == SyslogTLS {
+					listener, err = tls.Listen("tcp", "127.0.0.1:0", serverTLS)
+				} else {
+					listener, err = net.Listen("tcp", "127.0.0.1:0")
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer listener.Close()
+				address = listener.Addr().String()
+				go func() {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					defer conn.Close()
+					reader := bufio.NewReader(conn)
+					for {
+						message, err := readFramed(reader)
+						if err != nil {
+							return
+						}
+						messages <- message
+					}
+				}()
+			}
+
+			sink := &SyslogSink{Network: tt.network, Address: address, TLSConfig: clientTLS, Hostname: "controller"}
+			for i := 0; i < 2; i++ {
+				if err := sink.Write(context.Background(), record); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			for i := 0; i < 2; i++ {
+				select {
+				case message := <-messages:
+					header := fmt.Sprintf("<85>1 2022-10-01T12:00:00Z controller permission-granter-controller %d audit - ", os.Getpid())
+					if !strings.HasPrefix(message, header) {
+						t.Fatalf("message %q does not start with %q", message, header)
+					}
+					received := Record{}
+					if err := json.Unmarshal([]byte(strings.TrimPrefix(message, header)), &received); err != nil {
+						t.Fatalf("message body is not a record: %v", err)
+					}
+					if !reflect.DeepEqual(received, record) {
+						t.Errorf("received %+v want %+v", received, record)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("message was not received")
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookSink_Write(t *testing.T) {
+	var received []Record
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		record := Record{}
+		_ = json.NewDecoder(r.Body).Decode(&record)
+		received = append(received, record)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	sink := &WebhookSink{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}}
+	if err := sink.Write(context.Background(), Record{Sequence: 1}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := sink.Write(context.Background(), Record{Sequence: 2}); err == nil {
+		t.Errorf("Write() expected an error when the webhook fails")
+	}
+	if len(received) != 2 || received[0].Sequence != 1 {
+		t.Errorf("received %+v", received)
+	}
+}
+
+// flakySink fails every write until it is healthy and records the sequences it accepted
+type flakySink struct {
+	mu        sync.Mutex
+	healthy   bool
+	sequences []uint64
+}
+
+func (f *flakySink) Write(_ context.Context, record Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.healthy {
+		return errors.New("unavailable")
+	}
+	f.sequences = append(f.sequences, record.Sequence)
+	return nil
+}
+
+func (f *flakySink) setHealthy(healthy bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.healthy = healthy
+}
+
+func (f *flakySink) delivered() []uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]uint64(nil), f.sequences...)
+}
+
+func waitForDelivery(t *testing.T, sink *flakySink, count int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sink.delivered()) < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("delivered %v, want %d records", sink.delivered(), count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBufferedSink(t *testing.T) {
+	t.Run("queue full without spool", func(t *testing.T) {
+		buffered := &BufferedSink{Sink: &flakySink{}, Capacity: 2, Log: logr.Discard()}
+		for i := 1; i <= 2; i++ {
+			if err := buffered.Write(context.Background(), Record{Sequence: uint64(i)}); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+		}
+		if err := buffered.Write(context.Background(), Record{Sequence: 3}); !errors.Is(err, ErrQueueFull) {
+			t.Errorf("Write() error = %v, want %v", err, ErrQueueFull)
+		}
+	})
+
+	t.Run("retries and delivers in order through the spool", func(t *testing.T) {
+		spoolDir := t.TempDir()
+		sink := &flakySink{}
+		buffered := &BufferedSink{Sink: sink, Capacity: 2, SpoolDir: spoolDir, RetryInterval: time.Millisecond,
+			MaxRetryInterval: 5 * time.Millisecond, Log: logr.Discard()}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- buffered.Start(ctx) }()
+		for i := 1; i <= 5; i++ {
+			if err := buffered.Write(ctx, Record{Sequence: uint64(i)}); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		sink.setHealthy(true)
+		waitForDelivery(t, sink, 5)
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		if got := sink.delivered(); !reflect.DeepEqual(got, []uint64{1, 2, 3, 4, 5}) {
+			t.Errorf("delivered %v", got)
+		}
+		if entries, _ := os.ReadDir(spoolDir); len(entries) != 0 {
+			t.Errorf("spool not empty after delivery: %d files", len(entries))
+		}
+	})
+
+	t.Run("spooled records survive a restart", func(t *testing.T) {
+		spoolDir := t.TempDir()
+		sink := &flakySink{}
+		buffered := &BufferedSink{Sink: sink, Capacity: 1, SpoolDir: spoolDir, RetryInterval: time.Millisecond, Log: logr.Discard()}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- buffered.Start(ctx) }()
+		for i := 1; i <= 3; i++ {
+			if err := buffered.Write(ctx, Record{Sequence: uint64(i)}); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		if entries, _ := os.ReadDir(spoolDir); len(entries) != 3 {
+			t.Fatalf("spooled files got: %d want 3", len(entries))
+		}
+
+		sink.setHealthy(true)
+		restarted := &BufferedSink{Sink: sink, Capacity: 1, SpoolDir: spoolDir, Log: logr.Discard()}
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = restarted.Start(ctx) }()
+		if err := restarted.Write(ctx, Record{Sequence: 4}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		waitForDelivery(t, sink, 4)
+		if got := sink.delivered(); !reflect.DeepEqual(got, []uint64{1, 2, 3, 4}) {
+			t.Errorf("delivered %v", got)
+		}
+	})
+}
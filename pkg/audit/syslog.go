@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Syslog networks supported by SyslogSink
+const (
+	SyslogUDP = "udp"
+	SyslogTCP = "tcp"
+	SyslogTLS = "tls"
+)
+
+const (
+	// syslogFacilityAuthPriv is the security/authorization facility of RFC 5424 audit messages are sent with
+	syslogFacilityAuthPriv = 10
+	// syslogSeverityNotice is the severity of every audit message
+	syslogSeverityNotice = 5
+	syslogAppName        = "permission-granter-controller"
+	syslogMsgID          = "audit"
+)
+
+// SyslogSink sends every record as an RFC 5424 message whose body is the JSON record.
+// TCP and TLS messages are framed by octet counting as described in RFC 5425, UDP messages are sent one per datagram.
+// The connection is kept open between writes and dialed again after an error
+type SyslogSink struct {
+	// Network is udp, tcp or tls
+	Network string
+	Address string
+	// TLSConfig is used when Network is tls
+	TLSConfig *tls.Config
+	// Hostname is the HOSTNAME field of the messages, the host name of the machine when empty
+	Hostname string
+	// Timeout bounds dialing and writing a message, 10 seconds when zero
+	Timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// Write sends the record to the syslog server
+func (s *SyslogSink) Write(ctx context.Context, record Record) error {
+	message, err := s.format(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		if s.conn, err = s.dial(ctx); err != nil {
+			return err
+		}
+	}
+	if s.Network != SyslogUDP {
+		message = append([]byte(fmt.Sprintf("%d ", len(message))), message...)
+	}
+	if err := s.conn.SetWriteDeadline(time.Now().Add(s.timeout())); err != nil {
+		return s.reset(err)
+	}
+	if _, err := s.conn.Write(message); err != nil {
+		return s.reset(err)
+	}
+	return nil
+}
+
+// format returns the RFC 5424 message of the record
+func (s *SyslogSink) format(record Record) ([]byte, error) {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	hostname := s.Hostname
+	if hostname == "" {
+		if hostname, err = os.Hostname(); err != nil || hostname == "" {
+			hostname = "-"
+		}
+	}
+	header := fmt.Sprintf("<%d>1 %s %s %s %d %s - ", syslogFacilityAuthPriv*8+syslogSeverityNotice,
+		record.Time.UTC().Format(time.RFC3339Nano), hostname, syslogAppName, os.Getpid(), syslogMsgID)
+	return append([]byte(header), body...), nil
+}
+
+func (s *SyslogSink) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: s.timeout()}
+	switch s.Network {
+	case SyslogUDP, SyslogTCP:
+		return dialer.DialContext(ctx, s.Network, s.Address)
+	case SyslogTLS:
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: s.TLSConfig}
+		return tlsDialer.DialContext(ctx, "tcp", s.Address)
+	}
+	return nil, fmt.Errorf("unknown syslog network %q, expected udp, tcp or tls", s.Network)
+}
+
+// reset closes the connection after a failed write so the next write dials again
+func (s *SyslogSink) reset(err error) error {
+	_ = s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *SyslogSink) timeout() time.Duration {
+	if s.Timeout == 0 {
+		return 10 * time.Second
+	}
+	return s.Timeout
+}
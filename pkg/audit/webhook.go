@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WebhookSink posts every record as JSON to an HTTP endpoint, any response other than 2xx fails the write
+type WebhookSink struct {
+	URL string
+	// Headers are added to every request, e.g. an Authorization header
+	Headers map[string]string
+	// Client sends the requests, a client with a 10 seconds timeout is used when nil
+	Client *http.Client
+}
+
+// Write posts the record to the webhook
+func (w *WebhookSink) Write(ctx context.Context, record Record) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range w.Headers {
+		request.Header.Set(key, value)
+	}
+	httpClient := w.Client
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("audit webhook %s returned %s", w.URL, response.Status)
+	}
+	return nil
+}
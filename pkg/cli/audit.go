@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dana-team/permission-granter-controller/pkg/audit"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Audit implements the audit subcommand, its only subcommand is verify
+func Audit(args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "verify" {
+		return errors.New("usage: audit verify [--kubeconfig path] [--namespace namespace] [--hmac-key-file path] [--anchor-file path]")
+	}
+	flags := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	kubeconfig := flags.String("kubeconfig", "", "Path to the management cluster kubeconfig file.")
+	namespace := flags.String("namespace", "permission-granter-controller-system", "The namespace audit records are written to.")
+	keyFile := flags.String("hmac-key-file", "", "File holding the key the manager signs audit records with.")
+	anchorFile := flags.String("anchor-file", "",
+		"File of audit records mirrored outside the management cluster as JSON lines, e.g. the audit mirror file. "+
+			"Every record of it must be in the chain with the same hash.")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	var key []byte
+	if *keyFile != "" {
+		var err error
+		if key, err = audit.ReadKey(*keyFile); err != nil {
+			return err
+		}
+	}
+	var anchors []audit.Record
+	if *anchorFile != "" {
+		var err error
+		if anchors, err = readAnchors(*anchorFile); err != nil {
+			return err
+		}
+	}
+	c, err := managementClient(*kubeconfig)
+	if err != nil {
+		return err
+	}
+	return VerifyAudit(context.Background(), c, *namespace, key, anchors, out)
+}
+
+// readAnchors reads the audit records of a file of JSON lines, lines that are not records are skipped
+func readAnchors(path string) ([]audit.Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var anchors []audit.Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		record := audit.Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.Sequence == 0 {
+			continue
+		}
+		anchors = append(anchors, record)
+	}
+	return anchors, scanner.Err()
+}
+
+// VerifyAudit walks the audit record chain in namespace with the audit key, nil when records are not signed, checks it
+// holds the anchored records and writes every gap or modification it finds.
+// The function returns an error when the chain is not intact
+func VerifyAudit(ctx context.Context, reader client.Reader, namespace string, key []byte, anchors []audit.Record, out io.Writer) error {
+	records, err := audit.ListRecords(ctx, reader, namespace)
+	if err != nil {
+		return err
+	}
+	problems := append(audit.Verify(records, key), audit.VerifyAnchors(records, anchors)...)
+	for _, problem := range problems {
+		fmt.Fprintln(out, problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("audit chain verification failed: %d problems in %d records", len(problems), len(records))
+	}
+	if len(records) == 0 {
+		fmt.Fprintf(out, "no audit records in namespace %s\n", namespace)
+		return nil
+	}
+	unchained := 0
+	for _, record := range records {
+		if record.Sequence == 0 {
+			unchained++
+		}
+	}
+	if unchained > 0 {
+		fmt.Fprintf(out, "%d records predate the hash chain and were not verified\n", unchained)
+	}
+	head := records[len(records)-1]
+	fmt.Fprintf(out, "verified %d records, head sequence %d hash %s\n", len(records)-unchained, head.Sequence, head.Hash)
+	if len(anchors) == 0 {
+		fmt.Fprintln(out, "no anchor given, records dropped from the end of the chain cannot be found")
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/audit"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestVerifyAudit(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, configMap *corev1.ConfigMap)
+		// dropHead deletes the last record, which only the anchors can tell
+		dropHead bool
+		anchored bool
+		wantOut  string
+		wantErr  bool
+	}{
+		{
+			name:    "intact chain",
+			wantOut: "verified 3 records, head sequence 3",
+		},
+		{
+			name: "modified record",
+			tamper: func(t *testing.T, configMap *corev1.ConfigMap) {
+				configMap.Data[audit.RecordKey] = strings.Replace(configMap.Data[audit.RecordKey], `"cluster":"cluster"`, `"cluster":"other"`, 1)
+			},
+			wantOut: "sequence 2: content does not match its hash, the record was modified",
+			wantErr: true,
+		},
+		{
+			name:    "deleted record",
+			wantOut: "sequence 2: record 2 is missing",
+			wantErr: true,
+		},
+		{
+			name:     "dropped head without anchors",
+			dropHead: true,
+			wantOut:  "no anchor given, records dropped from the end of the chain cannot be found",
+		},
+		{
+			name:     "dropped head with anchors",
+			dropHead: true,
+			anchored: true,
+			wantOut:  "sequence 3: anchored record is missing from the chain",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(managementScheme).Build()
+			store := &audit.Store{Client: c, Namespace: "audit"}
+			for i := 0; i < 3; i++ {
+				if err := store.Write(ctx, audit.Record{Time: time.Now(), Cluster: "cluster", Action: audit.ActionUpdate}); err != nil {
+					t.Fatalf("could not write record: %v", err)
+				}
+			}
+			var anchors []audit.Record
+			if tt.anchored {
+				var err error
+				if anchors, err = audit.ListRecords(ctx, c, "audit"); err != nil {
+					t.Fatalf("could not list records: %v", err)
+				}
+			}
+			name := "audit-000000000002"
+			if tt.dropHead {
+				name = "audit-000000000003"
+			}
+			configMap := &corev1.ConfigMap{}
+			if err := c.Get(ctx, types.NamespacedName{Namespace: "audit", Name: name}, configMap); err != nil {
+				t.Fatalf("could not get record: %v", err)
+			}
+			switch {
+			case tt.tamper != nil:
+				tt.tamper(t, configMap)
+				if err := c.Update(ctx, configMap); err != nil {
+					t.Fatalf("could not tamper with record: %v", err)
+				}
+			case tt.wantErr || tt.dropHead:
+				if err := c.Delete(ctx, configMap); err != nil {
+					t.Fatalf("could not delete record: %v", err)
+				}
+			}
+			out := bytes.Buffer{}
+			err := VerifyAudit(ctx, c, "audit", nil, anchors, &out)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyAudit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !strings.Contains(out.String(), tt.wantOut) {
+				t.Errorf("output got: %q want it to contain %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	userv1 "github.com/openshift/api/user/v1"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var managementScheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(managementScheme))
+	utilruntime.Must(v1alpha1.AddToScheme(managementScheme))
+	utilruntime.Must(userv1.AddToScheme(managementScheme))
+}
+
+const hcaccessUsage = `Manage access to hosted clusters.
+
+Usage:
+  kubectl hcaccess [flags] grant CLUSTER USER [--expires-in DURATION]
+  kubectl hcaccess [flags] revoke CLUSTER USER
+  kubectl hcaccess [flags] list [CLUSTER]
+  kubectl hcaccess [flags] who-has-access CLUSTER
+  kubectl hcaccess [flags] status CLUSTER
+
+Flags:
+`
+
+// HCAccessCommand holds what the hcaccess subcommands need to talk to the management cluster
+type HCAccessCommand struct {
+	Client    client.Client
+	Namespace string
+	User      string
+	Out       io.Writer
+	Now       func() time.Time
+}
+
+// HCAccess implements the kubectl-hcaccess plugin
+func HCAccess(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("kubectl-hcaccess", flag.ContinueOnError)
+	flags.SetOutput(out)
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	overrides := &clientcmd.ConfigOverrides{}
+	flags.StringVar(&loadingRules.ExplicitPath, "kubeconfig", "", "Path to the kubeconfig file.")
+	flags.StringVar(&overrides.CurrentContext, "context", "", "The kubeconfig context to use.")
+	namespace := flags.String("namespace", "clusters", "The namespace of the HostedCluster objects.")
+	flags.StringVar(namespace, "n", "clusters", "Shorthand for --namespace.")
+	flags.Usage = func() {
+		fmt.Fprint(out, hcaccessUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("a subcommand is required")
+	}
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return err
+	}
+	c, err := client.New(restConfig, client.Options{Scheme: managementScheme})
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	cmd := &HCAccessCommand{
+		Client:    c,
+		Namespace: *namespace,
+		Out:       out,
+		Now:       time.Now,
+	}
+	if flags.Arg(0) == "grant" {
+		if cmd.User, err = currentUser(ctx, c); err != nil {
+			fmt.Fprintf(out, "warning: could not get the authenticated user, the grant names no granter: %v\n", err)
+		}
+	}
+	return cmd.Run(ctx, flags.Arg(0), flags.Args()[1:])
+}
+
+// currentUser returns the user the management cluster authenticates the caller as, recorded as the granter of new grants.
+// The kubeconfig user is only a local alias, so the OpenShift user API is asked who the caller is
+func currentUser(ctx context.Context, c client.Client) (string, error) {
+	user := &userv1.User{}
+	if err := c.Get(ctx, types.NamespacedName{Name: "~"}, user); err != nil {
+		return "", err
+	}
+	return user.GetName(), nil
+}
+
+// Run executes a single hcaccess subcommand
+func (c *HCAccessCommand) Run(ctx context.Context, subcommand string, args []string) error {
+	switch subcommand {
+	case "grant":
+		flags := flag.NewFlagSet("grant", flag.ContinueOnError)
+		expiresIn := flags.Duration("expires-in", 0, "Revoke the grant automatically after this duration, never when 0.")
+		positional, err := parseInterspersed(flags, args, 2)
+		if err != nil {
+			return err
+		}
+		if *expiresIn < 0 {
+			return fmt.Errorf("--expires-in must not be negative, got %s", *expiresIn)
+		}
+		return c.Grant(ctx, positional[0], positional[1], *expiresIn)
+	case "revoke":
+		positional, err := parseInterspersed(flag.NewFlagSet("revoke", flag.ContinueOnError), args, 2)
+		if err != nil {
+			return err
+		}
+		return c.Revoke(ctx, positional[0], positional[1])
+	case "list":
+		if len(args) > 1 {
+			return fmt.Errorf("list takes at most one cluster name")
+		}
+		cluster := ""
+		if len(args) == 1 {
+			cluster = args[0]
+		}
+		return c.List(ctx, cluster)
+	case "who-has-access":
+		positional, err := parseInterspersed(flag.NewFlagSet("who-has-access", flag.ContinueOnError), args, 1)
+		if err != nil {
+			return err
+		}
+		return c.WhoHasAccess(ctx, positional[0])
+	case "status":
+		positional, err := parseInterspersed(flag.NewFlagSet("status", flag.ContinueOnError), args, 1)
+		if err != nil {
+			return err
+		}
+		return c.Status(ctx, positional[0])
+	}
+	return fmt.Errorf("unknown subcommand %q", subcommand)
+}
+
+// parseInterspersed parses flags that may appear before, between or after the positional arguments
+// and returns exactly count positional arguments
+func parseInterspersed(flags *flag.FlagSet, args []string, count int) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(positional) != count {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", flags.Name(), count, len(positional))
+	}
+	return positional, nil
+}
+
+// updateGrants gets a HostedCluster name and a function changing its grants and updates the HostedCluster, retrying on conflicts.
+// Nothing is updated when the function returns an error
+func (c *HCAccessCommand) updateGrants(ctx context.Context, cluster string, mutate func(*v1alpha1.HostedCluster, []access.Grant) ([]access.Grant, error)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		hostedCluster := &v1alpha1.HostedCluster{}
+		if err := c.Client.Get(ctx, types.NamespacedName{Namespace: c.Namespace, Name: cluster}, hostedCluster); err != nil {
+			return err
+		}
+		grants, err := access.GetGrants(hostedCluster)
+		if err != nil {
+			return err
+		}
+		grants, err = mutate(hostedCluster, grants)
+		if err != nil {
+			return err
+		}
+		if err := access.SetGrants(hostedCluster, grants); err != nil {
+			return err
+		}
+		return c.Client.Update(ctx, hostedCluster)
+	})
+}
+
+// Grant gives user access to the hosted cluster, replacing any grant the user already has
+func (c *HCAccessCommand) Grant(ctx context.Context, cluster string, user string, expiresIn time.Duration) error {
+	now := c.Now().UTC().Truncate(time.Second)
+	grant := access.Grant{User: user, GrantedBy: c.User, GrantedAt: v1api.NewTime(now)}
+	if expiresIn > 0 {
+		expiresAt := v1api.NewTime(now.Add(expiresIn))
+		grant.ExpiresAt = &expiresAt
+	}
+	if err := c.updateGrants(ctx, cluster, func(_ *v1alpha1.HostedCluster, grants []access.Grant) ([]access.Grant, error) {
+		return access.AddGrant(grants, grant), nil
+	}); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "granted %s access to %s\n", user, cluster)
+	return nil
+}
+
+// Revoke removes the grants given to user on the hosted cluster
+// The requester of the hosted cluster is refused, the grants cannot take away the access the requester annotation gives
+func (c *HCAccessCommand) Revoke(ctx context.Context, cluster string, user string) error {
+	found := false
+	if err := c.updateGrants(ctx, cluster, func(hostedCluster *v1alpha1.HostedCluster, grants []access.Grant) ([]access.Grant, error) {
+		if access.GetRequester(hostedCluster) == user {
+			return nil, fmt.Errorf("%s has access to %s as the requester in the %s annotation, which revoke does not change",
+				user, cluster, access.RequesterAnnotation)
+		}
+		remaining := access.RemoveGrant(grants, user)
+		found = len(remaining) != len(grants)
+		return remaining, nil
+	}); err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s has no grant on %s", user, cluster)
+	}
+	fmt.Fprintf(c.Out, "revoked %s access to %s\n", user, cluster)
+	return nil
+}
+
+// List prints the grants of every hosted cluster in the namespace, or of a single hosted cluster
+func (c *HCAccessCommand) List(ctx context.Context, cluster string) error {
+	var hostedClusters []v1alpha1.HostedCluster
+	if cluster != "" {
+		hostedCluster := v1alpha1.HostedCluster{}
+		if err := c.Client.Get(ctx, types.NamespacedName{Namespace: c.Namespace, Name: cluster}, &hostedCluster); err != nil {
+			return err
+		}
+		hostedClusters = append(hostedClusters, hostedCluster)
+	} else {
+		hostedClusterList := v1alpha1.HostedClusterList{}
+		if err := c.Client.List(ctx, &hostedClusterList, client.InNamespace(c.Namespace)); err != nil {
+			return err
+		}
+		hostedClusters = hostedClusterList.Items
+	}
+
+	writer := tabwriter.NewWriter(c.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "CLUSTER\tUSER\tGRANTED BY\tGRANTED AT\tEXPIRES AT\tACTIVE")
+	for i := range hostedClusters {
+		grants, err := access.GetGrants(&hostedClusters[i])
+		if err != nil {
+			return fmt.Errorf("%s: %w", hostedClusters[i].GetName(), err)
+		}
+		for _, grant := range grants {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%t\n", hostedClusters[i].GetName(), grant.User, orNone(grant.GrantedBy),
+				grant.GrantedAt.Format(time.RFC3339), formatExpiry(grant.ExpiresAt), grant.Active(c.Now()))
+		}
+	}
+	return writer.Flush()
+}
+
+// WhoHasAccess prints every user with access to the hosted cluster, where the access comes from
+// and whether the controller reported the user as a member of the group
+func (c *HCAccessCommand) WhoHasAccess(ctx context.Context, cluster string) error {
+	hostedCluster := &v1alpha1.HostedCluster{}
+	if err := c.Client.Get(ctx, types.NamespacedName{Namespace: c.Namespace, Name: cluster}, hostedCluster); err != nil {
+		return err
+	}
+	status, err := access.GetStatus(hostedCluster)
+	if err != nil {
+		return err
+	}
+	applied := make(map[string]bool)
+	if status != nil {
+		for _, user := range status.Users {
+			applied[user] = true
+		}
+	}
+
+	writer := tabwriter.NewWriter(c.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "USER\tSOURCE\tEXPIRES AT\tAPPLIED")
+	if requester := access.GetRequester(hostedCluster); requester != "" {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%t\n", requester, access.SourceAnnotation, formatExpiry(nil), applied[requester])
+	}
+	grants, err := access.GetGrants(hostedCluster)
+	if err != nil {
+		return err
+	}
+	for _, grant := range grants {
+		if grant.Active(c.Now()) {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%t\n", grant.User, access.SourceGrant, formatExpiry(grant.ExpiresAt), applied[grant.User])
+		}
+	}
+	if clusterAdmin, ok := hostedCluster.GetAnnotations()[access.ClusterAdminAnnotation]; ok {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%t\n", clusterAdmin, access.SourceBreakGlass, formatExpiry(nil), true)
+	}
+	return writer.Flush()
+}
+
+// Status prints the access status the controller reported on the hosted cluster
+func (c *HCAccessCommand) Status(ctx context.Context, cluster string) error {
+	hostedCluster := &v1alpha1.HostedCluster{}
+	if err := c.Client.Get(ctx, types.NamespacedName{Namespace: c.Namespace, Name: cluster}, hostedCluster); err != nil {
+		return err
+	}
+	status, err := access.GetStatus(hostedCluster)
+	if err != nil {
+		return err
+	}
+	if status == nil {
+		fmt.Fprintf(c.Out, "the controller has not reported a status for %s\n", cluster)
+		return nil
+	}
+	writer := tabwriter.NewWriter(c.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "Group:\t%s\n", orNone(status.Group))
+	fmt.Fprintf(writer, "RBACDefinition:\t%s\n", orNone(status.RBACDefinition))
+	fmt.Fprintf(writer, "Profile:\t%s\n", orNone(status.Profile))
+	fmt.Fprintf(writer, "Users:\t%s\n", orNone(strings.Join(status.Users, ", ")))
+	fmt.Fprintf(writer, "Last error:\t%s\n", orNone(status.LastError))
+	fmt.Fprintf(writer, "Updated at:\t%s\n", status.UpdatedAt.Format(time.RFC3339))
+	return writer.Flush()
+}
+
+func formatExpiry(expiresAt *v1api.Time) string {
+	if expiresAt == nil {
+		return "never"
+	}
+	return expiresAt.Format(time.RFC3339)
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
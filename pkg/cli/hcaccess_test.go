@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	userv1 "github.com/openshift/api/user/v1"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHCAccessCommand_Run(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	hostedCluster := GetHostedClusterObject("test")
+	hostedCluster.SetNamespace("clusters")
+	hostedCluster.SetAnnotations(map[string]string{
+		access.RequesterAnnotation: "requester",
+		access.StatusAnnotation:    `{"group":"custom-cluster-admin","users":["requester"]}`,
+	})
+	c := &HCAccessCommand{
+		Client:    fake.NewClientBuilder().WithScheme(managementScheme).WithObjects(hostedCluster).Build(),
+		Namespace: "clusters",
+		User:      "admin",
+		Now:       func() time.Time { return now },
+	}
+	tests := []struct {
+		name       string
+		subcommand string
+		args       []string
+		wantOut    []string
+		wantUsers  []string
+		wantErr    bool
+		// wantErrOut is part of the error when set
+		wantErrOut string
+	}{
+		{
+			name:       "grant",
+			subcommand: "grant",
+			args:       []string{"test", "alice", "--expires-in", "1h"},
+			wantOut:    []string{"granted alice access to test"},
+			wantUsers:  []string{"alice", "requester"},
+		},
+		{
+			name:       "grant again",
+			subcommand: "grant",
+			args:       []string{"--expires-in=2h", "test", "bob"},
+			wantUsers:  []string{"alice", "bob", "requester"},
+		},
+		{
+			name:       "list",
+			subcommand: "list",
+			wantOut:    []string{"alice", "2022-10-01T13:00:00Z", "bob", "admin"},
+			wantUsers:  []string{"alice", "bob", "requester"},
+		},
+		{
+			name:       "who has access",
+			subcommand: "who-has-access",
+			args:       []string{"test"},
+			wantOut:    []string{"requester  annotation", "alice      grant"},
+			wantUsers:  []string{"alice", "bob", "requester"},
+		},
+		{
+			name:       "revoke",
+			subcommand: "revoke",
+			args:       []string{"test", "alice"},
+			wantUsers:  []string{"bob", "requester"},
+		},
+		{
+			name:       "revoke missing grant",
+			subcommand: "revoke",
+			args:       []string{"test", "alice"},
+			wantUsers:  []string{"bob", "requester"},
+			wantErr:    true,
+		},
+		{
+			name:       "grant requester",
+			subcommand: "grant",
+			args:       []string{"test", "requester"},
+			wantUsers:  []string{"bob", "requester"},
+		},
+		{
+			name:       "revoke requester",
+			subcommand: "revoke",
+			args:       []string{"test", "requester"},
+			wantUsers:  []string{"bob", "requester"},
+			wantErr:    true,
+			wantErrOut: "requester in the dana.io/requester annotation",
+		},
+		{
+			name:       "revoke keeps the grant of the requester",
+			subcommand: "list",
+			args:       []string{"test"},
+			wantOut:    []string{"requester", "admin"},
+			wantUsers:  []string{"bob", "requester"},
+		},
+		{
+			name:       "status",
+			subcommand: "status",
+			args:       []string{"test"},
+			wantOut:    []string{"custom-cluster-admin"},
+			wantUsers:  []string{"bob", "requester"},
+		},
+		{
+			name:       "negative expiry",
+			subcommand: "grant",
+			args:       []string{"test", "carol", "--expires-in", "-1h"},
+			wantUsers:  []string{"bob", "requester"},
+			wantErr:    true,
+		},
+		{
+			name:       "missing arguments",
+			subcommand: "grant",
+			args:       []string{"test"},
+			wantUsers:  []string{"bob", "requester"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			c.Out = &out
+			err := c.Run(context.Background(), tt.subcommand, tt.args)
+			if (err != nil) != tt.wantErr || (err != nil && !strings.Contains(err.Error(), tt.wantErrOut)) {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("Run() output does not contain %q:\n%s", want, out.String())
+				}
+			}
+			got := &v1alpha1.HostedCluster{}
+			if err := c.Client.Get(context.Background(), types.NamespacedName{Namespace: "clusters", Name: "test"}, got); err != nil {
+				t.Fatal(err)
+			}
+			users, _, err := access.Subjects(got, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(users, ",") != strings.Join(tt.wantUsers, ",") {
+				t.Errorf("users got %v want %v", users, tt.wantUsers)
+			}
+		})
+	}
+}
+
+func TestCurrentUser(t *testing.T) {
+	// the user API answers ~ with the user the request was authenticated as
+	c := fake.NewClientBuilder().WithScheme(managementScheme).WithObjects(&userv1.User{ObjectMeta: v1api.ObjectMeta{Name: "~"}}).Build()
+	if _, err := currentUser(context.Background(), c); err != nil {
+		t.Errorf("currentUser() error = %v", err)
+	}
+	if _, err := currentUser(context.Background(), fake.NewClientBuilder().WithScheme(managementScheme).Build()); err == nil {
+		t.Errorf("currentUser() without the user API returned no error")
+	}
+}
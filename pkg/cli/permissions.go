@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dana-team/permission-granter-controller/pkg/controllers"
+	"github.com/dana-team/permission-granter-controller/pkg/permissions"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+const permissionsUsage = "usage: permissions diff [--profile path] [--hostedcluster path] (--kubeconfig path | --discovery-file path) [--format table|json]\n" +
+	"       permissions snapshot [--kubeconfig path] [--output path]"
+
+// Permissions implements the permissions subcommand, its subcommands are diff and snapshot
+func Permissions(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(permissionsUsage)
+	}
+	switch args[0] {
+	case "diff":
+		return permissionsDiff(args[1:], out)
+	case "snapshot":
+		return permissionsSnapshot(args[1:], out)
+	}
+	return errors.New(permissionsUsage)
+}
+
+// permissionsDiff expands a role profile against the discovery data and roles of a hosted cluster, read live or from
+// a snapshot, and writes what the profile cannot do compared to cluster-admin
+func permissionsDiff(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("permissions diff", flag.ContinueOnError)
+	profilePath := flags.String("profile", "", "Path to a role profile, the default profile is used when empty.")
+	hostedClusterPath := flags.String("hostedcluster", "", "Path to the HostedCluster manifest a templated role profile is rendered for.")
+	kubeconfig := flags.String("kubeconfig", "", "Path to the hosted cluster kubeconfig file.")
+	discoveryFile := flags.String("discovery-file", "", "Path to a snapshot saved by permissions snapshot, used instead of the hosted cluster.")
+	format := flags.String("format", "table", "Output format, table or json.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown format %q, expected table or json", *format)
+	}
+	if (*kubeconfig == "") == (*discoveryFile == "") {
+		return errors.New("exactly one of --kubeconfig and --discovery-file must be set")
+	}
+
+	profile := &profiles.DefaultRoleProfile
+	var err error
+	if *profilePath != "" {
+		if profile, err = profiles.LoadFile(*profilePath); err != nil {
+			return err
+		}
+	}
+	if profile.Templated() {
+		if *hostedClusterPath == "" {
+			return fmt.Errorf("profile %s is templated, --hostedcluster is required", profile.Name)
+		}
+		hostedCluster, err := readHostedCluster(*hostedClusterPath)
+		if err != nil {
+			return err
+		}
+		if profile, err = controllers.RenderProfile(hostedCluster, profile); err != nil {
+			return err
+		}
+	}
+	var snapshot *permissions.Snapshot
+	if *discoveryFile != "" {
+		snapshot, err = permissions.LoadSnapshot(*discoveryFile)
+	} else {
+		snapshot, err = fetchSnapshot(*kubeconfig)
+	}
+	if err != nil {
+		return err
+	}
+	diff, err := permissions.Compare(profile, snapshot)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		return diff.WriteJSON(out)
+	}
+	return diff.WriteTable(out)
+}
+
+// permissionsSnapshot saves the discovery data and roles of a hosted cluster for permissions diff to run offline
+func permissionsSnapshot(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("permissions snapshot", flag.ContinueOnError)
+	kubeconfig := flags.String("kubeconfig", "", "Path to the hosted cluster kubeconfig file.")
+	outputPath := flags.String("output", "", "Write the snapshot to this file instead of stdout.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	snapshot, err := fetchSnapshot(*kubeconfig)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if *outputPath != "" {
+		return os.WriteFile(*outputPath, data, 0o600)
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// fetchSnapshot reads the snapshot of the hosted cluster the kubeconfig at path points at
+func fetchSnapshot(kubeconfig string) (*permissions.Snapshot, error) {
+	restConfig, err := loadRestConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return permissions.Fetch(context.Background(), clientset)
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dana-team/permission-granter-controller/pkg/permissions"
+)
+
+func TestPermissionsDiff(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "snapshot.yaml")
+	profilePath := filepath.Join(dir, "profile.yaml")
+	snapshot := `
+resources:
+- groupVersion: v1
+  resources:
+  - name: configmaps
+    namespaced: true
+    kind: ConfigMap
+    singularName: configmap
+    verbs: [get, list, create]
+  - name: nodes
+    namespaced: false
+    kind: Node
+    singularName: node
+    verbs: [get, list]
+clusterRoles:
+- metadata:
+    name: edit
+  rules:
+  - apiGroups: [""]
+    resources: [configmaps]
+    verbs: ["*"]
+`
+	profile := `
+name: developers
+roleBindings:
+- namespace: apps
+  clusterRole: edit
+`
+	if err := os.WriteFile(snapshotPath, []byte(snapshot), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(profilePath, []byte(profile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := Permissions([]string{"diff", "--profile", profilePath, "--discovery-file", snapshotPath}, &out); err != nil {
+		t.Fatalf("Permissions() error = %v", err)
+	}
+	for _, want := range []string{"RESOURCE", "configmaps", "get,list,create in apps", "nodes", "get,list", "on 2 of 2 resources"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Permissions() output does not contain %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := Permissions([]string{"diff", "--profile", profilePath, "--discovery-file", snapshotPath, "--format", "json"}, &out); err != nil {
+		t.Fatalf("Permissions() json error = %v", err)
+	}
+	diff := permissions.Diff{}
+	if err := json.Unmarshal(out.Bytes(), &diff); err != nil {
+		t.Fatalf("Permissions() wrote invalid json: %v\n%s", err, out.String())
+	}
+	if diff.Profile != "developers" || diff.Resources != 2 || len(diff.Entries) != 3 {
+		t.Errorf("Permissions() json = %+v, want 3 entries for 2 resources of developers", diff)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"unknown"},
+		{"diff", "--profile", profilePath},
+		{"diff", "--discovery-file", snapshotPath, "--kubeconfig", "kubeconfig"},
+		{"diff", "--discovery-file", snapshotPath, "--format", "csv"},
+	} {
+		if err := Permissions(args, &out); err == nil {
+			t.Errorf("Permissions(%v) expected an error", args)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dana-team/permission-granter-controller/pkg/controllers"
+	"github.com/dana-team/permission-granter-controller/pkg/policy"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+// Render implements the render subcommand
+// The command reads a HostedCluster manifest and a role profile and prints the manifests the controller
+// would apply at the hosted cluster as a multi-document YAML stream, preceded by comments naming the steps of the
+// reconcile that need a cluster and were not rendered
+func Render(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	hostedClusterPath := flags.String("hostedcluster", "", "Path to a HostedCluster manifest.")
+	profilePath := flags.String("profile", "", "Path to a role profile, the default profile is used when empty.")
+	nameTemplates := controllers.DefaultNameTemplates
+	flags.StringVar(&nameTemplates.Group, "group-name-template", nameTemplates.Group,
+		"Go template for the name of the custom cluster admin group.")
+	flags.StringVar(&nameTemplates.RBACDefinition, "rbac-definition-name-template", nameTemplates.RBACDefinition,
+		"Go template for the name of the RBACDefinition.")
+	propagateLabels := flags.String("propagate-labels", "", "Comma separated HostedCluster label keys copied onto the group and namespaces.")
+	propagateAnnotations := flags.String("propagate-annotations", "",
+		"Comma separated HostedCluster annotation keys copied onto the group and namespaces.")
+	protectedNamespaces := flags.String("protected-namespaces", strings.Join(policy.DefaultProtectedNamespaces, ","),
+		"Comma separated patterns of namespaces the role profile must not give access to.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *hostedClusterPath == "" {
+		return fmt.Errorf("--hostedcluster is required")
+	}
+
+	hostedCluster, err := readHostedCluster(*hostedClusterPath)
+	if err != nil {
+		return err
+	}
+	profile := &profiles.DefaultRoleProfile
+	if *profilePath != "" {
+		if profile, err = profiles.LoadFile(*profilePath); err != nil {
+			return err
+		}
+	}
+	protected := policy.ProtectedNamespaces(splitList(*protectedNamespaces))
+	if err := protected.Validate(); err != nil {
+		return err
+	}
+	propagation := controllers.Propagation{Labels: splitList(*propagateLabels), Annotations: splitList(*propagateAnnotations)}
+	if err := propagation.Validate(); err != nil {
+		return err
+	}
+	objects, notes, err := controllers.RenderGuestObjects(hostedCluster, profile, nameTemplates, propagation, protected)
+	if err != nil {
+		return err
+	}
+	// the notes are YAML comments so the output can still be applied or diffed as it is
+	for _, note := range notes {
+		if _, err := fmt.Fprintf(out, "# not rendered: %s\n", note); err != nil {
+			return err
+		}
+	}
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readHostedCluster reads a HostedCluster manifest in YAML or JSON from path
+func readHostedCluster(path string) (*v1alpha1.HostedCluster, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	hostedCluster := &v1alpha1.HostedCluster{}
+	if err := yaml.Unmarshal(data, hostedCluster); err != nil {
+		return nil, err
+	}
+	return hostedCluster, nil
+}
+
+// splitList returns the non empty items of a comma separated list
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
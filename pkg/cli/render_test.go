@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	hostedClusterPath := filepath.Join(dir, "hostedcluster.yaml")
+	profilePath := filepath.Join(dir, "profile.yaml")
+	hostedCluster := `
+apiVersion: hypershift.openshift.io/v1alpha1
+kind: HostedCluster
+metadata:
+  name: test
+  namespace: clusters
+  labels:
+    cost-center: payments
+  annotations:
+    dana.io/requester: user-test
+`
+	profile := `
+name: developers
+roleBindings:
+- namespace: apps
+  clusterRole: edit
+namespaceRoleBindings:
+- clusterRole: view
+  namespacePattern: team-*
+`
+	if err := os.WriteFile(hostedClusterPath, []byte(hostedCluster), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(profilePath, []byte(profile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := Render([]string{"--hostedcluster", hostedClusterPath, "--profile", profilePath, "--propagate-labels", "cost-center"}, &out); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	for _, want := range []string{"kind: Group", "- user-test", "kind: RBACDefinition", "namespace: apps", "app.kubernetes.io/managed-by: permission-granter-controller",
+		"cost-center: payments", "# not rendered: unresolved namespace role binding: view in the namespaces named team-*", "ProfilePolicies"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Render() output does not contain %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "kind: ClusterRoleBinding") {
+		t.Errorf("Render() rendered a cluster-admin binding that was not requested:\n%s", out.String())
+	}
+
+	protectedProfilePath := filepath.Join(dir, "protected.yaml")
+	protectedProfile := "name: developers\nroleBindings:\n- namespace: openshift-monitoring\n  clusterRole: edit\n"
+	if err := os.WriteFile(protectedProfilePath, []byte(protectedProfile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Render([]string{"--hostedcluster", hostedClusterPath, "--profile", protectedProfilePath}, &out); err == nil {
+		t.Errorf("Render() expected an error for a role binding into a protected namespace")
+	}
+	out.Reset()
+	if err := Render([]string{"--hostedcluster", hostedClusterPath, "--profile", protectedProfilePath, "--protected-namespaces", ""}, &out); err != nil {
+		t.Errorf("Render() without protected namespaces error = %v", err)
+	}
+
+	escalatingProfilePath := filepath.Join(dir, "escalating.yaml")
+	escalatingProfile := "name: developers\nclusterRoles:\n- name: everything\n  rules:\n  - apiGroups: ['*']\n    resources: ['*']\n    verbs: ['*']\n" +
+		"clusterRoleBindings:\n- clusterRole: everything\n"
+	if err := os.WriteFile(escalatingProfilePath, []byte(escalatingProfile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Render([]string{"--hostedcluster", hostedClusterPath, "--profile", escalatingProfilePath}, &out); err == nil {
+		t.Errorf("Render() expected an error for a profile amounting to cluster-admin")
+	}
+}
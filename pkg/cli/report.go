@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/report"
+	"github.com/dana-team/permission-granter-controller/pkg/utils"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Report implements the report subcommand
+// The command walks every HostedCluster of the management cluster and writes who has access to which hosted cluster
+func Report(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	kubeconfig := flags.String("kubeconfig", "", "Path to the management cluster kubeconfig file.")
+	namespace := flags.String("namespace", "", "Only report HostedClusters in this namespace, all namespaces when empty.")
+	format := flags.String("format", "json", "Output format, json or csv.")
+	outputPath := flags.String("output", "", "Write the report to this file instead of stdout.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("unknown format %q, expected json or csv", *format)
+	}
+
+	c, err := managementClient(*kubeconfig)
+	if err != nil {
+		return err
+	}
+	guestClient := func(hostedCluster *v1alpha1.HostedCluster) (client.Client, error) {
+		return utils.GetHostedClient(c, hostedCluster.GetName())
+	}
+	fleetReport, err := report.Generate(context.Background(), c, guestClient, *namespace, time.Now())
+	if err != nil {
+		return err
+	}
+	return writeReport(fleetReport, *format, *outputPath, out)
+}
+
+// writeReport gets the report, its format, the file to write it to and the writer used when the path is empty
+// The function writes the report, an error closing the file fails it since the report may be truncated
+func writeReport(fleetReport *report.Report, format string, outputPath string, out io.Writer) (err error) {
+	if outputPath != "" {
+		file, createErr := os.Create(outputPath)
+		if createErr != nil {
+			return createErr
+		}
+		defer func() {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		out = file
+	}
+	if format == "csv" {
+		return fleetReport.WriteCSV(out)
+	}
+	return fleetReport.WriteJSON(out)
+}
+
+// managementClient returns a client for the management cluster using the kubeconfig at path,
+// or the default loading rules when path is empty
+func managementClient(kubeconfig string) (client.Client, error) {
+	restConfig, err := loadRestConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return client.New(restConfig, client.Options{Scheme: managementScheme})
+}
+
+// loadRestConfig returns the rest config of the kubeconfig at path, or of the default loading rules when path is empty
+func loadRestConfig(kubeconfig string) (*rest.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).ClientConfig()
+}
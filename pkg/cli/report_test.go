@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dana-team/permission-granter-controller/pkg/report"
+)
+
+func TestWriteReport(t *testing.T) {
+	fleetReport := &report.Report{Entries: []report.Entry{{Namespace: "clusters", Cluster: "test", Subject: "alice", Role: "custom-cluster-admin", Source: "grant"}}}
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		format  string
+		path    string
+		wantOut string
+		wantErr bool
+	}{
+		{name: "json to stdout", format: "json", wantOut: `"subject": "alice"`},
+		{name: "csv to a file", format: "csv", path: filepath.Join(dir, "report.csv"), wantOut: "clusters,test,alice,custom-cluster-admin,grant"},
+		{name: "missing directory", format: "json", path: filepath.Join(dir, "missing", "report.json"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := bytes.Buffer{}
+			err := writeReport(fleetReport, tt.format, tt.path, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("writeReport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := out.String()
+			if tt.path != "" {
+				content, err := os.ReadFile(tt.path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = string(content)
+			}
+			if !strings.Contains(got, tt.wantOut) {
+				t.Errorf("report got: %s want it to contain %s", got, tt.wantOut)
+			}
+		})
+	}
+	if _, err := os.Stat("/dev/full"); err == nil {
+		if err := writeReport(fleetReport, "json", "/dev/full", nil); err == nil {
+			t.Errorf("writeReport() to a full device error = nil, want an error")
+		}
+	}
+}
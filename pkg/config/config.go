@@ -0,0 +1,278 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/audit"
+	"github.com/dana-team/permission-granter-controller/pkg/controllers"
+	"github.com/dana-team/permission-granter-controller/pkg/policy"
+	"github.com/dana-team/permission-granter-controller/pkg/server"
+	"go.uber.org/zap/zapcore"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// The version of the configuration file, files of other versions are rejected
+const (
+	APIVersion = "config.permissions.dana.io/v1alpha1"
+	Kind       = "ControllerConfiguration"
+)
+
+// Configuration is the configuration file of the manager, loaded with --config.
+// Flags set on the command line take precedence over the file
+type Configuration struct {
+	APIVersion     string         `json:"apiVersion"`
+	Kind           string         `json:"kind"`
+	Manager        Manager        `json:"manager"`
+	Logging        Logging        `json:"logging"`
+	Reconciler     Reconciler     `json:"reconciler"`
+	HostedClusters HostedClusters `json:"hostedClusters"`
+	Profiles       Profiles       `json:"profiles"`
+	Audit          Audit          `json:"audit"`
+	Notify         Notify         `json:"notify"`
+	API            API            `json:"api"`
+}
+
+// Manager configures the controller manager
+type Manager struct {
+	MetricsBindAddress     string         `json:"metricsBindAddress"`
+	HealthProbeBindAddress string         `json:"healthProbeBindAddress"`
+	WebhookPort            int            `json:"webhookPort"`
+	LeaderElection         LeaderElection `json:"leaderElection"`
+	// SyncPeriod is how often every watched object is reconciled again, the controller-runtime default is used when zero
+	SyncPeriod v1api.Duration `json:"syncPeriod"`
+}
+
+// LeaderElection configures the leader election of the manager replicas
+type LeaderElection struct {
+	Enabled      bool   `json:"enabled"`
+	ResourceName string `json:"resourceName"`
+}
+
+// Logging configures the log of the manager
+type Logging struct {
+	// Level is the lowest level logged: debug, info, warn or error
+	Level string `json:"level"`
+}
+
+// Reconciler configures the HostedCluster reconciler
+type Reconciler struct {
+	MaxConcurrentReconciles int `json:"maxConcurrentReconciles"`
+	// VerificationRetryInterval is how often access that did not pass verification is checked again, and failed notifications sent again
+	VerificationRetryInterval  v1api.Duration `json:"verificationRetryInterval"`
+	DryRun                     bool           `json:"dryRun"`
+	GroupNameTemplate          string         `json:"groupNameTemplate"`
+	RBACDefinitionNameTemplate string         `json:"rbacDefinitionNameTemplate"`
+	OwnerNamespace             string         `json:"ownerNamespace"`
+	PropagateLabels            []string       `json:"propagateLabels"`
+	PropagateAnnotations       []string       `json:"propagateAnnotations"`
+	ProtectedNamespaces        []string       `json:"protectedNamespaces"`
+	ConsoleURLTemplate         string         `json:"consoleURLTemplate"`
+}
+
+// HostedClusters configures how the hosted clusters are reached
+type HostedClusters struct {
+	// KubeconfigSecretName is the secret in the namespace of every hosted cluster holding its kubeconfig
+	KubeconfigSecretName string `json:"kubeconfigSecretName"`
+	KubeconfigSecretKey  string `json:"kubeconfigSecretKey"`
+}
+
+// Profiles configures where role profiles are loaded from and how they are selected
+type Profiles struct {
+	// Profile is the path of the profile given when no ProfilePolicy selects another, the default profile when empty
+	Profile            string `json:"profile"`
+	Directory          string `json:"directory"`
+	ConfigMap          string `json:"configMap"`
+	ConfigMapNamespace string `json:"configMapNamespace"`
+	// Policies enables ProfilePolicies and ProfileRollouts, it is off by default since their CRDs must be installed
+	Policies bool `json:"policies"`
+}
+
+// Audit configures the audit trail and its backends
+type Audit struct {
+	Namespace string `json:"namespace"`
+	// HMACKeyFile holds the key the hashes of the audit records are signed with, they are plain SHA-256 when empty
+	HMACKeyFile string      `json:"hmacKeyFile"`
+	MirrorFile  string      `json:"mirrorFile"`
+	Syslog      AuditSyslog `json:"syslog"`
+	WebhookURL  string      `json:"webhookURL"`
+	QueueSize   int         `json:"queueSize"`
+	SpoolDir    string      `json:"spoolDir"`
+}
+
+// AuditSyslog configures the syslog backend of the audit trail, it is disabled when the address is empty
+type AuditSyslog struct {
+	Address string `json:"address"`
+	Network string `json:"network"`
+	CAFile  string `json:"caFile"`
+}
+
+// Notify configures the notification backends, the SMTP password is read from NOTIFY_SMTP_PASSWORD
+type Notify struct {
+	SMTP            NotifySMTP `json:"smtp"`
+	EmailDomain     string     `json:"emailDomain"`
+	WebhookURL      string     `json:"webhookURL"`
+	SubjectTemplate string     `json:"subjectTemplate"`
+	BodyTemplate    string     `json:"bodyTemplate"`
+}
+
+// NotifySMTP configures the email backend, it is disabled when the address is empty
+type NotifySMTP struct {
+	Address  string `json:"address"`
+	From     string `json:"from"`
+	Username string `json:"username"`
+}
+
+// API configures the read-only cluster state API, it is disabled when the address is "0".
+// It is served with TLS unless it binds to a loopback address
+type API struct {
+	BindAddress string `json:"bindAddress"`
+	TLSCertFile string `json:"tlsCertFile"`
+	TLSKeyFile  string `json:"tlsKeyFile"`
+}
+
+// Default returns the configuration the manager runs with when no configuration file is given
+func Default() Configuration {
+	return Configuration{
+		APIVersion: APIVersion,
+		Kind:       Kind,
+		Manager: Manager{
+			MetricsBindAddress:     ":8080",
+			HealthProbeBindAddress: ":8081",
+			WebhookPort:            9443,
+			LeaderElection:         LeaderElection{ResourceName: "59d79847.dana.io"},
+		},
+		Logging: Logging{Level: "debug"},
+		Reconciler: Reconciler{
+			MaxConcurrentReconciles:    10,
+			VerificationRetryInterval:  v1api.Duration{Duration: 30 * time.Second},
+			GroupNameTemplate:          controllers.DefaultNameTemplates.Group,
+			RBACDefinitionNameTemplate: controllers.DefaultNameTemplates.RBACDefinition,
+			OwnerNamespace:             "kube-public",
+			ProtectedNamespaces:        append([]string{}, policy.DefaultProtectedNamespaces...),
+			ConsoleURLTemplate:         controllers.DefaultConsoleURLTemplate,
+		},
+		HostedClusters: HostedClusters{KubeconfigSecretName: "admin-kubeconfig", KubeconfigSecretKey: "kubeconfig"},
+		Profiles:       Profiles{ConfigMapNamespace: os.Getenv("POD_NAMESPACE")},
+		Audit: Audit{
+			Namespace: "permission-granter-controller-system",
+			Syslog:    AuditSyslog{Network: audit.SyslogTCP},
+			QueueSize: 1000,
+		},
+		Notify: Notify{SMTP: NotifySMTP{From: "permission-granter-controller@localhost"}},
+		API:    API{BindAddress: "0"},
+	}
+}
+
+// Load reads the configuration file at path, the fields it leaves out keep their default.
+// Unknown fields and other versions of the file are rejected, and the configuration is validated
+func Load(path string) (Configuration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Configuration{}, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes a configuration file over the default configuration and validates it
+func Parse(data []byte) (Configuration, error) {
+	config := Default()
+	config.APIVersion, config.Kind = "", ""
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return Configuration{}, err
+	}
+	if config.APIVersion != APIVersion || config.Kind != Kind {
+		return Configuration{}, fmt.Errorf("unsupported configuration %s %s, expected %s %s", config.APIVersion, config.Kind, APIVersion, Kind)
+	}
+	if err := config.Validate(); err != nil {
+		return Configuration{}, err
+	}
+	return config, nil
+}
+
+// NameTemplates returns the name templates of the objects the reconciler creates at the hosted clusters
+func (c Configuration) NameTemplates() controllers.NameTemplates {
+	return controllers.NameTemplates{Group: c.Reconciler.GroupNameTemplate, RBACDefinition: c.Reconciler.RBACDefinitionNameTemplate}
+}
+
+// Propagation returns the allowlist of HostedCluster labels and annotations copied onto the guest objects
+func (c Configuration) Propagation() controllers.Propagation {
+	return controllers.Propagation{Labels: c.Reconciler.PropagateLabels, Annotations: c.Reconciler.PropagateAnnotations}
+}
+
+// LogLevel returns the lowest level logged
+func (c Configuration) LogLevel() zapcore.Level {
+	level := zapcore.DebugLevel
+	_ = level.UnmarshalText([]byte(c.Logging.Level))
+	return level
+}
+
+// Validate returns an error describing the first problem found in the configuration
+func (c Configuration) Validate() error {
+	if c.Manager.WebhookPort < 1 || c.Manager.WebhookPort > 65535 {
+		return fmt.Errorf("manager.webhookPort %d is not a valid port", c.Manager.WebhookPort)
+	}
+	if c.Manager.LeaderElection.Enabled && c.Manager.LeaderElection.ResourceName == "" {
+		return errors.New("manager.leaderElection.resourceName is required when leader election is enabled")
+	}
+	if c.Manager.SyncPeriod.Duration < 0 {
+		return errors.New("manager.syncPeriod must not be negative")
+	}
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(c.Logging.Level)); err != nil || level > zapcore.ErrorLevel {
+		return fmt.Errorf("logging.level %q is not debug, info, warn or error", c.Logging.Level)
+	}
+	if c.Reconciler.MaxConcurrentReconciles < 1 {
+		return errors.New("reconciler.maxConcurrentReconciles must be at least 1")
+	}
+	if c.Reconciler.VerificationRetryInterval.Duration <= 0 {
+		return errors.New("reconciler.verificationRetryInterval must be positive")
+	}
+	if err := c.NameTemplates().Validate(); err != nil {
+		return fmt.Errorf("reconciler name templates: %w", err)
+	}
+	if err := c.Propagation().Validate(); err != nil {
+		return fmt.Errorf("reconciler propagated keys: %w", err)
+	}
+	if err := policy.ProtectedNamespaces(c.Reconciler.ProtectedNamespaces).Validate(); err != nil {
+		return fmt.Errorf("reconciler.protectedNamespaces: %w", err)
+	}
+	if err := controllers.ValidateConsoleURLTemplate(c.Reconciler.ConsoleURLTemplate); err != nil {
+		return fmt.Errorf("reconciler.consoleURLTemplate: %w", err)
+	}
+	for _, problem := range validation.IsDNS1123Subdomain(c.HostedClusters.KubeconfigSecretName) {
+		return fmt.Errorf("hostedClusters.kubeconfigSecretName: %s", problem)
+	}
+	for _, problem := range validation.IsConfigMapKey(c.HostedClusters.KubeconfigSecretKey) {
+		return fmt.Errorf("hostedClusters.kubeconfigSecretKey: %s", problem)
+	}
+	if c.Profiles.ConfigMap != "" {
+		for _, problem := range validation.IsDNS1123Subdomain(c.Profiles.ConfigMap) {
+			return fmt.Errorf("profiles.configMap: %s", problem)
+		}
+		if c.Profiles.ConfigMapNamespace == "" {
+			return errors.New("profiles.configMapNamespace is required when POD_NAMESPACE is not set")
+		}
+	}
+	for _, problem := range validation.IsDNS1123Label(c.Audit.Namespace) {
+		return fmt.Errorf("audit.namespace: %s", problem)
+	}
+	switch c.Audit.Syslog.Network {
+	case audit.SyslogUDP, audit.SyslogTCP, audit.SyslogTLS:
+	default:
+		return fmt.Errorf("audit.syslog.network %q is not udp, tcp or tls", c.Audit.Syslog.Network)
+	}
+	if c.Audit.QueueSize < 1 {
+		return errors.New("audit.queueSize must be at least 1")
+	}
+	if c.API.BindAddress != "0" {
+		if err := server.CheckTLS(c.API.BindAddress, c.API.TLSCertFile, c.API.TLSKeyFile); err != nil {
+			return fmt.Errorf("api: %w", err)
+		}
+	}
+	return nil
+}
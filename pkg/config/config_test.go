@@ -0,0 +1,96 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const header = "apiVersion: config.permissions.dana.io/v1alpha1\nkind: ControllerConfiguration\n"
+
+func TestParse(t *testing.T) {
+	t.Setenv("POD_NAMESPACE", "")
+	tests := []struct {
+		name    string
+		file    string
+		check   func(t *testing.T, config Configuration)
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			file: header,
+			check: func(t *testing.T, config Configuration) {
+				if !reflect.DeepEqual(config, Default()) {
+					t.Errorf("Parse() = %+v, want the defaults", config)
+				}
+			},
+		},
+		{
+			name: "fields left out keep their default",
+			file: header + "manager:\n  leaderElection:\n    enabled: true\nreconciler:\n  maxConcurrentReconciles: 4\n" +
+				"  verificationRetryInterval: 1m\n  protectedNamespaces: [kube-*]\nlogging:\n  level: info\nprofiles:\n  policies: true\n",
+			check: func(t *testing.T, config Configuration) {
+				if !config.Manager.LeaderElection.Enabled || config.Manager.LeaderElection.ResourceName != "59d79847.dana.io" {
+					t.Errorf("leader election = %+v, want it enabled with the default resource name", config.Manager.LeaderElection)
+				}
+				if config.Manager.WebhookPort != 9443 || config.Audit.QueueSize != 1000 {
+					t.Errorf("webhook port %d and audit queue size %d, want the defaults", config.Manager.WebhookPort, config.Audit.QueueSize)
+				}
+				if config.Reconciler.MaxConcurrentReconciles != 4 || config.Reconciler.VerificationRetryInterval.Duration != time.Minute {
+					t.Errorf("reconciler = %+v, want 4 concurrent reconciles retrying every minute", config.Reconciler)
+				}
+				if !reflect.DeepEqual(config.Reconciler.ProtectedNamespaces, []string{"kube-*"}) {
+					t.Errorf("protected namespaces = %v, want [kube-*]", config.Reconciler.ProtectedNamespaces)
+				}
+				if config.LogLevel() != zapcore.InfoLevel || !config.Profiles.Policies {
+					t.Errorf("log level %s and policies %v, want info with policies", config.LogLevel(), config.Profiles.Policies)
+				}
+			},
+		},
+		{name: "version is required", file: "manager:\n  webhookPort: 9443\n", wantErr: "unsupported configuration"},
+		{name: "other version", file: "apiVersion: config.permissions.dana.io/v1beta1\nkind: ControllerConfiguration\n", wantErr: "unsupported configuration"},
+		{name: "unknown field", file: header + "manager:\n  port: 9443\n", wantErr: `unknown field "port"`},
+		{name: "invalid port", file: header + "manager:\n  webhookPort: 70000\n", wantErr: "manager.webhookPort"},
+		{name: "leader election without resource name", file: header + "manager:\n  leaderElection:\n    enabled: true\n    resourceName: ''\n",
+			wantErr: "manager.leaderElection.resourceName"},
+		{name: "invalid log level", file: header + "logging:\n  level: trace\n", wantErr: "logging.level"},
+		{name: "panic is not a log level", file: header + "logging:\n  level: panic\n", wantErr: "logging.level"},
+		{name: "no concurrency", file: header + "reconciler:\n  maxConcurrentReconciles: 0\n", wantErr: "reconciler.maxConcurrentReconciles"},
+		{name: "invalid duration", file: header + "reconciler:\n  verificationRetryInterval: soon\n", wantErr: "invalid duration"},
+		{name: "invalid name template", file: header + "reconciler:\n  groupNameTemplate: '{{ .Name'\n", wantErr: "name templates"},
+		{name: "invalid propagated key", file: header + "reconciler:\n  propagateLabels: ['not a key']\n", wantErr: "propagated keys"},
+		{name: "invalid secret name", file: header + "hostedClusters:\n  kubeconfigSecretName: Admin_Kubeconfig\n", wantErr: "hostedClusters.kubeconfigSecretName"},
+		{name: "profile configmap without namespace", file: header + "profiles:\n  configMap: role-profiles\n", wantErr: "profiles.configMapNamespace"},
+		{name: "unknown syslog network", file: header + "audit:\n  syslog:\n    network: quic\n", wantErr: "audit.syslog.network"},
+		{name: "empty audit queue", file: header + "audit:\n  queueSize: 0\n", wantErr: "audit.queueSize"},
+		{name: "api without tls", file: header + "api:\n  bindAddress: ':8443'\n", wantErr: "without TLS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := Parse([]byte(tt.file))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			tt.check(t, config)
+		})
+	}
+}
+
+func TestLoad_managerConfig(t *testing.T) {
+	config, err := Load("../../config/manager/controller_manager_config.yaml")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !config.Manager.LeaderElection.Enabled || config.Manager.MetricsBindAddress != "127.0.0.1:8080" {
+		t.Errorf("Load() manager = %+v, want leader election and metrics on localhost", config.Manager)
+	}
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/audit"
+	v1 "github.com/openshift/api/user/v1"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// auditChange gets the HostedCluster, the action and the previous and new state of a hosted cluster object
+// The function writes an audit record of the change, made by the controller for the user the annotations claim asked for it.
+// Failing to write the record does not fail the reconcile since the change was already made, it is logged and emitted as an event
+func (r *HostedClusterReconciler) auditChange(ctx context.Context, hostedCluster *v1alpha1.HostedCluster, action string, previous client.Object, new client.Object) {
+	if r.Audit == nil || r.DryRun {
+		return
+	}
+	record, err := r.newAuditRecord(hostedCluster, action, previous, new)
+	if err == nil {
+		err = r.Audit.Write(ctx, record)
+	}
+	if err != nil {
+		r.Log.Error(err, "could not write audit record", "hosted cluster", hostedCluster.GetName(), "action", action, "name", record.Object.Name)
+		if r.Recorder != nil {
+			r.Recorder.Eventf(hostedCluster, corev1.EventTypeWarning, "AuditFailed", "could not write audit record of %s %s: %v",
+				action, record.Object.Name, err)
+		}
+	}
+}
+
+// newAuditRecord gets the HostedCluster, the action and the previous and new state of a hosted cluster object
+// The function returns the audit record of the change with its trigger and who it is claimed by
+func (r *HostedClusterReconciler) newAuditRecord(hostedCluster *v1alpha1.HostedCluster, action string, previous client.Object, new client.Object) (audit.Record, error) {
+	var previousObject, newObject, object client.Object
+	if previous != nil {
+		previousObject, object = previous, previous
+	}
+	if new != nil {
+		newObject, object = new, new
+	}
+	record, err := audit.NewRecord(hostedCluster, action, objectKind(object), previousObject, newObject)
+	if err != nil {
+		return record, err
+	}
+	record.Object.Name = object.GetName()
+	record.Trigger, record.ClaimedBy = attributeChange(hostedCluster, action, previous, new, time.Now())
+	return record, nil
+}
+
+// attributeChange gets the HostedCluster, the action, the previous and new state of a hosted cluster object and the current time
+// The function returns what triggered the change and who the annotations claim asked for it: the requester it added, the
+// granters the grants annotation names for the users it added, or the user given cluster-admin. The claims are written by
+// whoever edits the HostedCluster and are not verified, so every change is made by audit.ControllerActor.
+// Users removed from the custom cluster admin group are claimed by nobody, with an expiry or revoke trigger
+func attributeChange(hostedCluster *v1alpha1.HostedCluster, action string, previous client.Object, new client.Object, now time.Time) (string, string) {
+	switch {
+	case action == audit.ActionAdopt:
+		return audit.TriggerAdopt, ""
+	case action == audit.ActionDelete:
+		return audit.TriggerRevoke, ""
+	}
+	if clusterRoleBinding, ok := new.(*rbacv1.ClusterRoleBinding); ok && clusterRoleBinding.RoleRef.Name == "cluster-admin" {
+		return audit.TriggerBreakGlass, clusterRoleBinding.GetName()
+	}
+	newGroup, ok := new.(*v1.Group)
+	if !ok {
+		return audit.TriggerReconcile, ""
+	}
+	previousUsers := make(map[string]bool)
+	if previousGroup, ok := previous.(*v1.Group); ok {
+		for _, user := range previousGroup.Users {
+			previousUsers[user] = true
+		}
+	}
+	grants, _ := access.GetGrants(hostedCluster)
+	grantedBy := make(map[string]string)
+	for _, grant := range grants {
+		grantedBy[grant.User] = grant.GrantedBy
+	}
+	requester := access.GetRequester(hostedCluster)
+
+	requested := false
+	granters := make(map[string]bool)
+	trigger := ""
+	for _, user := range newGroup.Users {
+		if previousUsers[user] {
+			delete(previousUsers, user)
+			continue
+		}
+		if user == requester {
+			requested = true
+			if trigger == "" {
+				trigger = audit.TriggerRequester
+			}
+			continue
+		}
+		trigger = audit.TriggerGrant
+		if grantedBy[user] != "" {
+			granters[grantedBy[user]] = true
+		}
+	}
+	if trigger == audit.TriggerGrant {
+		return trigger, joinUsers(granters)
+	}
+	if requested {
+		return trigger, requester
+	}
+	for user := range previousUsers {
+		for _, grant := range grants {
+			if grant.User == user && !grant.Active(now) {
+				return audit.TriggerExpiry, ""
+			}
+		}
+	}
+	if len(previousUsers) > 0 {
+		return audit.TriggerRevoke, ""
+	}
+	return audit.TriggerReconcile, ""
+}
+
+// joinUsers returns the sorted users separated by commas
+func joinUsers(users map[string]bool) string {
+	names := make([]string, 0, len(users))
+	for user := range users {
+		names = append(names, user)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/audit"
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestAttributeChange(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	hostedCluster := GetHostedClusterObject("test")
+	hostedCluster.SetAnnotations(map[string]string{
+		access.RequesterAnnotation: "requester",
+		access.GrantsAnnotation: `[{"user":"alice","grantedBy":"admin","grantedAt":"2022-10-01T10:00:00Z"},` +
+			`{"user":"bob","grantedBy":"lead","grantedAt":"2022-09-01T10:00:00Z","expiresAt":"2022-09-02T10:00:00Z"}]`,
+	})
+	clusterAdmin := GetClusterRoleBinding("breakglass")
+	tests := []struct {
+		name          string
+		action        string
+		previous      client.Object
+		new           client.Object
+		wantTrigger   string
+		wantClaimedBy string
+	}{
+		{
+			name:          "requester added",
+			action:        audit.ActionCreate,
+			new:           GetGroup("group", nil, "requester"),
+			wantTrigger:   audit.TriggerRequester,
+			wantClaimedBy: "requester",
+		},
+		{
+			name:          "grant added",
+			action:        audit.ActionUpdate,
+			previous:      GetGroup("group", nil, "requester"),
+			new:           GetGroup("group", nil, "alice", "requester"),
+			wantTrigger:   audit.TriggerGrant,
+			wantClaimedBy: "admin",
+		},
+		{
+			name:        "expired grant removed",
+			action:      audit.ActionUpdate,
+			previous:    GetGroup("group", nil, "bob", "requester"),
+			new:         GetGroup("group", nil, "requester"),
+			wantTrigger: audit.TriggerExpiry,
+		},
+		{
+			name:        "grant revoked",
+			action:      audit.ActionUpdate,
+			previous:    GetGroup("group", nil, "carol", "requester"),
+			new:         GetGroup("group", nil, "requester"),
+			wantTrigger: audit.TriggerRevoke,
+		},
+		{
+			name:        "group deleted",
+			action:      audit.ActionDelete,
+			previous:    GetGroup("group", nil, "requester"),
+			wantTrigger: audit.TriggerRevoke,
+		},
+		{
+			name:          "break glass",
+			action:        audit.ActionCreate,
+			new:           &clusterAdmin,
+			wantTrigger:   audit.TriggerBreakGlass,
+			wantClaimedBy: "breakglass",
+		},
+		{
+			name:        "adoption",
+			action:      audit.ActionAdopt,
+			previous:    GetGroup("group", nil, "someone"),
+			new:         GetGroup("group", nil, "requester"),
+			wantTrigger: audit.TriggerAdopt,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trigger, claimedBy := attributeChange(hostedCluster, tt.action, tt.previous, tt.new, now)
+			if trigger != tt.wantTrigger || claimedBy != tt.wantClaimedBy {
+				t.Errorf("attributeChange() = %s, %s want %s, %s", trigger, claimedBy, tt.wantTrigger, tt.wantClaimedBy)
+			}
+			record, err := (&HostedClusterReconciler{}).newAuditRecord(hostedCluster, tt.action, tt.previous, tt.new)
+			if err != nil {
+				t.Fatalf("newAuditRecord() error = %v", err)
+			}
+			if record.Actor != audit.ControllerActor || record.ClaimedBy != tt.wantClaimedBy {
+				t.Errorf("record actor and claimed by got: %s, %s want %s, %s", record.Actor, record.ClaimedBy, audit.ControllerActor, tt.wantClaimedBy)
+			}
+		})
+	}
+}
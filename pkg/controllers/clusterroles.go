@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	// profileClusterRoleLabel marks the ClusterRoles created from a role profile, they are garbage collected once
+	// the profile no longer declares them
+	profileClusterRoleLabel = "dana.io/profile-cluster-role"
+	profileAnnotation       = "dana.io/profile"
+	// clusterRoleVersionAnnotation is a hash of the rules of the ClusterRole, it changes whenever the profile changes them
+	clusterRoleVersionAnnotation = "dana.io/cluster-role-version"
+)
+
+// clusterRoleVersion returns a short hash of the rules and aggregation rule of a profile ClusterRole
+func clusterRoleVersion(clusterRole profiles.ClusterRole) (string, error) {
+	data, err := json.Marshal(struct {
+		Rules           []rbacv1.PolicyRule     `json:"rules,omitempty"`
+		AggregationRule *rbacv1.AggregationRule `json:"aggregationRule,omitempty"`
+	}{clusterRole.Rules, clusterRole.AggregationRule})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16], nil
+}
+
+// composeProfileClusterRoles gets a role profile and the namespaced name of the HostedCluster
+// The function returns the ClusterRoles the profile declares, labeled with their profile and version and marked as managed by the controller
+func composeProfileClusterRoles(profile *profiles.RoleProfile, owner string) ([]*rbacv1.ClusterRole, error) {
+	var clusterRoles []*rbacv1.ClusterRole
+	for _, declared := range profile.ClusterRoles {
+		version, err := clusterRoleVersion(declared)
+		if err != nil {
+			return nil, err
+		}
+		clusterRole := &rbacv1.ClusterRole{
+			ObjectMeta: v1api.ObjectMeta{
+				Name:   declared.Name,
+				Labels: mergeMaps(declared.Labels, map[string]string{profileClusterRoleLabel: "true"}),
+				Annotations: map[string]string{
+					profileAnnotation:            profile.Name,
+					clusterRoleVersionAnnotation: version,
+				},
+			},
+			Rules:           append([]rbacv1.PolicyRule{}, declared.Rules...),
+			AggregationRule: declared.AggregationRule.DeepCopy(),
+		}
+		setManaged(clusterRole, owner)
+		clusterRoles = append(clusterRoles, clusterRole)
+	}
+	return clusterRoles, nil
+}
+
+// applyProfileClusterRoles gets HostedCluster client, the HostedCluster, the desired profile ClusterRoles and context
+// The function creates or updates the ClusterRoles at the hosted cluster
+func (r *HostedClusterReconciler) applyProfileClusterRoles(ctx context.Context, hostedClient client.Client, hostedCluster *v1alpha1.HostedCluster, clusterRoles []*rbacv1.ClusterRole) error {
+	for _, clusterRole := range clusterRoles {
+		if err := r.applyGuestObject(ctx, hostedClient, hostedCluster, clusterRole); err != nil {
+			r.Log.Error(err, "could not apply cluster role at the hosted cluster", "clusterRole", clusterRole.GetName())
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteUnusedProfileClusterRoles gets HostedCluster client, the HostedCluster, the desired profile ClusterRoles and context
+// The function deletes the profile ClusterRoles the controller created that are no longer desired. It is called once
+// the RBACDefinition no longer binds them, so the bindings never point at a missing ClusterRole
+func (r *HostedClusterReconciler) deleteUnusedProfileClusterRoles(ctx context.Context, hostedClient client.Client, hostedCluster *v1alpha1.HostedCluster, clusterRoles []*rbacv1.ClusterRole) error {
+	desired := make(map[string]bool)
+	for _, clusterRole := range clusterRoles {
+		desired[clusterRole.GetName()] = true
+	}
+	existing := rbacv1.ClusterRoleList{}
+	if err := hostedClient.List(ctx, &existing, client.MatchingLabels{managedByLabel: managedByValue, profileClusterRoleLabel: "true"}); err != nil {
+		return err
+	}
+	for i := range existing.Items {
+		clusterRole := &existing.Items[i]
+		if desired[clusterRole.GetName()] {
+			continue
+		}
+		if err := r.deleteGuestObject(ctx, hostedClient, hostedCluster, clusterRole); err != nil {
+			r.Log.Error(err, "could not delete unused cluster role at the hosted cluster", "clusterRole", clusterRole.GetName())
+			return err
+		}
+		r.Log.Info("deleted cluster role no longer in the profile", "hosted cluster", hostedCluster.GetName(), "clusterRole", clusterRole.GetName())
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	rbacmanagerv1beta1 "github.com/fairwindsops/rbac-manager/pkg/apis/rbacmanager/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHostedClusterReconciler_applyProfileClusterRoles(t *testing.T) {
+	ctx := context.Background()
+	builtIn := &rbacv1.ClusterRole{ObjectMeta: v1api.ObjectMeta{Name: "edit"}}
+	hostedClient := fake.NewClientBuilder().WithScheme(hostedScheme).WithObjects(builtIn).Build()
+	hostedCluster := GetHostedClusterObject("test")
+	r := &HostedClusterReconciler{Log: ctrl.Log.WithName("test")}
+	routes := profiles.ClusterRole{
+		Name:   "route-editor",
+		Labels: map[string]string{"rbac.authorization.k8s.io/aggregate-to-edit": "true"},
+		Rules:  []rbacv1.PolicyRule{{APIGroups: []string{"route.openshift.io"}, Resources: []string{"routes"}, Verbs: []string{"get"}}},
+	}
+	routesUpdated := routes
+	routesUpdated.Rules = []rbacv1.PolicyRule{{APIGroups: []string{"route.openshift.io"}, Resources: []string{"routes"}, Verbs: []string{"get", "update"}}}
+	builds := profiles.ClusterRole{
+		Name:  "build-runner",
+		Rules: []rbacv1.PolicyRule{{APIGroups: []string{"build.openshift.io"}, Resources: []string{"builds"}, Verbs: []string{"create"}}},
+	}
+
+	var previousVersion string
+	tests := []struct {
+		name         string
+		clusterRoles []profiles.ClusterRole
+		wantRoles    map[string]bool
+		wantNewVer   bool
+	}{
+		{
+			name:         "creates profile cluster roles",
+			clusterRoles: []profiles.ClusterRole{routes, builds},
+			wantRoles:    map[string]bool{"route-editor": true, "build-runner": true},
+		},
+		{
+			name:         "updates changed rules and deletes unused roles",
+			clusterRoles: []profiles.ClusterRole{routesUpdated},
+			wantRoles:    map[string]bool{"route-editor": true, "build-runner": false},
+			wantNewVer:   true,
+		},
+		{
+			name:      "deletes every profile cluster role",
+			wantRoles: map[string]bool{"route-editor": false, "build-runner": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := &profiles.RoleProfile{Name: "developers", ClusterRoles: tt.clusterRoles}
+			clusterRoles, err := composeProfileClusterRoles(profile, "clusters/test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.applyProfileClusterRoles(ctx, hostedClient, hostedCluster, clusterRoles); err != nil {
+				t.Fatalf("applyProfileClusterRoles() error = %v", err)
+			}
+			if err := r.deleteUnusedProfileClusterRoles(ctx, hostedClient, hostedCluster, clusterRoles); err != nil {
+				t.Fatalf("deleteUnusedProfileClusterRoles() error = %v", err)
+			}
+			for name, want := range tt.wantRoles {
+				clusterRole := rbacv1.ClusterRole{}
+				err := hostedClient.Get(ctx, types.NamespacedName{Name: name}, &clusterRole)
+				if !want {
+					if !errors.IsNotFound(err) {
+						t.Errorf("cluster role %s should be deleted, got %v", name, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("cluster role %s: %v", name, err)
+				}
+				if clusterRole.GetAnnotations()[profileAnnotation] != "developers" {
+					t.Errorf("cluster role %s annotations got: %v", name, clusterRole.GetAnnotations())
+				}
+				if name == "route-editor" {
+					version := clusterRole.GetAnnotations()[clusterRoleVersionAnnotation]
+					if tt.wantNewVer && version == previousVersion {
+						t.Errorf("cluster role version did not change")
+					}
+					previousVersion = version
+					if clusterRole.GetLabels()["rbac.authorization.k8s.io/aggregate-to-edit"] != "true" {
+						t.Errorf("aggregation label missing: %v", clusterRole.GetLabels())
+					}
+				}
+			}
+			if err := hostedClient.Get(ctx, types.NamespacedName{Name: "edit"}, &rbacv1.ClusterRole{}); err != nil {
+				t.Errorf("built-in cluster role was touched: %v", err)
+			}
+		})
+	}
+}
+
+// bindingCheckingClient fails deleting a ClusterRole an RBACDefinition still binds
+type bindingCheckingClient struct {
+	client.Client
+}
+
+func (c bindingCheckingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if _, ok := obj.(*rbacv1.ClusterRole); ok {
+		definitions := rbacmanagerv1beta1.RBACDefinitionList{}
+		if err := c.Client.List(ctx, &definitions); err != nil {
+			return err
+		}
+		for _, definition := range definitions.Items {
+			for _, bindings := range definition.RBACBindings {
+				for _, binding := range bindings.ClusterRoleBindings {
+					if binding.ClusterRole == obj.GetName() {
+						return fmt.Errorf("cluster role %s is still bound by %s", obj.GetName(), definition.GetName())
+					}
+				}
+			}
+		}
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func TestHostedClusterReconciler_addCustomClusterAdminGroupDropsClusterRole(t *testing.T) {
+	ctx := context.Background()
+	hostedClient := bindingCheckingClient{fake.NewClientBuilder().WithScheme(hostedScheme).Build()}
+	hostedCluster := GetHostedClusterObject("test")
+	routes := profiles.ClusterRole{
+		Name:  "route-reader",
+		Rules: []rbacv1.PolicyRule{{APIGroups: []string{"route.openshift.io"}, Resources: []string{"routes"}, Verbs: []string{"get"}}},
+	}
+	builds := profiles.ClusterRole{
+		Name:  "build-reader",
+		Rules: []rbacv1.PolicyRule{{APIGroups: []string{"build.openshift.io"}, Resources: []string{"builds"}, Verbs: []string{"get"}}},
+	}
+	for _, profile := range []*profiles.RoleProfile{
+		{
+			Name:                "developers",
+			ClusterRoles:        []profiles.ClusterRole{routes, builds},
+			ClusterRoleBindings: []rbacmanagerv1beta1.ClusterRoleBinding{{ClusterRole: "route-reader"}, {ClusterRole: "build-reader"}},
+		},
+		{
+			Name:                "developers",
+			ClusterRoles:        []profiles.ClusterRole{routes},
+			ClusterRoleBindings: []rbacmanagerv1beta1.ClusterRoleBinding{{ClusterRole: "route-reader"}},
+		},
+	} {
+		r := &HostedClusterReconciler{Log: ctrl.Log.WithName("test"), Profile: profile}
+		if _, err := r.addCustomClusterAdminGroup(hostedClient, hostedCluster, []string{"alice"}, nil, ctx); err != nil {
+			t.Fatalf("addCustomClusterAdminGroup() error = %v", err)
+		}
+	}
+	if err := hostedClient.Get(ctx, types.NamespacedName{Name: "build-reader"}, &rbacv1.ClusterRole{}); !errors.IsNotFound(err) {
+		t.Errorf("cluster role dropped from the profile should be deleted, got %v", err)
+	}
+}
@@ -18,40 +18,123 @@ package controllers
 
 import (
 	"context"
+	goerrors "errors"
+	"reflect"
+	"strings"
+	"time"
+
+	permissionsv1alpha1 "github.com/dana-team/permission-granter-controller/api/v1alpha1"
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/audit"
+	"github.com/dana-team/permission-granter-controller/pkg/notify"
+	"github.com/dana-team/permission-granter-controller/pkg/policy"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	"github.com/dana-team/permission-granter-controller/pkg/state"
 	utils "github.com/dana-team/permission-granter-controller/pkg/utils"
 	rbacmanagerv1beta1 "github.com/fairwindsops/rbac-manager/pkg/apis/rbacmanager/v1beta1"
 	"github.com/go-logr/logr"
 	v1 "github.com/openshift/api/user/v1"
 	"github.com/openshift/hypershift/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // HostedClusterReconciler reconciles a HostedCluster object
 type HostedClusterReconciler struct {
-	Client client.Client
-	Scheme *runtime.Scheme
-	Log    logr.Logger
+	Client        client.Client
+	Scheme        *runtime.Scheme
+	Log           logr.Logger
+	Recorder      record.EventRecorder
+	Audit         audit.Sink
+	NameTemplates NameTemplates
+	// Profile is the role profile given to the custom cluster admin group, the default profile is used when it is nil
+	Profile *profiles.RoleProfile
+	// Profiles are the role profiles ProfilePolicies select by name, besides the configured and the default profile
+	Profiles map[string]*profiles.RoleProfile
+	// Policies reads the ProfilePolicies mapping HostedClusters to role profiles and the ProfileRollouts of the profiles,
+	// Profile is given to every HostedCluster when it is nil
+	Policies client.Reader
+	// ProfileConfigMap is the ConfigMap role profiles are hot-reloaded from, they are selected by name like Profiles.
+	// Nothing is loaded when its name is empty
+	ProfileConfigMap types.NamespacedName
+	// OwnerNamespace is the namespace at the hosted clusters the owner ConfigMap is published in, nothing is published when empty
+	OwnerNamespace string
+	// Propagation is the allowlist of HostedCluster labels and annotations copied onto the guest objects
+	Propagation Propagation
+	// ProtectedNamespaces are the namespaces of the hosted clusters the role profile must not give access to
+	ProtectedNamespaces policy.ProtectedNamespaces
+	// Notifier tells users they were given access to a hosted cluster, it may be nil
+	Notifier notify.Notifier
+	// ConsoleURLTemplate renders the console URL sent in notifications, DefaultConsoleURLTemplate is used when empty
+	ConsoleURLTemplate string
+	// State receives the view of every hosted cluster after it is reconciled, it may be nil
+	State *state.Store
+	// MaxConcurrentReconciles is the number of HostedClusters reconciled at once, 10 when zero
+	MaxConcurrentReconciles int
+	// VerificationRetryInterval is how often access that did not pass verification is checked again,
+	// 30 seconds when zero
+	VerificationRetryInterval time.Duration
+	// DryRun makes the reconciler send every change to the hosted clusters as a server-side dry-run request
+	// and report the resulting diff instead of persisting it
+	DryRun bool
+
+	// namespaceWatches watches the namespaces of the hosted clusters whose profile selects namespaces dynamically
+	namespaceWatches *namespaceWatches
+	// configMapProfiles are the role profiles loaded last from ProfileConfigMap
+	configMapProfiles *configMapProfiles
 }
 
 type HostedClusterPredicate struct {
 	predicate.Funcs
 }
 
+// Update filters out HostedCluster updates that cannot change the access the controller grants,
+// including the updates the controller itself makes when reporting status
+func (HostedClusterPredicate) Update(e event.UpdateEvent) bool {
+	if e.ObjectOld == nil || e.ObjectNew == nil {
+		return true
+	}
+	if e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration() {
+		return true
+	}
+	if !reflect.DeepEqual(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels()) {
+		return true
+	}
+	oldAnnotations := mergeMaps(e.ObjectOld.GetAnnotations(), nil)
+	newAnnotations := mergeMaps(e.ObjectNew.GetAnnotations(), nil)
+	delete(oldAnnotations, access.StatusAnnotation)
+	delete(newAnnotations, access.StatusAnnotation)
+	return !reflect.DeepEqual(oldAnnotations, newAnnotations)
+}
+
 var (
-	requesterAnnotation    = "dana.io/requester"
-	clusterAdminAnnotation = "dana.io/addedclusteradmin"
+	requesterAnnotation    = access.RequesterAnnotation
+	clusterAdminAnnotation = access.ClusterAdminAnnotation
 )
 
 //+kubebuilder:rbac:groups=hypershift.openshift.io.dana.io,resources=hostedclusters,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=hypershift.openshift.io.dana.io,resources=hostedclusters/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=hypershift.openshift.io.dana.io,resources=hostedclusters/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+//+kubebuilder:rbac:groups=permissions.dana.io,resources=profilepolicies,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -71,26 +154,173 @@ func (r *HostedClusterReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 			log.Error(err, "could not decode object")
 			return ctrl.Result{}, err
 		}
+		r.forgetState(req.NamespacedName)
+		r.stopWatchingNamespaces(req.NamespacedName)
 		return ctrl.Result{}, nil
 	}
+	r = r.withAdoptionPreview(hostedClusterObject)
 
-	hostedClient := r.getHostedClusterClient(hostedClusterObject.GetName())
-	if val, ok := hostedClusterObject.GetAnnotations()[requesterAnnotation]; ok {
-		if err := r.addCustomClusterAdminGroup(hostedClient, val, ctx); err != nil {
-			return ctrl.Result{}, err
+	subjects, nextExpiry, err := access.Subjects(hostedClusterObject, time.Now())
+	if err != nil {
+		// the annotation has to be fixed before anything can be granted, the fix will trigger a new reconcile
+		log.Error(err, "could not read grants")
+		return ctrl.Result{}, nil
+	}
+	previousStatus, err := access.GetStatus(hostedClusterObject)
+	if err != nil {
+		log.Error(err, "could not read access status, ignoring it")
+	}
+	_, hasOwners := getOwnerInfo(hostedClusterObject)
+	publishesOwners := r.OwnerNamespace != "" && (hasOwners || (previousStatus != nil && previousStatus.OwnerInfo))
+	if len(subjects) == 0 && (previousStatus == nil || previousStatus.Group == "") && !publishesOwners {
+		r.forgetState(req.NamespacedName)
+		r.stopWatchingNamespaces(req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+
+	if len(subjects) == 0 {
+		// nobody is given namespaces anymore, whether or not a group is left to remove or the hosted cluster is reachable
+		r.stopWatchingNamespaces(req.NamespacedName)
+	}
+	hostedClient, err := r.getHostedClusterClient(hostedClusterObject.GetName())
+	if err != nil {
+		r.recordState(hostedClusterObject, subjects, access.Status{LastError: err.Error()}, false)
+		return ctrl.Result{}, err
+	}
+	status := access.Status{}
+	if len(subjects) == 0 {
+		if previousStatus != nil && previousStatus.Group != "" {
+			err = r.removeCustomClusterAdminGroup(hostedClient, hostedClusterObject, previousStatus, ctx)
+		}
+	} else {
+		status, err = r.addCustomClusterAdminGroup(hostedClient, hostedClusterObject, subjects, previousStatus, ctx)
+		if err != nil {
+			// revoking does not wait for the profile to be fixed, users without access leave the group meanwhile
+			if revokeErr := r.removeRevokedMembers(ctx, hostedClient, hostedClusterObject, subjects, previousStatus, &status); revokeErr != nil {
+				log.Error(revokeErr, "could not remove revoked users from the custom cluster admin group")
+			}
+		} else {
+			if propagateErr := r.propagateToNamespaces(ctx, hostedClient, hostedClusterObject); propagateErr != nil {
+				log.Error(propagateErr, "could not propagate metadata to the guest namespaces")
+				if r.Recorder != nil {
+					r.Recorder.Eventf(hostedClusterObject, corev1.EventTypeWarning, "PropagationFailed", "could not propagate metadata to the guest namespaces: %v", propagateErr)
+				}
+			}
 		}
 	}
-	return ctrl.Result{}, nil
+	// the owners are published whether or not anybody has access, they follow the owner annotations alone
+	if ownerErr := r.publishOwnerInfo(ctx, hostedClient, hostedClusterObject); ownerErr != nil {
+		// the owner information is informational, failing to publish it does not fail the grant
+		log.Error(ownerErr, "could not publish owner information at the hosted cluster")
+		if r.Recorder != nil {
+			r.Recorder.Eventf(hostedClusterObject, corev1.EventTypeWarning, "OwnerInfoFailed", "could not publish owner information: %v", ownerErr)
+		}
+		status.OwnerInfo = publishesOwners
+	} else {
+		status.OwnerInfo = r.OwnerNamespace != "" && hasOwners
+	}
+	if err != nil {
+		status.LastError = err.Error()
+		keepRecordedObjects(&status, previousStatus)
+	}
+	if status.Verification != nil && !status.Verification.Passed {
+		// the users are notified once the access works, the status remembers who is still to be told
+		status.Unnotified = r.unnotifiedUsers(previousStatus, status)
+	}
+	statusErr := r.updateAccessStatus(ctx, hostedClusterObject, previousStatus, status)
+	if statusErr != nil {
+		log.Error(statusErr, "could not update access status")
+	}
+	r.recordState(hostedClusterObject, subjects, status, err == nil || isAPIError(err))
+	if err == nil && len(subjects) > 0 {
+		if adoptErr := r.completeAdoption(ctx, hostedClusterObject); adoptErr != nil {
+			log.Error(adoptErr, "could not remove the adoption annotation")
+		}
+	}
+	var unnotified []string
+	if err == nil && statusErr == nil && len(subjects) > 0 {
+		unnotified = r.notifyGranted(ctx, hostedClusterObject, previousStatus, status)
+		if unnotifiedErr := r.recordUnnotified(ctx, hostedClusterObject, status, unnotified); unnotifiedErr != nil {
+			log.Error(unnotifiedErr, "could not record the users left unnotified")
+		}
+	}
+	result := ctrl.Result{}
+	if !nextExpiry.IsZero() {
+		// reconcile again when the next grant expires so the user is removed from the group
+		result.RequeueAfter = time.Until(nextExpiry)
+	}
+	if err != nil {
+		if goerrors.Is(err, errNotManaged) || goerrors.Is(err, errPolicyViolation) || goerrors.Is(err, policy.ErrProtectedNamespace) ||
+			goerrors.Is(err, errProfileNotFound) || goerrors.Is(err, errProfileRender) {
+			// retrying will not help, the HostedCluster has to be annotated for adoption, or the profile, policy or labels fixed first.
+			// Grants still expire meanwhile
+			return result, nil
+		}
+		return ctrl.Result{}, err
+	}
+	verificationFailed := status.Verification != nil && !status.Verification.Passed
+	if verificationFailed {
+		// rbac-manager may not have materialized the bindings yet, check again until it did
+		log.Info("access verification failed, retrying", "failures", status.Verification.Failures)
+		if r.Recorder != nil {
+			r.Recorder.Eventf(hostedClusterObject, corev1.EventTypeWarning, "VerificationFailed", "access verification failed: %s",
+				strings.Join(status.Verification.Failures, "; "))
+		}
+	}
+	// the users left unnotified are notified again on the next reconcile
+	if verificationFailed || len(unnotified) > 0 {
+		retryInterval := r.VerificationRetryInterval
+		if retryInterval == 0 {
+			retryInterval = verificationRetryInterval
+		}
+		if result.RequeueAfter == 0 || result.RequeueAfter > retryInterval {
+			result.RequeueAfter = retryInterval
+		}
+	}
+	return result, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *HostedClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	hostedCluster := &v1alpha1.HostedCluster{}
+	r.namespaceWatches = newNamespaceWatches(r.Client, r.Log)
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		r.namespaceWatches.stopAll()
+		return nil
+	})); err != nil {
+		return err
+	}
+	controllerBuilder := ctrl.NewControllerManagedBy(mgr).
+		For(hostedCluster, builder.WithPredicates(HostedClusterPredicate{})).
+		Watches(&source.Channel{Source: r.namespaceWatches.events}, &handler.EnqueueRequestForObject{})
+	if r.Policies != nil {
+		controllerBuilder = controllerBuilder.Watches(&source.Kind{Type: &permissionsv1alpha1.ProfilePolicy{}},
+			handler.EnqueueRequestsFromMapFunc(r.hostedClustersForProfilePolicy)).
+			Watches(&source.Kind{Type: &permissionsv1alpha1.ProfileRollout{}},
+				handler.EnqueueRequestsFromMapFunc(r.hostedClustersForProfilePolicy), builder.WithPredicates(rolloutChangedPredicate))
+	}
+	if r.ProfileConfigMap.Name != "" {
+		r.configMapProfiles = newConfigMapProfiles()
+		controllerBuilder = controllerBuilder.Watches(&source.Channel{Source: r.configMapProfiles.events}, &handler.EnqueueRequestForObject{})
+	}
+	maxConcurrentReconciles := r.MaxConcurrentReconciles
+	if maxConcurrentReconciles == 0 {
+		maxConcurrentReconciles = 10
+	}
+	err := controllerBuilder.WithOptions(controller.Options{
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+	}).Complete(r)
+	if err != nil || r.ProfileConfigMap.Name == "" {
+		return err
+	}
+	// the profile ConfigMap is reconciled by a controller of its own, reloading it reconciles the HostedClusters again
 	return ctrl.NewControllerManagedBy(mgr).
-		For(hostedCluster).
-		WithOptions(controller.Options{
-			MaxConcurrentReconciles: 10,
-		}).Complete(r)
+		Named("profile-configmap").
+		For(&corev1.ConfigMap{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(object client.Object) bool {
+			return object.GetNamespace() == r.ProfileConfigMap.Namespace && object.GetName() == r.ProfileConfigMap.Name
+		}))).
+		Complete(reconcile.Func(r.reloadProfiles))
 }
 
 // composeClusterAdminCRB the function gets username
@@ -110,40 +340,36 @@ func composeClusterAdminCRB(username string) rbacv1.ClusterRoleBinding {
 }
 
 // composeCustomClusterAdminGroup function returns a group for the custom cluster admins on the cluster,
-// The cluster requester will be added to this group
-func composeCustomClusterAdminGroup(requester string) v1.Group {
+// The cluster requester and the users granted access will be added to this group
+func composeCustomClusterAdminGroup(groupName string, users []string) v1.Group {
 	return v1.Group{
 		ObjectMeta: v1api.ObjectMeta{
-			Name: "custom-cluster-admin",
+			Name: groupName,
 		},
-		Users: []string{requester},
+		Users: users,
 	}
 }
 
-// composeCustomAdminRBACDefinition function returns a RBACDefinition giving the custom-cluster-admin group the required permissions
-// we are waiting for OCP and to give us required permissions list, meanwhile this is just an example
-func composeCustomAdminRBACDefinition() rbacmanagerv1beta1.RBACDefinition {
+// composeCustomAdminRBACDefinition function returns a RBACDefinition giving the custom cluster admin group
+// the permissions described by the role profile
+func composeCustomAdminRBACDefinition(rbacDefinitionName string, groupName string, profile *profiles.RoleProfile) rbacmanagerv1beta1.RBACDefinition {
 	return rbacmanagerv1beta1.RBACDefinition{
 		ObjectMeta: v1api.ObjectMeta{
-			Name: "custom-cluster-admin-access",
+			Name: rbacDefinitionName,
 		},
 		RBACBindings: []rbacmanagerv1beta1.RBACBinding{
 			{
-				Name: "custom-cluster-admin",
+				Name: groupName,
 				Subjects: []rbacmanagerv1beta1.Subject{
 					{
 						Subject: rbacv1.Subject{
 							Kind: "Group",
-							Name: "custom-cluster-admin",
+							Name: groupName,
 						},
 					},
 				},
-				RoleBindings: []rbacmanagerv1beta1.RoleBinding{
-					{
-						Namespace:   "customAdminNamespace",
-						ClusterRole: "edit",
-					},
-				},
+				RoleBindings:        profile.RoleBindings,
+				ClusterRoleBindings: profile.ClusterRoleBindings,
 			},
 		},
 	}
@@ -165,6 +391,10 @@ func AppendAnnotations(hostedCluster *v1alpha1.HostedCluster, annotationsToAppen
 // addClusterAdminAnnotation gets username of HostedCluster requester, HostedCluster and context
 // The functions adds cluster-admin annotation with the username to the HostedCluster and updates it
 func (r *HostedClusterReconciler) addClusterAdminAnnotation(username string, hostedClusterObject *v1alpha1.HostedCluster, ctx context.Context) {
+	if r.DryRun {
+		r.Log.Info("dry run: skipping cluster-admin annotation update", "username", username)
+		return
+	}
 	annotations := make(map[string]string)
 	annotations[clusterAdminAnnotation] = username
 	AppendAnnotations(hostedClusterObject, annotations)
@@ -174,34 +404,214 @@ func (r *HostedClusterReconciler) addClusterAdminAnnotation(username string, hos
 }
 
 // getHostedClusterClient gets HostedCluster name and returns its client
-func (r *HostedClusterReconciler) getHostedClusterClient(hostedclustername string) client.Client {
-	//gets the HostedCluster client config
-	hostedConfig, err := utils.GetHostedKubeRestConfig(r.Client, hostedclustername)
+func (r *HostedClusterReconciler) getHostedClusterClient(hostedclustername string) (client.Client, error) {
+	hostedClusterClient, err := utils.GetHostedClient(r.Client, hostedclustername)
 	if err != nil {
 		r.Log.Error(err, "unable to get hosted cluster client")
+		return nil, err
+	}
+	return hostedClusterClient, nil
+}
+
+// addCustomClusterAdminGroup gets HostedCluster client, the HostedCluster, the users that should have access, the last reported
+// access status (nil if there is none) and context
+// The function creates custom cluster admin group with required permissions at the HostedCluster, the users are added to this group.
+// Objects that already exist at the HostedCluster are updated only if the controller manages them or the HostedCluster is annotated for adoption.
+// A group or RBACDefinition recorded in the last status under another name is deleted first.
+// The function returns the access status to report on the HostedCluster
+func (r *HostedClusterReconciler) addCustomClusterAdminGroup(hostedClient client.Client, hostedClusterObject *v1alpha1.HostedCluster, users []string, previousStatus *access.Status, ctx context.Context) (access.Status, error) {
+	profile, profilePolicy, err := r.selectProfile(ctx, hostedClusterObject)
+	if err != nil {
+		return access.Status{ProfilePolicy: profilePolicy}, err
+	}
+	status := access.Status{ProfilePolicy: profilePolicy}
+	if profile, status.Rollout, err = r.applyRollout(ctx, hostedClusterObject, profile); err != nil {
+		return status, err
+	}
+	status.Profile = profile.Name
+	if profile, err = r.renderProfile(hostedClusterObject, profile); err != nil {
+		return status, err
+	}
+	desired, err := composeGuestObjects(hostedClusterObject, users, profile, r.NameTemplates, r.ProtectedNamespaces)
+	if goerrors.Is(err, policy.ErrProtectedNamespace) {
+		return status, r.rejectProtected(hostedClusterObject, profile, &status, []string{err.Error()})
 	}
-	//creates client from the client config
-	hostedClusterClient, err := client.New(hostedConfig, client.Options{})
 	if err != nil {
-		r.Log.Error(err, "unable to get hosted cluster client")
+		r.Log.Error(err, "could not compose custom cluster admin objects")
+		return status, err
+	}
+	// the renamed objects go before the status stops recording them, they would keep handing out access otherwise
+	if err := r.removeRenamedObjects(ctx, hostedClient, hostedClusterObject, previousStatus, desired); err != nil {
+		return status, err
+	}
+	status.Group = desired.group.GetName()
+	status.RBACDefinition = desired.rbacDefinition.GetName()
+	// the watch starts before the namespaces are listed so a namespace created in between is not missed
+	if err := r.watchNamespaces(hostedClusterObject, profile); err != nil {
+		r.Log.Error(err, "could not watch namespaces at the hosted cluster")
+		return status, err
+	}
+	selected, excluded, err := resolveNamespaceRoleBindings(ctx, hostedClient, profile.NamespaceRoleBindings, r.ProtectedNamespaces)
+	if err != nil {
+		r.Log.Error(err, "could not select namespaces at the hosted cluster")
+		return status, err
+	}
+	if len(excluded) > 0 {
+		r.Log.Info("namespace role bindings select protected namespaces, they are left out", "hosted cluster", hostedClusterObject.GetName(),
+			"profile", profile.Name, "namespaces", excluded)
+		if r.Recorder != nil {
+			r.Recorder.Eventf(hostedClusterObject, corev1.EventTypeWarning, "ProtectedNamespacesExcluded",
+				"role profile %s selects protected namespaces, they are left out: %s", profile.Name, strings.Join(excluded, ", "))
+		}
+	}
+	bindings := &desired.rbacDefinition.RBACBindings[0]
+	bindings.RoleBindings = append(append([]rbacmanagerv1beta1.RoleBinding{}, bindings.RoleBindings...), selected...)
+	// nothing is applied when the profile would hand out permissions amounting to cluster-admin
+	if err := r.enforceProfilePolicy(ctx, hostedClient, hostedClusterObject, profile, bindings, &status); err != nil {
+		return status, err
 	}
-	return hostedClusterClient
+	r.Propagation.apply(hostedClusterObject, desired.group)
+	if err := r.applyGuestObject(ctx, hostedClient, hostedClusterObject, desired.group); err != nil {
+		r.Log.Error(err, "could not create custom cluster admin group at the hosted cluster", "group", desired.group.GetName())
+		return status, err
+	}
+	if !r.DryRun {
+		// nobody is given access by a dry-run
+		status.Users = desired.group.Users
+	}
+	// the namespaces exist before the bindings in them are applied
+	if err := r.provisionNamespaces(ctx, hostedClient, hostedClusterObject, desired.namespaces); err != nil {
+		return status, err
+	}
+	for _, guest := range desired.namespaces {
+		status.Namespaces = append(status.Namespaces, guest.namespace.GetName())
+	}
+	if err := r.applyProfileClusterRoles(ctx, hostedClient, hostedClusterObject, desired.clusterRoles); err != nil {
+		return status, err
+	}
+	if err := r.applyGuestObject(ctx, hostedClient, hostedClusterObject, desired.rbacDefinition); err != nil {
+		r.Log.Error(err, "could not create rbac definition at the hosted cluster", "rbacDefinition", desired.rbacDefinition.GetName())
+		return status, err
+	}
+	if err := r.deleteUnusedProfileClusterRoles(ctx, hostedClient, hostedClusterObject, desired.clusterRoles); err != nil {
+		return status, err
+	}
+	if r.DryRun {
+		return status, nil
+	}
+	r.Log.Info("custom cluster admin group created with required permissions and users were added to the group", "users", users, "group", desired.group.GetName())
+	if status.Verification, err = verifyAccess(ctx, hostedClient, desired.group.Users, desired.group.GetName(), profile.Checks); err != nil {
+		r.Log.Error(err, "could not verify access at the hosted cluster")
+		return status, err
+	}
+	return status, nil
 }
 
-// addCustomClusterAdminGroup gets HostedCluster client, HostedCluster requester username, and context
-// The function creates custom cluster admin group with required permissions at the HostedCluster, the cluster requester is added to this group.
-func (r *HostedClusterReconciler) addCustomClusterAdminGroup(hostedClient client.Client, username string, ctx context.Context) error {
-	customClusterAdminGroup := composeCustomClusterAdminGroup(username)
-	if err := hostedClient.Create(ctx, &customClusterAdminGroup); err != nil {
-		r.Log.Error(err, "could not create custom cluster admin group at the hosted cluster")
+// removeRevokedMembers gets HostedCluster client, the HostedCluster, the users that should have access, the last reported access
+// status (nil if there is none), the access status of a reconcile that failed and context
+// The function removes the users that should not have access anymore from the custom cluster admin group when the failed
+// reconcile did not apply the group, e.g. because the role profile is invalid. Nobody is added, and a group the controller
+// does not manage is left untouched. The users left in the group are recorded in the status
+func (r *HostedClusterReconciler) removeRevokedMembers(ctx context.Context, hostedClient client.Client, hostedClusterObject *v1alpha1.HostedCluster, users []string, previousStatus *access.Status, status *access.Status) error {
+	if status.Users != nil {
+		return nil
+	}
+	name := status.Group
+	if name == "" && previousStatus != nil {
+		name = previousStatus.Group
+	}
+	if name == "" {
+		return nil
+	}
+	group := &v1.Group{}
+	if err := hostedClient.Get(ctx, types.NamespacedName{Name: name}, group); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !isManaged(group) {
+		return nil
+	}
+	allowed := make(map[string]bool, len(users))
+	for _, user := range users {
+		allowed[user] = true
+	}
+	remaining := []string{}
+	for _, user := range group.Users {
+		if allowed[user] {
+			remaining = append(remaining, user)
+		}
+	}
+	if len(remaining) == len(group.Users) {
+		return nil
+	}
+	revoked := group.DeepCopy()
+	revoked.Users = remaining
+	if err := r.applyGuestObject(ctx, hostedClient, hostedClusterObject, revoked); err != nil {
+		return err
+	}
+	if !r.DryRun {
+		status.Users = remaining
+		if previousStatus != nil && previousStatus.Group == name {
+			for _, user := range previousStatus.Unnotified {
+				if allowed[user] {
+					status.Unnotified = append(status.Unnotified, user)
+				}
+			}
+		}
+		r.Log.Info("revoked users removed from the custom cluster admin group", "hosted cluster", hostedClusterObject.GetName(), "group", name, "users", remaining)
+	}
+	return nil
+}
+
+// removeRenamedObjects gets HostedCluster client, the HostedCluster, the last reported access status (nil if there is none)
+// and the guest objects about to be applied
+// The function deletes the group and RBACDefinition the last status recorded when they are applied under another name now,
+// e.g. because a name annotation or the name templates changed
+func (r *HostedClusterReconciler) removeRenamedObjects(ctx context.Context, hostedClient client.Client, hostedClusterObject *v1alpha1.HostedCluster, previousStatus *access.Status, desired guestObjects) error {
+	if previousStatus == nil {
+		return nil
+	}
+	if previousStatus.RBACDefinition != "" && previousStatus.RBACDefinition != desired.rbacDefinition.GetName() {
+		rbacDefinition := &rbacmanagerv1beta1.RBACDefinition{ObjectMeta: v1api.ObjectMeta{Name: previousStatus.RBACDefinition}}
+		if err := r.deleteGuestObject(ctx, hostedClient, hostedClusterObject, rbacDefinition); err != nil {
+			r.Log.Error(err, "could not delete renamed rbac definition at the hosted cluster", "rbacDefinition", previousStatus.RBACDefinition)
+			return err
+		}
+	}
+	if previousStatus.Group != "" && previousStatus.Group != desired.group.GetName() {
+		group := &v1.Group{ObjectMeta: v1api.ObjectMeta{Name: previousStatus.Group}}
+		if err := r.deleteGuestObject(ctx, hostedClient, hostedClusterObject, group); err != nil {
+			r.Log.Error(err, "could not delete renamed custom cluster admin group at the hosted cluster", "group", previousStatus.Group)
+			return err
+		}
+	}
+	return nil
+}
+
+// removeCustomClusterAdminGroup gets HostedCluster client, the HostedCluster, the last reported access status and context
+// The function deletes the custom cluster admin group and RBACDefinition once nobody has access to the HostedCluster anymore
+func (r *HostedClusterReconciler) removeCustomClusterAdminGroup(hostedClient client.Client, hostedClusterObject *v1alpha1.HostedCluster, previousStatus *access.Status, ctx context.Context) error {
+	if previousStatus.RBACDefinition != "" {
+		rbacDefinition := &rbacmanagerv1beta1.RBACDefinition{ObjectMeta: v1api.ObjectMeta{Name: previousStatus.RBACDefinition}}
+		if err := r.deleteGuestObject(ctx, hostedClient, hostedClusterObject, rbacDefinition); err != nil {
+			r.Log.Error(err, "could not delete rbac definition at the hosted cluster", "rbacDefinition", previousStatus.RBACDefinition)
+			return err
+		}
+	}
+	if err := r.removeNamespaces(ctx, hostedClient, hostedClusterObject); err != nil {
+		return err
+	}
+	// nothing binds the profile ClusterRoles once access is revoked
+	if err := r.deleteUnusedProfileClusterRoles(ctx, hostedClient, hostedClusterObject, nil); err != nil {
 		return err
 	}
-	rbacDefinition := composeCustomAdminRBACDefinition()
-	if err := hostedClient.Create(ctx, &rbacDefinition); err != nil {
-		r.Log.Error(err, "could not create rbac definition at the hosted cluster")
+	group := &v1.Group{ObjectMeta: v1api.ObjectMeta{Name: previousStatus.Group}}
+	if err := r.deleteGuestObject(ctx, hostedClient, hostedClusterObject, group); err != nil {
+		r.Log.Error(err, "could not delete custom cluster admin group at the hosted cluster", "group", previousStatus.Group)
 		return err
 	}
-	r.Log.Info("custom cluster admin group created with required permissions and user was added to the group", "username", username)
+	if !r.DryRun {
+		r.Log.Info("access revoked, custom cluster admin group removed", "group", previousStatus.Group)
+	}
 	return nil
 }
 
@@ -209,10 +619,15 @@ func (r *HostedClusterReconciler) addCustomClusterAdminGroup(hostedClient client
 // The function adds cluster-admin rolebinding to the username on the HostedCluster
 func (r *HostedClusterReconciler) addClusterAdminRoleBinding(hostedClient client.Client, username string, hostedClusterObject *v1alpha1.HostedCluster, ctx context.Context) {
 	clusterRoleBinding := composeClusterAdminCRB(username)
-	err := hostedClient.Create(ctx, &clusterRoleBinding)
+	var opts []client.CreateOption
+	if r.DryRun {
+		opts = append(opts, client.DryRunAll)
+	}
+	err := hostedClient.Create(ctx, &clusterRoleBinding, opts...)
 	if err != nil {
 		r.Log.Error(err, "could not add cluster admin to the user")
 	} else {
+		r.auditChange(ctx, hostedClusterObject, audit.ActionCreate, nil, &clusterRoleBinding)
 		r.addClusterAdminAnnotation(username, hostedClusterObject, ctx)
 		r.Log.Info("user received cluster-admin role", "username", username)
 	}
@@ -5,10 +5,15 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/audit"
 	. "github.com/dana-team/permission-granter-controller/testUtils"
 	"github.com/go-logr/logr"
+	userv1 "github.com/openshift/api/user/v1"
 	"github.com/openshift/hypershift/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -292,3 +297,299 @@ func TestHostedClusterReconciler_addClusterAdminRoleBinding(t *testing.T) {
 //		})
 //	}
 //}
+
+func TestHostedClusterReconciler_addCustomClusterAdminGroup(t *testing.T) {
+	type args struct {
+		hostedClient        client.Client
+		hostedClusterObject *v1alpha1.HostedCluster
+		users               []string
+		previousStatus      *access.Status
+		ctx                 context.Context
+	}
+	adoptedHostedCluster := GetHostedClusterObject("test")
+	adoptedHostedCluster.SetAnnotations(map[string]string{adoptAnnotation: "true"})
+	previewHostedCluster := GetHostedClusterObject("test")
+	previewHostedCluster.SetAnnotations(map[string]string{adoptAnnotation: "dry-run"})
+	namedHostedCluster := GetHostedClusterObject("test")
+	namedHostedCluster.SetAnnotations(map[string]string{groupNameAnnotation: "test-admins"})
+	tests := []struct {
+		name             string
+		args             args
+		wantGroup        string
+		wantUsers        []string
+		wantStatusUsers  []string
+		wantDeleted      string
+		dryRun           bool
+		wantAuditRecords int
+		wantErr          bool
+	}{
+		{
+			name: "creates group",
+			args: args{
+				hostedClient:        fake.NewClientBuilder().WithScheme(hostedScheme).Build(),
+				hostedClusterObject: GetHostedClusterObject("test"),
+				users:               []string{"user-test"},
+				ctx:                 context.Background(),
+			},
+			wantGroup:        "custom-cluster-admin",
+			wantUsers:        []string{"user-test"},
+			wantStatusUsers:  []string{"user-test"},
+			wantAuditRecords: 2,
+		},
+		{
+			name: "refuses unmanaged group",
+			args: args{
+				hostedClient:        fake.NewClientBuilder().WithScheme(hostedScheme).WithObjects(GetGroup("custom-cluster-admin", nil, "someone")).Build(),
+				hostedClusterObject: GetHostedClusterObject("test"),
+				users:               []string{"user-test"},
+				ctx:                 context.Background(),
+			},
+			wantGroup: "custom-cluster-admin",
+			wantUsers: []string{"someone"},
+			wantErr:   true,
+		},
+		{
+			name: "updates managed group",
+			args: args{
+				hostedClient:        fake.NewClientBuilder().WithScheme(hostedScheme).WithObjects(GetGroup("custom-cluster-admin", map[string]string{managedByLabel: managedByValue}, "someone")).Build(),
+				hostedClusterObject: GetHostedClusterObject("test"),
+				users:               []string{"user-test"},
+				ctx:                 context.Background(),
+			},
+			wantGroup:        "custom-cluster-admin",
+			wantUsers:        []string{"user-test"},
+			wantStatusUsers:  []string{"user-test"},
+			wantAuditRecords: 2,
+		},
+		{
+			name: "adopts unmanaged group",
+			args: args{
+				hostedClient:        fake.NewClientBuilder().WithScheme(hostedScheme).WithObjects(GetGroup("custom-cluster-admin", nil, "someone")).Build(),
+				hostedClusterObject: adoptedHostedCluster,
+				users:               []string{"user-test"},
+				ctx:                 context.Background(),
+			},
+			wantGroup:        "custom-cluster-admin",
+			wantUsers:        []string{"user-test"},
+			wantStatusUsers:  []string{"user-test"},
+			wantAuditRecords: 2,
+		},
+		{
+			name: "previews adoption of unmanaged group",
+			args: args{
+				hostedClient:        fake.NewClientBuilder().WithScheme(hostedScheme).WithObjects(GetGroup("custom-cluster-admin", nil, "someone")).Build(),
+				hostedClusterObject: previewHostedCluster,
+				users:               []string{"user-test"},
+				ctx:                 context.Background(),
+			},
+			wantGroup: "custom-cluster-admin",
+			wantUsers: []string{"someone"},
+		},
+		{
+			name: "dry run does not create group",
+			args: args{
+				hostedClient:        fake.NewClientBuilder().WithScheme(hostedScheme).Build(),
+				hostedClusterObject: GetHostedClusterObject("test"),
+				users:               []string{"user-test"},
+				ctx:                 context.Background(),
+			},
+			dryRun:    true,
+			wantGroup: "custom-cluster-admin",
+		},
+		{
+			name: "dry run does not adopt group",
+			args: args{
+				hostedClient:        fake.NewClientBuilder().WithScheme(hostedScheme).WithObjects(GetGroup("custom-cluster-admin", nil, "someone")).Build(),
+				hostedClusterObject: adoptedHostedCluster,
+				users:               []string{"user-test"},
+				ctx:                 context.Background(),
+			},
+			dryRun:    true,
+			wantGroup: "custom-cluster-admin",
+			wantUsers: []string{"someone"},
+		},
+		{
+			name: "uses group name annotation",
+			args: args{
+				hostedClient:        fake.NewClientBuilder().WithScheme(hostedScheme).WithObjects(GetGroup("custom-cluster-admin", nil, "someone")).Build(),
+				hostedClusterObject: namedHostedCluster,
+				users:               []string{"user-test"},
+				ctx:                 context.Background(),
+			},
+			wantGroup:        "test-admins",
+			wantUsers:        []string{"user-test"},
+			wantStatusUsers:  []string{"user-test"},
+			wantAuditRecords: 2,
+		},
+		{
+			name: "deletes renamed group",
+			args: args{
+				hostedClient:        fake.NewClientBuilder().WithScheme(hostedScheme).WithObjects(GetGroup("custom-cluster-admin", map[string]string{managedByLabel: managedByValue}, "user-test")).Build(),
+				hostedClusterObject: namedHostedCluster,
+				users:               []string{"user-test"},
+				previousStatus:      &access.Status{Group: "custom-cluster-admin", RBACDefinition: "custom-cluster-admin-access"},
+				ctx:                 context.Background(),
+			},
+			wantGroup:        "test-admins",
+			wantUsers:        []string{"user-test"},
+			wantStatusUsers:  []string{"user-test"},
+			wantDeleted:      "custom-cluster-admin",
+			wantAuditRecords: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditClient := fake.NewClientBuilder().Build()
+			r := &HostedClusterReconciler{
+				Log:    ctrl.Log.WithName("test"),
+				Audit:  &audit.Store{Client: auditClient, Namespace: "audit"},
+				DryRun: tt.dryRun,
+			}
+			status, err := r.withAdoptionPreview(tt.args.hostedClusterObject).addCustomClusterAdminGroup(tt.args.hostedClient, tt.args.hostedClusterObject, tt.args.users, tt.args.previousStatus, tt.args.ctx)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("addCustomClusterAdminGroup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			group := userv1.Group{}
+			if err := tt.args.hostedClient.Get(tt.args.ctx, types.NamespacedName{Name: tt.wantGroup}, &group); err != nil {
+				if tt.wantUsers != nil || !errors.IsNotFound(err) {
+					t.Fatalf("could not get group: %v", err)
+				}
+			}
+			if tt.wantDeleted != "" {
+				if err := tt.args.hostedClient.Get(tt.args.ctx, types.NamespacedName{Name: tt.wantDeleted}, &userv1.Group{}); !errors.IsNotFound(err) {
+					t.Errorf("renamed group %s got error %v, want it deleted", tt.wantDeleted, err)
+				}
+			}
+			if !reflect.DeepEqual(status.Users, tt.wantStatusUsers) {
+				t.Errorf("status users got: %v want %v", status.Users, tt.wantStatusUsers)
+			}
+			if !reflect.DeepEqual([]string(group.Users), tt.wantUsers) {
+				t.Errorf("group users got: %v want %v", group.Users, tt.wantUsers)
+			}
+			auditRecords := corev1.ConfigMapList{}
+			if err := auditClient.List(tt.args.ctx, &auditRecords); err != nil {
+				t.Fatalf("could not list audit records: %v", err)
+			}
+			if len(auditRecords.Items) != tt.wantAuditRecords {
+				t.Errorf("audit records got: %d want %d", len(auditRecords.Items), tt.wantAuditRecords)
+			}
+		})
+	}
+}
+
+func TestNameTemplates_resolveNames(t *testing.T) {
+	labeledHostedCluster := GetHostedClusterObject("test")
+	labeledHostedCluster.SetLabels(map[string]string{"team": "infra"})
+	tests := []struct {
+		name          string
+		templates     NameTemplates
+		hostedCluster *v1alpha1.HostedCluster
+		want          guestObjectNames
+		wantErr       bool
+	}{
+		{
+			name:          "defaults",
+			hostedCluster: GetHostedClusterObject("test"),
+			want:          guestObjectNames{Group: "custom-cluster-admin", RBACDefinition: "custom-cluster-admin-access"},
+		},
+		{
+			name:          "templates",
+			templates:     NameTemplates{Group: `{{ index .Labels "team" }}-{{ .Name }}-admins`, RBACDefinition: "{{ .Name }}-access"},
+			hostedCluster: labeledHostedCluster,
+			want:          guestObjectNames{Group: "infra-test-admins", RBACDefinition: "test-access"},
+		},
+		{
+			name:          "invalid name",
+			templates:     NameTemplates{Group: "Admins_{{ .Name }}"},
+			hostedCluster: GetHostedClusterObject("test"),
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.templates.resolveNames(tt.hostedCluster)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveNames() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("resolveNames() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostedClusterReconciler_removeRevokedMembers(t *testing.T) {
+	managed := map[string]string{managedByLabel: managedByValue}
+	tests := []struct {
+		name            string
+		group           *userv1.Group
+		previousStatus  *access.Status
+		status          access.Status
+		wantUsers       []string
+		wantStatusUsers []string
+		wantUnnotified  []string
+	}{
+		{
+			name:            "removes revoked users",
+			group:           GetGroup("custom-cluster-admin", managed, "alice", "bob"),
+			previousStatus:  &access.Status{Group: "custom-cluster-admin", Users: []string{"alice", "bob"}, Unnotified: []string{"alice", "bob"}},
+			status:          access.Status{LastError: "role profile not found"},
+			wantUsers:       []string{"alice"},
+			wantStatusUsers: []string{"alice"},
+			wantUnnotified:  []string{"alice"},
+		},
+		{
+			name:            "removes every revoked user",
+			group:           GetGroup("custom-cluster-admin", managed, "bob"),
+			previousStatus:  &access.Status{Group: "custom-cluster-admin", Users: []string{"bob"}},
+			status:          access.Status{LastError: "role profile not found"},
+			wantUsers:       []string{},
+			wantStatusUsers: []string{},
+		},
+		{
+			name:           "does not add users",
+			group:          GetGroup("custom-cluster-admin", managed),
+			previousStatus: &access.Status{Group: "custom-cluster-admin"},
+			status:         access.Status{LastError: "role profile not found"},
+		},
+		{
+			name:           "leaves unmanaged group",
+			group:          GetGroup("custom-cluster-admin", nil, "alice", "bob"),
+			previousStatus: &access.Status{Group: "custom-cluster-admin"},
+			status:         access.Status{LastError: "role profile not found"},
+			wantUsers:      []string{"alice", "bob"},
+		},
+		{
+			name:            "group applied by the reconcile",
+			group:           GetGroup("custom-cluster-admin", managed, "alice", "bob"),
+			previousStatus:  &access.Status{Group: "custom-cluster-admin"},
+			status:          access.Status{Group: "custom-cluster-admin", Users: []string{"alice", "bob"}, LastError: "could not verify access"},
+			wantUsers:       []string{"alice", "bob"},
+			wantStatusUsers: []string{"alice", "bob"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			hostedClient := fake.NewClientBuilder().WithScheme(hostedScheme).WithObjects(tt.group).Build()
+			r := &HostedClusterReconciler{Log: ctrl.Log.WithName("test")}
+			status := tt.status
+			if err := r.removeRevokedMembers(ctx, hostedClient, GetHostedClusterObject("test"), []string{"alice"}, tt.previousStatus, &status); err != nil {
+				t.Fatalf("removeRevokedMembers() error = %v", err)
+			}
+			group := userv1.Group{}
+			if err := hostedClient.Get(ctx, types.NamespacedName{Name: tt.group.GetName()}, &group); err != nil {
+				t.Fatalf("could not get group: %v", err)
+			}
+			if len(group.Users) != len(tt.wantUsers) || (len(tt.wantUsers) > 0 && !reflect.DeepEqual([]string(group.Users), tt.wantUsers)) {
+				t.Errorf("group users got: %v want %v", group.Users, tt.wantUsers)
+			}
+			if !reflect.DeepEqual(status.Users, tt.wantStatusUsers) {
+				t.Errorf("status users got: %v want %v", status.Users, tt.wantStatusUsers)
+			}
+			if !reflect.DeepEqual(status.Unnotified, tt.wantUnnotified) {
+				t.Errorf("status unnotified got: %v want %v", status.Unnotified, tt.wantUnnotified)
+			}
+		})
+	}
+}
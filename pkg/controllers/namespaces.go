@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	deleteOnRevokeAnnotation = "dana.io/delete-on-revoke"
+	// namespaceObjectName is the name of the ResourceQuota and LimitRange the controller applies in provisioned namespaces
+	namespaceObjectName = managedByValue
+)
+
+// guestNamespace is a namespace provisioned at the hosted cluster and the quota and limits applied in it,
+// resourceQuota and limitRange are nil when the profile does not set them
+type guestNamespace struct {
+	namespace     *corev1.Namespace
+	resourceQuota *corev1.ResourceQuota
+	limitRange    *corev1.LimitRange
+}
+
+// composeGuestNamespaces gets the namespaces of a role profile and the namespaced name of the HostedCluster
+// The function returns the desired namespaces with their quota and limits, marked as managed by the controller
+func composeGuestNamespaces(namespaces []profiles.Namespace, owner string) []guestNamespace {
+	var desired []guestNamespace
+	for _, namespace := range namespaces {
+		guest := guestNamespace{namespace: &corev1.Namespace{
+			ObjectMeta: v1api.ObjectMeta{
+				Name:        namespace.Name,
+				Labels:      mergeMaps(namespace.Labels, nil),
+				Annotations: mergeMaps(namespace.Annotations, nil),
+			},
+		}}
+		// the annotation is always set so turning deleteOnRevoke off is applied to existing namespaces
+		guest.namespace.Annotations[deleteOnRevokeAnnotation] = strconv.FormatBool(namespace.DeleteOnRevoke)
+		setManaged(guest.namespace, owner)
+		if namespace.ResourceQuota != nil {
+			guest.resourceQuota = &corev1.ResourceQuota{
+				ObjectMeta: v1api.ObjectMeta{Name: namespaceObjectName, Namespace: namespace.Name},
+				Spec:       *namespace.ResourceQuota.DeepCopy(),
+			}
+			setManaged(guest.resourceQuota, owner)
+		}
+		if namespace.LimitRange != nil {
+			guest.limitRange = &corev1.LimitRange{
+				ObjectMeta: v1api.ObjectMeta{Name: namespaceObjectName, Namespace: namespace.Name},
+				Spec:       *namespace.LimitRange.DeepCopy(),
+			}
+			setManaged(guest.limitRange, owner)
+		}
+		desired = append(desired, guest)
+	}
+	return desired
+}
+
+// provisionNamespaces gets HostedCluster client, the HostedCluster, the desired namespaces and context
+// The function creates or updates the namespaces, and the quota and limits in them, at the hosted cluster.
+// A quota or limits the profile no longer sets are deleted if the controller created them.
+// In a dry run the quota and limits of a namespace that does not exist yet are reported without a request, the API server
+// rejects objects in a namespace the dry run did not create
+func (r *HostedClusterReconciler) provisionNamespaces(ctx context.Context, hostedClient client.Client, hostedCluster *v1alpha1.HostedCluster, namespaces []guestNamespace) error {
+	for _, guest := range namespaces {
+		name := guest.namespace.GetName()
+		newNamespace := false
+		if r.DryRun {
+			if err := hostedClient.Get(ctx, client.ObjectKeyFromObject(guest.namespace), &corev1.Namespace{}); err != nil {
+				if !apierrors.IsNotFound(err) {
+					return err
+				}
+				newNamespace = true
+			}
+		}
+		r.Propagation.apply(hostedCluster, guest.namespace)
+		if err := r.applyGuestObject(ctx, hostedClient, hostedCluster, guest.namespace); err != nil {
+			r.Log.Error(err, "could not provision namespace at the hosted cluster", "namespace", name)
+			return err
+		}
+		if newNamespace {
+			var objects []client.Object
+			if guest.resourceQuota != nil {
+				objects = append(objects, guest.resourceQuota)
+			}
+			if guest.limitRange != nil {
+				objects = append(objects, guest.limitRange)
+			}
+			for _, object := range objects {
+				if err := r.reportDryRun(hostedCluster, nil, object); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		var err error
+		if guest.resourceQuota != nil {
+			err = r.applyGuestObject(ctx, hostedClient, hostedCluster, guest.resourceQuota)
+		} else {
+			err = r.deleteGuestObject(ctx, hostedClient, hostedCluster, &corev1.ResourceQuota{ObjectMeta: v1api.ObjectMeta{Name: namespaceObjectName, Namespace: name}})
+		}
+		if err != nil {
+			r.Log.Error(err, "could not apply resource quota at the hosted cluster", "namespace", name)
+			return err
+		}
+		if guest.limitRange != nil {
+			err = r.applyGuestObject(ctx, hostedClient, hostedCluster, guest.limitRange)
+		} else {
+			err = r.deleteGuestObject(ctx, hostedClient, hostedCluster, &corev1.LimitRange{ObjectMeta: v1api.ObjectMeta{Name: namespaceObjectName, Namespace: name}})
+		}
+		if err != nil {
+			r.Log.Error(err, "could not apply limit range at the hosted cluster", "namespace", name)
+			return err
+		}
+	}
+	return nil
+}
+
+// removeNamespaces gets HostedCluster client, the HostedCluster and context
+// The function deletes the namespaces provisioned for the HostedCluster by a profile that asked to delete them on revoke.
+// The annotation on the namespace is used, not the current profile, so namespaces are deleted even if the profile changed
+func (r *HostedClusterReconciler) removeNamespaces(ctx context.Context, hostedClient client.Client, hostedCluster *v1alpha1.HostedCluster) error {
+	namespaces := corev1.NamespaceList{}
+	if err := hostedClient.List(ctx, &namespaces, client.MatchingLabels{managedByLabel: managedByValue}); err != nil {
+		return err
+	}
+	hostedClusterName := hostedCluster.GetNamespace() + "/" + hostedCluster.GetName()
+	for i := range namespaces.Items {
+		namespace := &namespaces.Items[i]
+		annotations := namespace.GetAnnotations()
+		if annotations[hostedClusterAnnotation] != hostedClusterName || annotations[deleteOnRevokeAnnotation] != "true" {
+			continue
+		}
+		if err := r.deleteGuestObject(ctx, hostedClient, hostedCluster, namespace); err != nil {
+			r.Log.Error(err, "could not delete namespace at the hosted cluster", "namespace", namespace.GetName())
+			return err
+		}
+	}
+	return nil
+}
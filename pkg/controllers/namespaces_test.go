@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHostedClusterReconciler_provisionNamespaces(t *testing.T) {
+	ctx := context.Background()
+	hostedClient := fake.NewClientBuilder().WithScheme(hostedScheme).Build()
+	hostedCluster := GetHostedClusterObject("test")
+	hostedCluster.SetAnnotations(map[string]string{requesterAnnotation: "alice"})
+	quota := &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("10")}}
+	limits := &corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+		Type:    corev1.LimitTypeContainer,
+		Default: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+	}}}
+
+	tests := []struct {
+		name           string
+		namespaces     []profiles.Namespace
+		revoke         bool
+		wantNamespaces map[string]bool
+		wantQuota      bool
+		wantLimitRange bool
+	}{
+		{
+			name: "creates namespaces with quota and limits",
+			namespaces: []profiles.Namespace{
+				{Name: "apps", Labels: map[string]string{"team": "developers"}, ResourceQuota: quota, LimitRange: limits, DeleteOnRevoke: true},
+				{Name: "shared"},
+			},
+			wantNamespaces: map[string]bool{"apps": true, "shared": true},
+			wantQuota:      true,
+			wantLimitRange: true,
+		},
+		{
+			name: "removes quota the profile no longer sets",
+			namespaces: []profiles.Namespace{
+				{Name: "apps", Labels: map[string]string{"team": "developers"}, LimitRange: limits, DeleteOnRevoke: true},
+				{Name: "shared"},
+			},
+			wantNamespaces: map[string]bool{"apps": true, "shared": true},
+			wantLimitRange: true,
+		},
+		{
+			name:           "deletes namespaces marked for deletion on revoke",
+			revoke:         true,
+			wantNamespaces: map[string]bool{"apps": false, "shared": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := &profiles.RoleProfile{Name: "developers", Namespaces: tt.namespaces}
+			r := &HostedClusterReconciler{Log: ctrl.Log.WithName("test"), Profile: profile}
+			if tt.revoke {
+				if err := r.removeCustomClusterAdminGroup(hostedClient, hostedCluster, &access.Status{Group: "test-admins"}, ctx); err != nil {
+					t.Fatalf("removeCustomClusterAdminGroup() error = %v", err)
+				}
+			} else {
+				status, err := r.addCustomClusterAdminGroup(hostedClient, hostedCluster, []string{"alice"}, nil, ctx)
+				if err != nil {
+					t.Fatalf("addCustomClusterAdminGroup() error = %v", err)
+				}
+				if len(status.Namespaces) != len(tt.namespaces) {
+					t.Errorf("status namespaces got: %v", status.Namespaces)
+				}
+			}
+			for name, want := range tt.wantNamespaces {
+				namespace := corev1.Namespace{}
+				err := hostedClient.Get(ctx, types.NamespacedName{Name: name}, &namespace)
+				if want && err != nil {
+					t.Errorf("namespace %s: %v", name, err)
+				}
+				if !want && !errors.IsNotFound(err) {
+					t.Errorf("namespace %s should be deleted, got %v", name, err)
+				}
+				if want && name == "apps" && namespace.GetLabels()["team"] != "developers" {
+					t.Errorf("namespace %s labels got: %v", name, namespace.GetLabels())
+				}
+			}
+			if tt.revoke {
+				return
+			}
+			key := types.NamespacedName{Namespace: "apps", Name: namespaceObjectName}
+			if err := hostedClient.Get(ctx, key, &corev1.ResourceQuota{}); (err == nil) != tt.wantQuota {
+				t.Errorf("resource quota exists: %v want %v", err == nil, tt.wantQuota)
+			}
+			if err := hostedClient.Get(ctx, key, &corev1.LimitRange{}); (err == nil) != tt.wantLimitRange {
+				t.Errorf("limit range exists: %v want %v", err == nil, tt.wantLimitRange)
+			}
+		})
+	}
+}
+
+// namespaceCheckingClient rejects namespaced objects created in a namespace that does not exist, like the API server
+type namespaceCheckingClient struct {
+	client.Client
+}
+
+func (c namespaceCheckingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if obj.GetNamespace() != "" {
+		if err := c.Client.Get(ctx, types.NamespacedName{Name: obj.GetNamespace()}, &corev1.Namespace{}); err != nil {
+			return err
+		}
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestHostedClusterReconciler_provisionNamespacesDryRun(t *testing.T) {
+	ctx := context.Background()
+	hostedCluster := GetHostedClusterObject("test")
+	quota := &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("10")}}
+	namespaces := composeGuestNamespaces([]profiles.Namespace{{Name: "apps", ResourceQuota: quota}}, "clusters/test")
+	existing := &corev1.Namespace{ObjectMeta: v1api.ObjectMeta{Name: "apps"}}
+	setManaged(existing, "clusters/test")
+
+	tests := []struct {
+		name       string
+		namespaces []client.Object
+		wantEvent  string
+	}{
+		{
+			name:      "new namespace",
+			wantEvent: "Normal DryRun ResourceQuota " + namespaceObjectName + " would change",
+		},
+		{
+			name:       "existing namespace",
+			namespaces: []client.Object{existing},
+			wantEvent:  "Normal DryRun ResourceQuota " + namespaceObjectName + " would change",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostedClient := namespaceCheckingClient{fake.NewClientBuilder().WithScheme(hostedScheme).WithObjects(tt.namespaces...).Build()}
+			recorder := record.NewFakeRecorder(10)
+			r := &HostedClusterReconciler{Log: ctrl.Log.WithName("test"), DryRun: true, Recorder: recorder}
+			if err := r.provisionNamespaces(ctx, hostedClient, hostedCluster, namespaces); err != nil {
+				t.Fatalf("provisionNamespaces() error = %v", err)
+			}
+			if err := hostedClient.Get(ctx, types.NamespacedName{Namespace: "apps", Name: namespaceObjectName}, &corev1.ResourceQuota{}); !errors.IsNotFound(err) {
+				t.Errorf("dry run created the resource quota: %v", err)
+			}
+			close(recorder.Events)
+			found := false
+			for event := range recorder.Events {
+				found = found || strings.HasPrefix(event, tt.wantEvent)
+			}
+			if !found {
+				t.Errorf("no event starting with %q", tt.wantEvent)
+			}
+		})
+	}
+}
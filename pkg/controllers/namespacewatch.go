@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/dana-team/permission-granter-controller/pkg/policy"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	"github.com/dana-team/permission-granter-controller/pkg/utils"
+	rbacmanagerv1beta1 "github.com/fairwindsops/rbac-manager/pkg/apis/rbacmanager/v1beta1"
+	"github.com/go-logr/logr"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// resolveNamespaceRoleBindings gets HostedCluster client, the namespace role bindings of a profile, the protected namespaces and context
+// The function returns a role binding for every namespace of the hosted cluster each binding selects, sorted by namespace,
+// and the protected namespaces a binding selected, which are left out. Terminating namespaces are skipped
+func resolveNamespaceRoleBindings(ctx context.Context, hostedClient client.Client, bindings []profiles.NamespaceRoleBinding, protected policy.ProtectedNamespaces) ([]rbacmanagerv1beta1.RoleBinding, []string, error) {
+	if len(bindings) == 0 {
+		return nil, nil, nil
+	}
+	namespaces := corev1.NamespaceList{}
+	if err := hostedClient.List(ctx, &namespaces); err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(namespaces.Items, func(i, j int) bool { return namespaces.Items[i].Name < namespaces.Items[j].Name })
+	var roleBindings []rbacmanagerv1beta1.RoleBinding
+	excluded := make(map[string]bool)
+	for _, binding := range bindings {
+		for _, namespace := range namespaces.Items {
+			if namespace.Status.Phase == corev1.NamespaceTerminating || namespace.DeletionTimestamp != nil {
+				continue
+			}
+			matched, err := binding.Matches(namespace.Name, namespace.Labels)
+			if err != nil {
+				return nil, nil, err
+			}
+			if matched && protected.Protects(namespace.Name) {
+				excluded[namespace.Name] = true
+			} else if matched {
+				roleBindings = append(roleBindings, rbacmanagerv1beta1.RoleBinding{
+					ClusterRole: binding.ClusterRole,
+					Role:        binding.Role,
+					Namespace:   namespace.Name,
+				})
+			}
+		}
+	}
+	var excludedNames []string
+	for name := range excluded {
+		excludedNames = append(excludedNames, name)
+	}
+	sort.Strings(excludedNames)
+	return roleBindings, excludedNames, nil
+}
+
+// namespaceWatches watches the namespaces of the hosted clusters whose profile selects namespaces dynamically,
+// and sends an event for the HostedCluster whenever a namespace is created, deleted or relabeled.
+// rbac-manager watches namespaces for the namespaceSelector of its RoleBindings too, but a label selector cannot match
+// the namespacePattern of a binding, nor leave out the protected namespaces, which are shell patterns on names and can
+// carry any label. The controller resolves the bindings to one RoleBinding per namespace instead, checking every namespace
+// against the protected namespaces, and this watch keeps them resolved as namespaces change.
+// A watch is stopped once the HostedCluster is gone, nobody has access to it anymore, its profile no longer selects
+// namespaces dynamically, or the manager stops
+type namespaceWatches struct {
+	mu      sync.Mutex
+	cancels map[types.NamespacedName]context.CancelFunc
+	events  chan event.GenericEvent
+	// clientset returns the clientset of the hosted cluster, by default one built from its kubeconfig secret
+	clientset func(hostedCluster *v1alpha1.HostedCluster) (kubernetes.Interface, error)
+	log       logr.Logger
+}
+
+// newNamespaceWatches returns watches building hosted cluster clientsets with the management cluster client
+func newNamespaceWatches(c client.Client, log logr.Logger) *namespaceWatches {
+	return &namespaceWatches{
+		cancels: make(map[types.NamespacedName]context.CancelFunc),
+		events:  make(chan event.GenericEvent),
+		clientset: func(hostedCluster *v1alpha1.HostedCluster) (kubernetes.Interface, error) {
+			config, err := utils.GetHostedKubeRestConfig(c, hostedCluster.GetName())
+			if err != nil {
+				return nil, err
+			}
+			return kubernetes.NewForConfig(config)
+		},
+		log: log,
+	}
+}
+
+// watch starts watching the namespaces of the hosted cluster, it does nothing if they are already watched
+func (w *namespaceWatches) watch(hostedCluster *v1alpha1.HostedCluster) error {
+	key := types.NamespacedName{Namespace: hostedCluster.GetNamespace(), Name: hostedCluster.GetName()}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.cancels[key]; ok {
+		return nil
+	}
+	clientset, err := w.clientset(hostedCluster)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	informer := factory.Core().V1().Namespaces().Informer()
+	enqueue := func() {
+		// the namespaces listed when the watch starts are already covered by the reconcile that started it
+		if !informer.HasSynced() {
+			return
+		}
+		object := &v1alpha1.HostedCluster{}
+		object.SetNamespace(key.Namespace)
+		object.SetName(key.Name)
+		select {
+		case w.events <- event.GenericEvent{Object: object}:
+		case <-ctx.Done():
+		}
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { enqueue() },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNamespace, oldOk := oldObj.(*corev1.Namespace)
+			newNamespace, newOk := newObj.(*corev1.Namespace)
+			if !oldOk || !newOk || !reflect.DeepEqual(oldNamespace.Labels, newNamespace.Labels) ||
+				oldNamespace.Status.Phase != newNamespace.Status.Phase {
+				enqueue()
+			}
+		},
+		DeleteFunc: func(interface{}) { enqueue() },
+	})
+	factory.Start(ctx.Done())
+	w.cancels[key] = cancel
+	w.log.Info("watching hosted cluster namespaces", "hosted cluster", key.String())
+	return nil
+}
+
+// stop stops watching the namespaces of the hosted cluster
+func (w *namespaceWatches) stop(key types.NamespacedName) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if cancel, ok := w.cancels[key]; ok {
+		cancel()
+		delete(w.cancels, key)
+		w.log.Info("stopped watching hosted cluster namespaces", "hosted cluster", key.String())
+	}
+}
+
+// stopAll stops every watch, it is called when the manager stops
+func (w *namespaceWatches) stopAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for key, cancel := range w.cancels {
+		cancel()
+		delete(w.cancels, key)
+	}
+}
+
+// watchNamespaces gets the HostedCluster and the profile given to it
+// The function keeps the namespaces of the hosted cluster watched while the profile selects namespaces dynamically
+func (r *HostedClusterReconciler) watchNamespaces(hostedCluster *v1alpha1.HostedCluster, profile *profiles.RoleProfile) error {
+	if r.namespaceWatches == nil {
+		return nil
+	}
+	if len(profile.NamespaceRoleBindings) == 0 {
+		r.namespaceWatches.stop(types.NamespacedName{Namespace: hostedCluster.GetNamespace(), Name: hostedCluster.GetName()})
+		return nil
+	}
+	return r.namespaceWatches.watch(hostedCluster)
+}
+
+// stopWatchingNamespaces stops watching the namespaces of the hosted cluster, if they are watched
+func (r *HostedClusterReconciler) stopWatchingNamespaces(key types.NamespacedName) {
+	if r.namespaceWatches != nil {
+		r.namespaceWatches.stop(key)
+	}
+}
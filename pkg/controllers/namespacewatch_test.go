@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/policy"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	rbacmanagerv1beta1 "github.com/fairwindsops/rbac-manager/pkg/apis/rbacmanager/v1beta1"
+	"github.com/go-logr/logr"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestResolveNamespaceRoleBindings(t *testing.T) {
+	namespaces := []*corev1.Namespace{
+		{ObjectMeta: v1api.ObjectMeta{Name: "team-b", Labels: map[string]string{"env": "dev"}}},
+		{ObjectMeta: v1api.ObjectMeta{Name: "team-a", Labels: map[string]string{"env": "prod"}}},
+		{ObjectMeta: v1api.ObjectMeta{Name: "team-old"}, Status: corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating}},
+		{ObjectMeta: v1api.ObjectMeta{Name: "kube-system"}},
+	}
+	hostedClient := fake.NewClientBuilder().WithScheme(hostedScheme).
+		WithObjects(namespaces[0], namespaces[1], namespaces[2], namespaces[3]).Build()
+
+	tests := []struct {
+		name         string
+		bindings     []profiles.NamespaceRoleBinding
+		want         []rbacmanagerv1beta1.RoleBinding
+		wantExcluded []string
+	}{
+		{name: "no bindings"},
+		{
+			name:     "pattern",
+			bindings: []profiles.NamespaceRoleBinding{{ClusterRole: "edit", NamespacePattern: "team-*"}},
+			want: []rbacmanagerv1beta1.RoleBinding{
+				{ClusterRole: "edit", Namespace: "team-a"},
+				{ClusterRole: "edit", Namespace: "team-b"},
+			},
+		},
+		{
+			name: "selector",
+			bindings: []profiles.NamespaceRoleBinding{
+				{Role: "deployer", NamespaceSelector: &v1api.LabelSelector{MatchLabels: map[string]string{"env": "dev"}}},
+			},
+			want: []rbacmanagerv1beta1.RoleBinding{{Role: "deployer", Namespace: "team-b"}},
+		},
+		{
+			name:     "leaves out protected namespaces",
+			bindings: []profiles.NamespaceRoleBinding{{ClusterRole: "view", NamespacePattern: "*"}},
+			want: []rbacmanagerv1beta1.RoleBinding{
+				{ClusterRole: "view", Namespace: "team-a"},
+				{ClusterRole: "view", Namespace: "team-b"},
+			},
+			wantExcluded: []string{"kube-system"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, excluded, err := resolveNamespaceRoleBindings(context.Background(), hostedClient, tt.bindings, policy.DefaultProtectedNamespaces)
+			if err != nil {
+				t.Fatalf("resolveNamespaceRoleBindings() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveNamespaceRoleBindings() got %+v want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(excluded, tt.wantExcluded) {
+				t.Errorf("resolveNamespaceRoleBindings() excluded %v want %v", excluded, tt.wantExcluded)
+			}
+		})
+	}
+}
+
+func TestNamespaceWatches(t *testing.T) {
+	clientset := kubefake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1api.ObjectMeta{Name: "existing"}})
+	watches := &namespaceWatches{
+		cancels: make(map[types.NamespacedName]context.CancelFunc),
+		events:  make(chan event.GenericEvent),
+		clientset: func(*v1alpha1.HostedCluster) (kubernetes.Interface, error) {
+			return clientset, nil
+		},
+		log: logr.Discard(),
+	}
+	defer watches.stopAll()
+	hostedCluster := GetHostedClusterObject("test")
+	hostedCluster.SetNamespace("clusters")
+	if err := watches.watch(hostedCluster); err != nil {
+		t.Fatalf("watch() error = %v", err)
+	}
+	if err := watches.watch(hostedCluster); err != nil || len(watches.cancels) != 1 {
+		t.Fatalf("watch() twice error = %v watches %d", err, len(watches.cancels))
+	}
+
+	// the informer delivers its initial list asynchronously, give it time to sync before creating a namespace
+	time.Sleep(100 * time.Millisecond)
+	_, err := clientset.CoreV1().Namespaces().Create(context.Background(),
+		&corev1.Namespace{ObjectMeta: v1api.ObjectMeta{Name: "team-a"}}, v1api.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-watches.events:
+		if e.Object.GetName() != "test" || e.Object.GetNamespace() != "clusters" {
+			t.Errorf("event for %s/%s", e.Object.GetNamespace(), e.Object.GetName())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event for the created namespace")
+	}
+
+	watches.stop(types.NamespacedName{Namespace: "clusters", Name: "test"})
+	if len(watches.cancels) != 0 {
+		t.Errorf("watch was not stopped")
+	}
+}
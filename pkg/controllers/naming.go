@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/openshift/hypershift/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	groupNameAnnotation          = "dana.io/custom-admin-group-name"
+	rbacDefinitionNameAnnotation = "dana.io/custom-admin-rbacdefinition-name"
+)
+
+// NameTemplates holds the go templates used to name the objects the controller creates at the HostedCluster.
+// The templates are executed with the HostedCluster object, so {{ .Name }}, {{ .Namespace }} and
+// {{ index .Labels "key" }} can be used
+type NameTemplates struct {
+	Group          string
+	RBACDefinition string
+}
+
+// DefaultNameTemplates keeps the names the controller used before the names became configurable
+var DefaultNameTemplates = NameTemplates{
+	Group:          "custom-cluster-admin",
+	RBACDefinition: "custom-cluster-admin-access",
+}
+
+// Validate parses both templates and returns an error if one of them is not a valid go template
+func (t NameTemplates) Validate() error {
+	for _, tmpl := range []string{t.Group, t.RBACDefinition} {
+		if _, err := template.New("name").Option("missingkey=error").Parse(tmpl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// guestObjectNames are the names of the objects the controller manages at a single HostedCluster
+type guestObjectNames struct {
+	Group          string
+	RBACDefinition string
+}
+
+// resolveNames gets a HostedCluster and returns the names of the group and RBACDefinition for it.
+// A name set by annotation on the HostedCluster overrides the name rendered from the template
+func (t NameTemplates) resolveNames(hostedCluster *v1alpha1.HostedCluster) (guestObjectNames, error) {
+	templates := t
+	if templates.Group == "" {
+		templates.Group = DefaultNameTemplates.Group
+	}
+	if templates.RBACDefinition == "" {
+		templates.RBACDefinition = DefaultNameTemplates.RBACDefinition
+	}
+	groupName, err := resolveName(hostedCluster, groupNameAnnotation, templates.Group)
+	if err != nil {
+		return guestObjectNames{}, err
+	}
+	rbacDefinitionName, err := resolveName(hostedCluster, rbacDefinitionNameAnnotation, templates.RBACDefinition)
+	if err != nil {
+		return guestObjectNames{}, err
+	}
+	return guestObjectNames{Group: groupName, RBACDefinition: rbacDefinitionName}, nil
+}
+
+// resolveName returns the value of the annotation if it is set on the HostedCluster, otherwise it renders the template.
+// The result must be a valid object name
+func resolveName(hostedCluster *v1alpha1.HostedCluster, annotation string, nameTemplate string) (string, error) {
+	name, ok := hostedCluster.GetAnnotations()[annotation]
+	if !ok {
+		tmpl, err := template.New(annotation).Option("missingkey=error").Parse(nameTemplate)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, hostedCluster); err != nil {
+			return "", err
+		}
+		name = buf.String()
+	}
+	name = strings.TrimSpace(name)
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", fmt.Errorf("invalid name %q for %s: %s", name, annotation, strings.Join(errs, ", "))
+	}
+	return name, nil
+}
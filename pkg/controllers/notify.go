@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/notify"
+	"github.com/dana-team/permission-granter-controller/pkg/utils"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultConsoleURLTemplate renders the web console URL of an OpenShift hosted cluster, it is empty without a base domain
+var DefaultConsoleURLTemplate = `{{ with .Spec.DNS.BaseDomain }}https://console-openshift-console.apps.{{ $.Name }}.{{ . }}{{ end }}`
+
+// ValidateConsoleURLTemplate returns an error if the console URL template cannot be parsed
+func ValidateConsoleURLTemplate(consoleURLTemplate string) error {
+	_, err := template.New("console-url").Option("missingkey=error").Parse(consoleURLTemplate)
+	return err
+}
+
+// unnotifiedUsers gets the access status the HostedCluster reported before the reconcile and the applied status
+// The function returns the users of the applied status that were not notified of their access yet
+func (r *HostedClusterReconciler) unnotifiedUsers(previousStatus *access.Status, status access.Status) []string {
+	if r.Notifier == nil || r.DryRun {
+		return nil
+	}
+	notified := make(map[string]bool)
+	if previousStatus != nil {
+		for _, user := range previousStatus.Users {
+			notified[user] = true
+		}
+		for _, user := range previousStatus.Unnotified {
+			delete(notified, user)
+		}
+	}
+	var unnotified []string
+	for _, user := range status.Users {
+		if !notified[user] {
+			unnotified = append(unnotified, user)
+		}
+	}
+	return unnotified
+}
+
+// notifyGranted gets the HostedCluster, the access status it reported before the reconcile, the applied status and context
+// The function notifies every user of the custom cluster admin group that was not notified yet, once the access passed
+// verification. It is called only after the applied status was persisted, so users are not notified again when the
+// status could not be written. A failed notification is logged and emitted as an event, it does not fail the reconcile.
+// The function returns the users whose notification failed
+func (r *HostedClusterReconciler) notifyGranted(ctx context.Context, hostedCluster *v1alpha1.HostedCluster, previousStatus *access.Status, status access.Status) []string {
+	if status.Verification != nil && !status.Verification.Passed {
+		return nil
+	}
+	added := r.unnotifiedUsers(previousStatus, status)
+	if len(added) == 0 {
+		return nil
+	}
+
+	apiURL, err := r.hostedAPIURL(hostedCluster)
+	if err != nil {
+		r.Log.Error(err, "could not get the API URL of the hosted cluster", "hosted cluster", hostedCluster.GetName())
+	}
+	consoleURL, err := r.consoleURL(hostedCluster)
+	if err != nil {
+		r.Log.Error(err, "could not render the console URL of the hosted cluster", "hosted cluster", hostedCluster.GetName())
+	}
+	grants, _ := access.GetGrants(hostedCluster)
+	var failed []string
+	for _, user := range added {
+		notification := notify.Notification{
+			User:       user,
+			Cluster:    hostedCluster.GetName(),
+			Namespace:  hostedCluster.GetNamespace(),
+			APIURL:     apiURL,
+			ConsoleURL: consoleURL,
+			Profile:    status.Profile,
+		}
+		for _, grant := range grants {
+			if grant.User != user {
+				continue
+			}
+			notification.GrantedBy = grant.GrantedBy
+			if grant.ExpiresAt != nil {
+				expiresAt := grant.ExpiresAt.Time
+				notification.ExpiresAt = &expiresAt
+			}
+		}
+		if err := r.Notifier.Notify(ctx, notification); err != nil {
+			r.Log.Error(err, "could not notify user of granted access", "hosted cluster", hostedCluster.GetName(), "user", user)
+			if r.Recorder != nil {
+				r.Recorder.Eventf(hostedCluster, corev1.EventTypeWarning, "NotificationFailed", "could not notify %s: %v", user, err)
+			}
+			failed = append(failed, user)
+			continue
+		}
+		r.Log.Info("user notified of granted access", "hosted cluster", hostedCluster.GetName(), "user", user)
+	}
+	return failed
+}
+
+// recordUnnotified gets the HostedCluster, the access status persisted by the reconcile, the users whose notification
+// failed and context
+// The function records the users as unnotified in the status of the HostedCluster, so they are notified on the next reconcile
+func (r *HostedClusterReconciler) recordUnnotified(ctx context.Context, hostedCluster *v1alpha1.HostedCluster, status access.Status, failed []string) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	unnotified := status
+	unnotified.Unnotified = failed
+	return r.updateAccessStatus(ctx, hostedCluster, &status, unnotified)
+}
+
+// hostedAPIURL returns the API server URL of the HostedCluster from its kubeconfig,
+// or from the control plane endpoint it reports when the kubeconfig cannot be read
+func (r *HostedClusterReconciler) hostedAPIURL(hostedCluster *v1alpha1.HostedCluster) (string, error) {
+	apiURL, err := utils.GetHostedAPIURL(r.Client, hostedCluster.GetName())
+	if err == nil && apiURL != "" {
+		return apiURL, nil
+	}
+	if endpoint := hostedCluster.Status.ControlPlaneEndpoint; endpoint.Host != "" {
+		return fmt.Sprintf("https://%s:%d", endpoint.Host, endpoint.Port), nil
+	}
+	return "", err
+}
+
+// consoleURL renders the console URL template with the HostedCluster
+func (r *HostedClusterReconciler) consoleURL(hostedCluster *v1alpha1.HostedCluster) (string, error) {
+	consoleURLTemplate := r.ConsoleURLTemplate
+	if consoleURLTemplate == "" {
+		consoleURLTemplate = DefaultConsoleURLTemplate
+	}
+	parsed, err := template.New("console-url").Option("missingkey=error").Parse(consoleURLTemplate)
+	if err != nil {
+		return "", err
+	}
+	consoleURL := bytes.Buffer{}
+	if err := parsed.Execute(&consoleURL, hostedCluster); err != nil {
+		return "", err
+	}
+	return consoleURL.String(), nil
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/notify"
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type recordingNotifier struct {
+	notifications []notify.Notification
+}
+
+func (r *recordingNotifier) Notify(_ context.Context, notification notify.Notification) error {
+	r.notifications = append(r.notifications, notification)
+	return nil
+}
+
+// failingNotifier fails the notifications of the given users once
+type failingNotifier struct {
+	recordingNotifier
+	failing map[string]bool
+}
+
+func (f *failingNotifier) Notify(ctx context.Context, notification notify.Notification) error {
+	if f.failing[notification.User] {
+		delete(f.failing, notification.User)
+		return errors.New("mail server unavailable")
+	}
+	return f.recordingNotifier.Notify(ctx, notification)
+}
+
+func TestHostedClusterReconciler_recordUnnotified(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+	hostedCluster := GetHostedClusterObject("test")
+	notifier := &failingNotifier{failing: map[string]bool{"alice": true}}
+	r := &HostedClusterReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(hostedCluster).Build(),
+		Log:      ctrl.Log.WithName("test"),
+		Notifier: notifier,
+	}
+	// reconcile persists the status, then notifies the users and records the ones whose notification failed
+	reconcile := func() []string {
+		previousStatus, err := access.GetStatus(hostedCluster)
+		if err != nil {
+			t.Fatalf("could not read status: %v", err)
+		}
+		status := access.Status{Group: "custom-cluster-admin", Profile: "default", Users: []string{"alice", "bob"}}
+		if err := r.updateAccessStatus(ctx, hostedCluster, previousStatus, status); err != nil {
+			t.Fatalf("updateAccessStatus() error = %v", err)
+		}
+		failed := r.notifyGranted(ctx, hostedCluster, previousStatus, status)
+		if err := r.recordUnnotified(ctx, hostedCluster, status, failed); err != nil {
+			t.Fatalf("recordUnnotified() error = %v", err)
+		}
+		return failed
+	}
+
+	if failed := reconcile(); !reflect.DeepEqual(failed, []string{"alice"}) {
+		t.Errorf("failed notifications got: %v want [alice]", failed)
+	}
+	status, _ := access.GetStatus(hostedCluster)
+	if status == nil || !reflect.DeepEqual(status.Unnotified, []string{"alice"}) {
+		t.Fatalf("status got: %+v want alice unnotified", status)
+	}
+	if failed := reconcile(); len(failed) != 0 {
+		t.Errorf("failed notifications got: %v want none", failed)
+	}
+	status, _ = access.GetStatus(hostedCluster)
+	if status == nil || len(status.Unnotified) != 0 {
+		t.Errorf("status got: %+v want nobody unnotified", status)
+	}
+	var users []string
+	for _, notification := range notifier.notifications {
+		users = append(users, notification.User)
+	}
+	if !reflect.DeepEqual(users, []string{"bob", "alice"}) {
+		t.Errorf("notified users got: %v want [bob alice]", users)
+	}
+	if failed := reconcile(); len(failed) != 0 || len(notifier.notifications) != 2 {
+		t.Errorf("notified %d times once everybody was notified, want 2", len(notifier.notifications))
+	}
+}
+
+func TestHostedClusterReconciler_notifyGranted(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+	hostedCluster := GetHostedClusterObject("test")
+	hostedCluster.SetNamespace("clusters")
+	hostedCluster.SetAnnotations(map[string]string{
+		access.GrantsAnnotation: `[{"user":"alice","grantedBy":"admin","grantedAt":"2022-10-01T10:00:00Z"}]`,
+	})
+	hostedCluster.Spec.DNS.BaseDomain = "example.com"
+	hostedCluster.Status.ControlPlaneEndpoint.Host = "api.test.example.com"
+	hostedCluster.Status.ControlPlaneEndpoint.Port = 6443
+
+	tests := []struct {
+		name           string
+		previousStatus *access.Status
+		status         access.Status
+		dryRun         bool
+		want           []notify.Notification
+	}{
+		{
+			name:   "notifies added users",
+			status: access.Status{Profile: "default", Users: []string{"alice"}},
+			want: []notify.Notification{{
+				User:       "alice",
+				Cluster:    "test",
+				Namespace:  "clusters",
+				APIURL:     "https://api.test.example.com:6443",
+				ConsoleURL: "https://console-openshift-console.apps.test.example.com",
+				Profile:    "default",
+				GrantedBy:  "admin",
+			}},
+		},
+		{
+			name:           "does not notify users that already had access",
+			previousStatus: &access.Status{Users: []string{"alice"}},
+			status:         access.Status{Profile: "default", Users: []string{"alice"}},
+		},
+		{
+			name:   "does not notify before the access passed verification",
+			status: access.Status{Profile: "default", Users: []string{"alice"}, Verification: &access.Verification{}},
+		},
+		{
+			name:           "notifies users left unnotified once the access passed verification",
+			previousStatus: &access.Status{Users: []string{"alice"}, Unnotified: []string{"alice"}},
+			status:         access.Status{Profile: "default", Users: []string{"alice"}, Verification: &access.Verification{Passed: true}},
+			want: []notify.Notification{{
+				User:       "alice",
+				Cluster:    "test",
+				Namespace:  "clusters",
+				APIURL:     "https://api.test.example.com:6443",
+				ConsoleURL: "https://console-openshift-console.apps.test.example.com",
+				Profile:    "default",
+				GrantedBy:  "admin",
+			}},
+		},
+		{
+			name:   "dry run does not notify",
+			status: access.Status{Profile: "default", Users: []string{"alice"}},
+			dryRun: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &recordingNotifier{}
+			r := &HostedClusterReconciler{
+				Client:   fake.NewClientBuilder().WithScheme(scheme).Build(),
+				Log:      ctrl.Log.WithName("test"),
+				Notifier: notifier,
+				DryRun:   tt.dryRun,
+			}
+			r.notifyGranted(context.Background(), hostedCluster, tt.previousStatus, tt.status)
+			if !reflect.DeepEqual(notifier.notifications, tt.want) {
+				t.Errorf("notifications got: %+v want %+v", notifier.notifications, tt.want)
+			}
+		})
+	}
+}
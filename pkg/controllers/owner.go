@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	ownerTeamAnnotation     = "dana.io/owner-team"
+	ownerContactAnnotation  = "dana.io/owner-contact"
+	ownerObjectName         = "cluster-owner"
+	consoleNotificationKind = schema.GroupVersionKind{Group: "console.openshift.io", Version: "v1", Kind: "ConsoleNotification"}
+)
+
+// ownerInfo describes who owns a hosted cluster
+type ownerInfo struct {
+	Requester string
+	Team      string
+	Contact   string
+}
+
+// getOwnerInfo gets HostedCluster and returns its owners from the requester, owner team and owner contact annotations.
+// The second return value is false when the HostedCluster has none of them
+func getOwnerInfo(hostedCluster *v1alpha1.HostedCluster) (ownerInfo, bool) {
+	annotations := hostedCluster.GetAnnotations()
+	info := ownerInfo{
+		Requester: access.GetRequester(hostedCluster),
+		Team:      strings.TrimSpace(annotations[ownerTeamAnnotation]),
+		Contact:   strings.TrimSpace(annotations[ownerContactAnnotation]),
+	}
+	return info, info.Requester != "" || info.Team != "" || info.Contact != ""
+}
+
+// text returns a single line describing the owners
+func (o ownerInfo) text(clusterName string) string {
+	var parts []string
+	if o.Team != "" {
+		parts = append(parts, "owned by "+o.Team)
+	}
+	if o.Requester != "" {
+		parts = append(parts, "requested by "+o.Requester)
+	}
+	if o.Contact != "" {
+		parts = append(parts, "contact: "+o.Contact)
+	}
+	return fmt.Sprintf("Cluster %s: %s", clusterName, strings.Join(parts, ", "))
+}
+
+// contactLink returns a link to the contact, a mailto link for email addresses, empty when the contact is not a link
+func (o ownerInfo) contactLink() string {
+	switch {
+	case strings.HasPrefix(o.Contact, "https://"), strings.HasPrefix(o.Contact, "http://"), strings.HasPrefix(o.Contact, "mailto:"):
+		return o.Contact
+	case strings.Contains(o.Contact, "@") && !strings.ContainsAny(o.Contact, " /"):
+		return "mailto:" + o.Contact
+	}
+	return ""
+}
+
+// composeOwnerConfigMap returns the ConfigMap publishing the owners of the hosted cluster in namespace
+func composeOwnerConfigMap(namespace string, clusterName string, info ownerInfo) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: v1api.ObjectMeta{
+			Name:      ownerObjectName,
+			Namespace: namespace,
+		},
+		Data: map[string]string{
+			"cluster":   clusterName,
+			"requester": info.Requester,
+			"team":      info.Team,
+			"contact":   info.Contact,
+		},
+	}
+}
+
+// composeOwnerConsoleNotification returns the OpenShift console banner showing the owners of the hosted cluster
+func composeOwnerConsoleNotification(clusterName string, info ownerInfo) *unstructured.Unstructured {
+	consoleNotification := &unstructured.Unstructured{}
+	consoleNotification.SetGroupVersionKind(consoleNotificationKind)
+	consoleNotification.SetName(ownerObjectName)
+	spec := map[string]interface{}{
+		"text":            info.text(clusterName),
+		"location":        "BannerTop",
+		"color":           "#fff",
+		"backgroundColor": "#0066cc",
+	}
+	if link := info.contactLink(); link != "" {
+		spec["link"] = map[string]interface{}{"href": link, "text": "Contact the owners"}
+	}
+	consoleNotification.Object["spec"] = spec
+	return consoleNotification
+}
+
+// publishOwnerInfo gets HostedCluster client, the HostedCluster and context
+// The function keeps the owner ConfigMap in the owner namespace, and the console banner on OpenShift hosted clusters,
+// in sync with the owner annotations of the HostedCluster. They are removed once the HostedCluster has no owner annotations
+func (r *HostedClusterReconciler) publishOwnerInfo(ctx context.Context, hostedClient client.Client, hostedCluster *v1alpha1.HostedCluster) error {
+	if r.OwnerNamespace == "" {
+		return nil
+	}
+	info, ok := getOwnerInfo(hostedCluster)
+	if !ok {
+		return r.removeOwnerInfo(ctx, hostedClient, hostedCluster)
+	}
+	hostedClusterName := hostedCluster.GetNamespace() + "/" + hostedCluster.GetName()
+	configMap := composeOwnerConfigMap(r.OwnerNamespace, hostedCluster.GetName(), info)
+	setManaged(configMap, hostedClusterName)
+	if err := r.applyGuestObject(ctx, hostedClient, hostedCluster, configMap); err != nil {
+		return err
+	}
+	consoleNotification := composeOwnerConsoleNotification(hostedCluster.GetName(), info)
+	setManaged(consoleNotification, hostedClusterName)
+	if err := r.applyGuestObject(ctx, hostedClient, hostedCluster, consoleNotification); err != nil && !isMissingKind(err) {
+		return err
+	}
+	return nil
+}
+
+// removeOwnerInfo gets HostedCluster client, the HostedCluster and context
+// The function deletes the owner ConfigMap and console banner from the hosted cluster
+func (r *HostedClusterReconciler) removeOwnerInfo(ctx context.Context, hostedClient client.Client, hostedCluster *v1alpha1.HostedCluster) error {
+	if r.OwnerNamespace == "" {
+		return nil
+	}
+	configMap := &corev1.ConfigMap{ObjectMeta: v1api.ObjectMeta{Name: ownerObjectName, Namespace: r.OwnerNamespace}}
+	if err := r.deleteGuestObject(ctx, hostedClient, hostedCluster, configMap); err != nil {
+		return err
+	}
+	consoleNotification := &unstructured.Unstructured{}
+	consoleNotification.SetGroupVersionKind(consoleNotificationKind)
+	consoleNotification.SetName(ownerObjectName)
+	if err := r.deleteGuestObject(ctx, hostedClient, hostedCluster, consoleNotification); err != nil && !isMissingKind(err) {
+		return err
+	}
+	return nil
+}
+
+// isMissingKind returns true if the error means the hosted cluster does not serve the kind, e.g. a ConsoleNotification
+// on a hosted cluster that is not OpenShift
+func isMissingKind(err error) bool {
+	return meta.IsNoMatchError(err) || runtime.IsNotRegisteredError(err)
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHostedClusterReconciler_publishOwnerInfo(t *testing.T) {
+	ctx := context.Background()
+	hostedClient := fake.NewClientBuilder().WithScheme(hostedScheme).Build()
+	r := &HostedClusterReconciler{Log: ctrl.Log.WithName("test"), OwnerNamespace: "kube-public"}
+	hostedCluster := GetHostedClusterObject("test")
+	hostedCluster.SetNamespace("clusters")
+
+	tests := []struct {
+		name            string
+		annotations     map[string]string
+		wantData        map[string]string
+		wantBannerText  string
+		wantBannerLink  string
+		wantNotFoundErr bool
+	}{
+		{
+			name: "publishes owners",
+			annotations: map[string]string{
+				access.RequesterAnnotation: "alice",
+				ownerTeamAnnotation:        "platform",
+				ownerContactAnnotation:     "platform@example.com",
+			},
+			wantData:       map[string]string{"cluster": "test", "requester": "alice", "team": "platform", "contact": "platform@example.com"},
+			wantBannerText: "Cluster test: owned by platform, requested by alice, contact: platform@example.com",
+			wantBannerLink: "mailto:platform@example.com",
+		},
+		{
+			name: "follows owner changes",
+			annotations: map[string]string{
+				access.RequesterAnnotation: " bob ",
+				ownerContactAnnotation:     "https://chat.example.com/platform",
+			},
+			wantData:       map[string]string{"cluster": "test", "requester": "bob", "team": "", "contact": "https://chat.example.com/platform"},
+			wantBannerText: "Cluster test: requested by bob, contact: https://chat.example.com/platform",
+			wantBannerLink: "https://chat.example.com/platform",
+		},
+		{
+			name:            "removes owners",
+			annotations:     map[string]string{},
+			wantNotFoundErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostedCluster.SetAnnotations(tt.annotations)
+			if err := r.publishOwnerInfo(ctx, hostedClient, hostedCluster); err != nil {
+				t.Fatalf("publishOwnerInfo() error = %v", err)
+			}
+			configMap := corev1.ConfigMap{}
+			err := hostedClient.Get(ctx, types.NamespacedName{Namespace: "kube-public", Name: ownerObjectName}, &configMap)
+			banner := &unstructured.Unstructured{}
+			banner.SetGroupVersionKind(consoleNotificationKind)
+			bannerErr := hostedClient.Get(ctx, types.NamespacedName{Name: ownerObjectName}, banner)
+			if tt.wantNotFoundErr {
+				if !errors.IsNotFound(err) || !errors.IsNotFound(bannerErr) {
+					t.Fatalf("expected owner objects to be removed, got %v, %v", err, bannerErr)
+				}
+				return
+			}
+			if err != nil || bannerErr != nil {
+				t.Fatalf("could not get owner objects: %v, %v", err, bannerErr)
+			}
+			for key, value := range tt.wantData {
+				if configMap.Data[key] != value {
+					t.Errorf("%s got: %q want %q", key, configMap.Data[key], value)
+				}
+			}
+			if !isManaged(&configMap) || !isManaged(banner) {
+				t.Errorf("owner objects are not labeled as managed")
+			}
+			if text, _, _ := unstructured.NestedString(banner.Object, "spec", "text"); text != tt.wantBannerText {
+				t.Errorf("banner text got: %q want %q", text, tt.wantBannerText)
+			}
+			if link, _, _ := unstructured.NestedString(banner.Object, "spec", "link", "href"); link != tt.wantBannerLink {
+				t.Errorf("banner link got: %q want %q", link, tt.wantBannerLink)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dana-team/permission-granter-controller/pkg/audit"
+	"github.com/dana-team/permission-granter-controller/pkg/utils"
+
+	"github.com/openshift/hypershift/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+var (
+	managedByLabel          = "app.kubernetes.io/managed-by"
+	managedByValue          = "permission-granter-controller"
+	hostedClusterAnnotation = "dana.io/hostedcluster"
+	adoptAnnotation         = "dana.io/adopt-existing"
+	adoptModeApply          = "true"
+	adoptModeDryRun         = "dry-run"
+	errNotManaged           = errors.New("object exists at the hosted cluster and is not managed by the controller")
+	hostedScheme            = utils.HostedScheme
+)
+
+// isManaged returns true if the object carries the managed-by label of the controller
+func isManaged(obj client.Object) bool {
+	return obj.GetLabels()[managedByLabel] == managedByValue
+}
+
+// setManaged gets an object and the namespaced name of the HostedCluster it belongs to
+// The function marks the object as managed by the controller
+func setManaged(obj client.Object, hostedClusterName string) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[managedByLabel] = managedByValue
+	obj.SetLabels(labels)
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[hostedClusterAnnotation] = hostedClusterName
+	obj.SetAnnotations(annotations)
+}
+
+// adoptionMode gets a HostedCluster and returns how existing objects that are not managed by the controller are treated
+func adoptionMode(hostedCluster *v1alpha1.HostedCluster) string {
+	switch mode := hostedCluster.GetAnnotations()[adoptAnnotation]; mode {
+	case adoptModeApply, adoptModeDryRun:
+		return mode
+	}
+	return ""
+}
+
+// applyGuestObject gets HostedCluster client, the HostedCluster, the desired object and context
+// The function creates the object at the HostedCluster, or updates it if it already exists, is managed by the controller and differs.
+// An existing object that is not managed by the controller is left untouched unless the HostedCluster is annotated for adoption,
+// in which case its previous contents are recorded before it is labeled and reconciled to the desired state.
+// When the reconciler runs in dry-run mode the requests are sent as server-side dry-run and the resulting changes are reported
+func (r *HostedClusterReconciler) applyGuestObject(ctx context.Context, hostedClient client.Client, hostedCluster *v1alpha1.HostedCluster, desired client.Object) error {
+	existing := desired.DeepCopyObject().(client.Object)
+	if err := hostedClient.Get(ctx, client.ObjectKeyFromObject(desired), existing); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		if r.DryRun {
+			if err := hostedClient.Create(ctx, desired, client.DryRunAll); err != nil {
+				return err
+			}
+			return r.reportDryRun(hostedCluster, nil, desired)
+		}
+		if err := hostedClient.Create(ctx, desired); err != nil {
+			return err
+		}
+		r.auditChange(ctx, hostedCluster, audit.ActionCreate, nil, desired)
+		return nil
+	}
+	adopted, preview := false, false
+	if !isManaged(existing) {
+		switch adoptionMode(hostedCluster) {
+		case adoptModeDryRun:
+			preview = true
+		case adoptModeApply:
+			if !r.DryRun {
+				if err := r.recordAdoption(ctx, hostedCluster, existing, desired); err != nil {
+					return err
+				}
+			}
+			adopted = true
+		default:
+			return fmt.Errorf("%w: %s", errNotManaged, desired.GetName())
+		}
+	}
+	labels := mergeMaps(existing.GetLabels(), desired.GetLabels())
+	annotations := mergeMaps(existing.GetAnnotations(), desired.GetAnnotations())
+	dropStalePropagated(existing, desired, labels, annotations)
+	desired.SetLabels(labels)
+	desired.SetAnnotations(annotations)
+	desired.SetResourceVersion(existing.GetResourceVersion())
+	if preview {
+		return r.previewAdoption(hostedCluster, existing, desired)
+	}
+	if r.DryRun {
+		if err := hostedClient.Update(ctx, desired, client.DryRunAll); err != nil {
+			return err
+		}
+		return r.reportDryRun(hostedCluster, existing, desired)
+	}
+	changes, err := utils.DiffObjects(existing, desired)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 && !adopted {
+		return nil
+	}
+	if err := hostedClient.Update(ctx, desired); err != nil {
+		return err
+	}
+	// an adoption was recorded before the update so the previous contents are kept even if the update fails
+	if !adopted && len(changes) > 0 {
+		r.auditChange(ctx, hostedCluster, audit.ActionUpdate, existing, desired)
+	}
+	return nil
+}
+
+// completeAdoption gets the HostedCluster and context
+// The function removes the adoption annotation once a reconcile applied every object, adoption is given once so objects
+// created later under the same names, e.g. by a tenant of the hosted cluster, are not taken over silently
+func (r *HostedClusterReconciler) completeAdoption(ctx context.Context, hostedCluster *v1alpha1.HostedCluster) error {
+	if r.DryRun || adoptionMode(hostedCluster) != adoptModeApply {
+		return nil
+	}
+	patch := client.MergeFrom(hostedCluster.DeepCopy())
+	annotations := mergeMaps(hostedCluster.GetAnnotations(), nil)
+	delete(annotations, adoptAnnotation)
+	hostedCluster.SetAnnotations(annotations)
+	if err := r.Client.Patch(ctx, hostedCluster, patch); err != nil {
+		return err
+	}
+	r.Log.Info("adoption completed, adoption annotation removed", "hosted cluster", hostedCluster.GetName())
+	return nil
+}
+
+// deleteGuestObject gets HostedCluster client, the HostedCluster, the object to delete and context
+// The function deletes the object from the HostedCluster if it exists and is managed by the controller
+func (r *HostedClusterReconciler) deleteGuestObject(ctx context.Context, hostedClient client.Client, hostedCluster *v1alpha1.HostedCluster, obj client.Object) error {
+	if err := hostedClient.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !isManaged(obj) {
+		r.Log.Info("not deleting object that is not managed by the controller", "hosted cluster", hostedCluster.GetName(),
+			"kind", objectKind(obj), "name", obj.GetName())
+		return nil
+	}
+	if r.DryRun {
+		if err := hostedClient.Delete(ctx, obj, client.DryRunAll); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		r.Log.Info("dry run", "hosted cluster", hostedCluster.GetName(), "kind", objectKind(obj), "name", obj.GetName(), "changes", "object will be deleted")
+		if r.Recorder != nil {
+			r.Recorder.Eventf(hostedCluster, corev1.EventTypeNormal, "DryRun", "%s %s would be deleted", objectKind(obj), obj.GetName())
+		}
+		return nil
+	}
+	if err := hostedClient.Delete(ctx, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	r.auditChange(ctx, hostedCluster, audit.ActionDelete, obj, nil)
+	return nil
+}
+
+// reportDryRun gets the HostedCluster, the current object (nil if it does not exist) and the object returned by the dry-run request
+// The function logs the changes the request would have made and emits them as an event on the HostedCluster
+func (r *HostedClusterReconciler) reportDryRun(hostedCluster *v1alpha1.HostedCluster, existing client.Object, result client.Object) error {
+	var current runtime.Object
+	if existing != nil {
+		current = existing
+	}
+	changes, err := utils.DiffObjects(current, result)
+	if err != nil {
+		return err
+	}
+	kind := objectKind(result)
+	if len(changes) == 0 {
+		r.Log.V(1).Info("dry run: no changes", "hosted cluster", hostedCluster.GetName(), "kind", kind, "name", result.GetName())
+		return nil
+	}
+	r.Log.Info("dry run", "hosted cluster", hostedCluster.GetName(), "kind", kind, "name", result.GetName(), "changes", changes)
+	if r.Recorder != nil {
+		r.Recorder.Eventf(hostedCluster, corev1.EventTypeNormal, "DryRun", "%s %s would change: %s",
+			kind, result.GetName(), strings.Join(changes, "; "))
+	}
+	return nil
+}
+
+// withAdoptionPreview gets the HostedCluster being reconciled and returns the reconciler to reconcile it with.
+// A HostedCluster annotated to preview adoption is reconciled as a dry-run, so neither the objects adoption would take over
+// nor the objects created alongside them are changed at the hosted cluster
+func (r *HostedClusterReconciler) withAdoptionPreview(hostedCluster *v1alpha1.HostedCluster) *HostedClusterReconciler {
+	if r.DryRun || adoptionMode(hostedCluster) != adoptModeDryRun {
+		return r
+	}
+	preview := *r
+	preview.DryRun = true
+	return &preview
+}
+
+// previewAdoption gets the HostedCluster, an existing unmanaged object and its desired state merged with the labels and
+// annotations of the existing object. The function reports the changes adoption would make without modifying the object
+func (r *HostedClusterReconciler) previewAdoption(hostedCluster *v1alpha1.HostedCluster, existing client.Object, desired client.Object) error {
+	changes, err := utils.DiffObjects(existing, desired)
+	if err != nil {
+		return err
+	}
+	kind := objectKind(desired)
+	r.Log.Info("adoption preview", "hosted cluster", hostedCluster.GetName(), "kind", kind, "name", desired.GetName(), "changes", changes)
+	if r.Recorder != nil {
+		r.Recorder.Eventf(hostedCluster, corev1.EventTypeNormal, "AdoptionPreview", "adopting %s %s would change: %s",
+			kind, desired.GetName(), strings.Join(changes, "; "))
+	}
+	return nil
+}
+
+// recordAdoption gets the HostedCluster, an existing unmanaged object and its desired state
+// The function writes an audit record holding the contents of the object before the controller took it over
+func (r *HostedClusterReconciler) recordAdoption(ctx context.Context, hostedCluster *v1alpha1.HostedCluster, existing client.Object, desired client.Object) error {
+	kind := objectKind(desired)
+	if r.Audit != nil {
+		record, err := r.newAuditRecord(hostedCluster, audit.ActionAdopt, existing, desired)
+		if err != nil {
+			return err
+		}
+		if err := r.Audit.Write(ctx, record); err != nil {
+			r.Log.Error(err, "could not write adoption audit record", "kind", kind, "name", desired.GetName())
+			return err
+		}
+	}
+	r.Log.Info("adopting existing object", "hosted cluster", hostedCluster.GetName(), "kind", kind, "name", desired.GetName())
+	if r.Recorder != nil {
+		r.Recorder.Eventf(hostedCluster, corev1.EventTypeNormal, "Adopted", "adopted existing %s %s", kind, desired.GetName())
+	}
+	return nil
+}
+
+// objectKind returns the kind of a typed object using the hosted cluster scheme
+func objectKind(obj client.Object) string {
+	gvk, err := apiutil.GVKForObject(obj, hostedScheme)
+	if err != nil {
+		return fmt.Sprintf("%T", obj)
+	}
+	return gvk.Kind
+}
+
+// mergeMaps returns a new map with the keys of base overridden by the keys of override
+func mergeMaps(base map[string]string, override map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dana-team/permission-granter-controller/pkg/audit"
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// updateCountingClient counts the updates sent to the hosted cluster
+type updateCountingClient struct {
+	client.Client
+	updates *int
+}
+
+func (c updateCountingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	*c.updates++
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func TestHostedClusterReconciler_applyGuestObject(t *testing.T) {
+	managed := map[string]string{managedByLabel: managedByValue}
+	tests := []struct {
+		name        string
+		users       []string
+		wantUpdates int
+	}{
+		{name: "unchanged group", users: []string{"alice"}},
+		{name: "changed group", users: []string{"alice", "bob"}, wantUpdates: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			hostedCluster := GetHostedClusterObject("test")
+			existing := GetGroup("custom-cluster-admin", managed, "alice")
+			setManaged(existing, "/test")
+			updates := 0
+			hostedClient := updateCountingClient{Client: fake.NewClientBuilder().WithScheme(hostedScheme).WithObjects(existing).Build(), updates: &updates}
+			auditClient := fake.NewClientBuilder().Build()
+			r := &HostedClusterReconciler{Log: ctrl.Log.WithName("test"), Audit: &audit.Store{Client: auditClient, Namespace: "audit"}}
+			desired := composeCustomClusterAdminGroup("custom-cluster-admin", tt.users)
+			setManaged(&desired, "/test")
+			if err := r.applyGuestObject(ctx, hostedClient, hostedCluster, &desired); err != nil {
+				t.Fatalf("applyGuestObject() error = %v", err)
+			}
+			if updates != tt.wantUpdates {
+				t.Errorf("updates got: %d want %d", updates, tt.wantUpdates)
+			}
+		})
+	}
+}
+
+func TestHostedClusterReconciler_completeAdoption(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+	tests := []struct {
+		name           string
+		mode           string
+		dryRun         bool
+		wantAnnotation bool
+	}{
+		{name: "adoption is given once", mode: adoptModeApply},
+		{name: "preview is kept", mode: adoptModeDryRun, wantAnnotation: true},
+		{name: "dry run keeps adoption", mode: adoptModeApply, dryRun: true, wantAnnotation: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			hostedCluster := GetHostedClusterObject("test")
+			hostedCluster.SetAnnotations(map[string]string{adoptAnnotation: tt.mode, "team": "infra"})
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(hostedCluster).Build()
+			r := &HostedClusterReconciler{Client: c, Log: ctrl.Log.WithName("test"), DryRun: tt.dryRun}
+			if err := r.completeAdoption(ctx, hostedCluster); err != nil {
+				t.Fatalf("completeAdoption() error = %v", err)
+			}
+			got := &v1alpha1.HostedCluster{}
+			if err := c.Get(ctx, types.NamespacedName{Namespace: hostedCluster.GetNamespace(), Name: hostedCluster.GetName()}, got); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := got.GetAnnotations()[adoptAnnotation]; ok != tt.wantAnnotation {
+				t.Errorf("adoption annotation kept: %t want %t", ok, tt.wantAnnotation)
+			}
+			if got.GetAnnotations()["team"] != "infra" {
+				t.Errorf("other annotations got: %v", got.GetAnnotations())
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/policy"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	rbacmanagerv1beta1 "github.com/fairwindsops/rbac-manager/pkg/apis/rbacmanager/v1beta1"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var errPolicyViolation = errors.New("role profile hands out permissions amounting to cluster-admin")
+
+// profileViolations gets HostedCluster client, the role profile, the binding the profile results in, the protected namespaces,
+// whether objects of a resource live in a namespace and context
+// The function returns the escalations found in the effective rules of the profile: the ClusterRoles it declares and every
+// ClusterRole and Role it binds. Declared ClusterRoles are checked as declared and, once they exist, as aggregated at the
+// hosted cluster. It returns apart the rules of roles bound cluster wide that modify namespaced objects, since that reaches
+// the protected namespaces. Referenced roles that do not exist at the hosted cluster grant nothing and are skipped
+func profileViolations(ctx context.Context, hostedClient client.Reader, profile *profiles.RoleProfile, binding *rbacmanagerv1beta1.RBACBinding, protected policy.ProtectedNamespaces, resourceNamespaced func(group string, resource string) bool) ([]policy.Violation, []policy.Violation, error) {
+	var violations, protectedViolations []policy.Violation
+	checked := make(map[string]bool)
+	checkClusterRole := func(name string, namespaced bool) error {
+		key := fmt.Sprintf("ClusterRole/%s/%t", name, namespaced)
+		if checked[key] {
+			return nil
+		}
+		checked[key] = true
+		clusterRole := rbacv1.ClusterRole{}
+		if err := hostedClient.Get(ctx, types.NamespacedName{Name: name}, &clusterRole); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		violations = append(violations, policy.Check("ClusterRole/"+name, clusterRole.Rules, namespaced)...)
+		if !namespaced {
+			protectedViolations = append(protectedViolations, protected.CheckClusterWide("ClusterRole/"+name, clusterRole.Rules, resourceNamespaced)...)
+		}
+		return nil
+	}
+	declared := make(map[string]profiles.ClusterRole)
+	for _, clusterRole := range profile.ClusterRoles {
+		declared[clusterRole.Name] = clusterRole
+		// a declared ClusterRole may be aggregated into roles bound cluster wide, it is checked as such
+		violations = append(violations, policy.Check("ClusterRole/"+clusterRole.Name, clusterRole.Rules, false)...)
+		if clusterRole.AggregationRule != nil {
+			if err := checkClusterRole(clusterRole.Name, false); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	for _, clusterRoleBinding := range binding.ClusterRoleBindings {
+		if clusterRole, ok := declared[clusterRoleBinding.ClusterRole]; ok {
+			protectedViolations = append(protectedViolations, protected.CheckClusterWide("ClusterRole/"+clusterRole.Name, clusterRole.Rules, resourceNamespaced)...)
+			continue
+		}
+		if err := checkClusterRole(clusterRoleBinding.ClusterRole, false); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, roleBinding := range binding.RoleBindings {
+		if roleBinding.ClusterRole != "" {
+			if _, ok := declared[roleBinding.ClusterRole]; ok {
+				continue
+			}
+			if err := checkClusterRole(roleBinding.ClusterRole, true); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		name := roleBinding.Namespace + "/" + roleBinding.Role
+		if checked["Role/"+name] {
+			continue
+		}
+		checked["Role/"+name] = true
+		role := rbacv1.Role{}
+		if err := hostedClient.Get(ctx, types.NamespacedName{Namespace: roleBinding.Namespace, Name: roleBinding.Role}, &role); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, nil, err
+		}
+		violations = append(violations, policy.Check("Role/"+name, role.Rules, true)...)
+	}
+	return violations, protectedViolations, nil
+}
+
+// enforceProfilePolicy gets HostedCluster client, the HostedCluster, the role profile, the binding it results in, the
+// access status and context
+// The function returns an error wrapping errPolicyViolation, and reports the violations in the status and as an event,
+// when the profile hands out permissions amounting to cluster-admin and is not marked privileged. Roles the profile binds
+// cluster wide that reach the protected namespaces are reported apart and fail with an error wrapping policy.ErrProtectedNamespace
+func (r *HostedClusterReconciler) enforceProfilePolicy(ctx context.Context, hostedClient client.Client, hostedCluster *v1alpha1.HostedCluster, profile *profiles.RoleProfile, binding *rbacmanagerv1beta1.RBACBinding, status *access.Status) error {
+	violations, protectedViolations, err := profileViolations(ctx, hostedClient, profile, binding, r.ProtectedNamespaces, namespacedResource(hostedClient.RESTMapper()))
+	if err != nil {
+		r.Log.Error(err, "could not check the role profile for privilege escalation")
+		return err
+	}
+	if len(violations) == 0 && len(protectedViolations) == 0 {
+		return nil
+	}
+	if profile.Privileged {
+		r.Log.V(1).Info("privileged role profile hands out escalating permissions", "hosted cluster", hostedCluster.GetName(),
+			"profile", profile.Name, "violations", policy.Strings(append(violations, protectedViolations...)))
+		return nil
+	}
+	var protectedErr error
+	if len(protectedViolations) > 0 {
+		protectedErr = r.rejectProtected(hostedCluster, profile, status, policy.Strings(protectedViolations))
+	}
+	if len(violations) > 0 {
+		return r.rejectProfile(hostedCluster, profile, status, policy.Strings(violations))
+	}
+	return protectedErr
+}
+
+// namespacedResource returns whether objects of a resource live in a namespace by the RESTMapper of the hosted cluster,
+// resources it cannot map are looked up in the built-in resources
+func namespacedResource(mapper meta.RESTMapper) func(group string, resource string) bool {
+	return func(group string, resource string) bool {
+		if mapper != nil {
+			if kind, err := mapper.KindFor(schema.GroupVersionResource{Group: group, Resource: resource}); err == nil {
+				if mapping, err := mapper.RESTMapping(kind.GroupKind(), kind.Version); err == nil {
+					return mapping.Scope.Name() == meta.RESTScopeNameNamespace
+				}
+			}
+		}
+		return policy.Namespaced(group, resource)
+	}
+}
+
+// rejectProfile gets the HostedCluster, the role profile, the access status and the violations found in the profile
+// The function reports the violations in the status and as an event and returns an error wrapping errPolicyViolation
+func (r *HostedClusterReconciler) rejectProfile(hostedCluster *v1alpha1.HostedCluster, profile *profiles.RoleProfile, status *access.Status, text []string) error {
+	status.Violations = text
+	r.Log.Info("role profile rejected", "hosted cluster", hostedCluster.GetName(), "profile", profile.Name, "violations", text)
+	if r.Recorder != nil {
+		r.Recorder.Eventf(hostedCluster, corev1.EventTypeWarning, "PolicyViolation", "role profile %s rejected: %s",
+			profile.Name, strings.Join(text, "; "))
+	}
+	return fmt.Errorf("%w: profile %s: %s", errPolicyViolation, profile.Name, strings.Join(text, "; "))
+}
+
+// rejectProtected gets the HostedCluster, the role profile, the access status and the ways the profile reaches protected namespaces
+// The function reports them in the status and as an event and returns an error wrapping policy.ErrProtectedNamespace
+func (r *HostedClusterReconciler) rejectProtected(hostedCluster *v1alpha1.HostedCluster, profile *profiles.RoleProfile, status *access.Status, text []string) error {
+	status.Protected = text
+	r.Log.Info("role profile reaches protected namespaces", "hosted cluster", hostedCluster.GetName(), "profile", profile.Name, "violations", text)
+	if r.Recorder != nil {
+		r.Recorder.Eventf(hostedCluster, corev1.EventTypeWarning, "ProtectedNamespaceViolation", "role profile %s rejected: %s",
+			profile.Name, strings.Join(text, "; "))
+	}
+	return fmt.Errorf("%w: profile %s: %s", policy.ErrProtectedNamespace, profile.Name, strings.Join(text, "; "))
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/policy"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	rbacmanagerv1beta1 "github.com/fairwindsops/rbac-manager/pkg/apis/rbacmanager/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHostedClusterReconciler_enforceProfilePolicy(t *testing.T) {
+	clusterAdmin := &rbacv1.ClusterRole{
+		ObjectMeta: v1api.ObjectMeta{Name: "cluster-admin"},
+		Rules:      []rbacv1.PolicyRule{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}}},
+	}
+	edit := &rbacv1.ClusterRole{
+		ObjectMeta: v1api.ObjectMeta{Name: "edit"},
+		Rules: []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"create", "delete"}},
+			{APIGroups: []string{""}, Resources: []string{"serviceaccounts"}, Verbs: []string{"impersonate"}},
+		},
+	}
+	podWriter := &rbacv1.ClusterRole{
+		ObjectMeta: v1api.ObjectMeta{Name: "pod-writer"},
+		Rules:      []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"create"}}},
+	}
+	nodeLabeler := &rbacv1.ClusterRole{
+		ObjectMeta: v1api.ObjectMeta{Name: "node-labeler"},
+		Rules:      []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get", "patch"}}},
+	}
+	hostedClient := fake.NewClientBuilder().WithScheme(hostedScheme).WithObjects(clusterAdmin, edit, podWriter, nodeLabeler).Build()
+	r := &HostedClusterReconciler{Log: ctrl.Log.WithName("test")}
+	protectedReconciler := &HostedClusterReconciler{Log: ctrl.Log.WithName("test"), ProtectedNamespaces: policy.DefaultProtectedNamespaces}
+
+	tests := []struct {
+		name           string
+		profile        *profiles.RoleProfile
+		protected      bool
+		wantViolations int
+		wantProtected  int
+		wantErr        error
+	}{
+		{
+			name:    "default profile",
+			profile: &profiles.DefaultRoleProfile,
+		},
+		{
+			name: "binds cluster-admin",
+			profile: &profiles.RoleProfile{Name: "admins",
+				ClusterRoleBindings: []rbacmanagerv1beta1.ClusterRoleBinding{{ClusterRole: "cluster-admin"}}},
+			wantViolations: 2,
+			wantErr:        errPolicyViolation,
+		},
+		{
+			name: "binds edit cluster wide",
+			profile: &profiles.RoleProfile{Name: "editors",
+				ClusterRoleBindings: []rbacmanagerv1beta1.ClusterRoleBinding{{ClusterRole: "edit"}}},
+			wantViolations: 1,
+			wantErr:        errPolicyViolation,
+		},
+		{
+			name: "declares an escalating cluster role",
+			profile: &profiles.RoleProfile{Name: "binders", ClusterRoles: []profiles.ClusterRole{{
+				Name:  "binder",
+				Rules: []rbacv1.PolicyRule{{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"clusterroles"}, Verbs: []string{"bind"}}},
+			}}},
+			wantViolations: 1,
+			wantErr:        errPolicyViolation,
+		},
+		{
+			name: "binds a writing role cluster wide with protected namespaces",
+			profile: &profiles.RoleProfile{Name: "editors",
+				ClusterRoleBindings: []rbacmanagerv1beta1.ClusterRoleBinding{{ClusterRole: "edit"}}},
+			protected:      true,
+			wantViolations: 1,
+			wantProtected:  1,
+			wantErr:        errPolicyViolation,
+		},
+		{
+			name: "binds a role writing pods cluster wide with protected namespaces",
+			profile: &profiles.RoleProfile{Name: "pod-writers",
+				ClusterRoleBindings: []rbacmanagerv1beta1.ClusterRoleBinding{{ClusterRole: "pod-writer"}}},
+			protected:     true,
+			wantProtected: 1,
+			wantErr:       policy.ErrProtectedNamespace,
+		},
+		{
+			name: "binds a role writing cluster scoped resources cluster wide with protected namespaces",
+			profile: &profiles.RoleProfile{Name: "node-labelers",
+				ClusterRoleBindings: []rbacmanagerv1beta1.ClusterRoleBinding{{ClusterRole: "node-labeler"}}},
+			protected: true,
+		},
+		{
+			name: "binds a writing role in a namespace with protected namespaces",
+			profile: &profiles.RoleProfile{Name: "editors",
+				RoleBindings: []rbacmanagerv1beta1.RoleBinding{{Namespace: "apps", ClusterRole: "edit"}}},
+			protected: true,
+		},
+		{
+			name: "privileged profile",
+			profile: &profiles.RoleProfile{Name: "admins", Privileged: true,
+				ClusterRoleBindings: []rbacmanagerv1beta1.ClusterRoleBinding{{ClusterRole: "cluster-admin"}}},
+		},
+		{
+			name: "missing role",
+			profile: &profiles.RoleProfile{Name: "missing",
+				ClusterRoleBindings: []rbacmanagerv1beta1.ClusterRoleBinding{{ClusterRole: "does-not-exist"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binding := composeCustomAdminRBACDefinition("rbac", "group", tt.profile).RBACBindings[0]
+			status := access.Status{}
+			reconciler := r
+			if tt.protected {
+				reconciler = protectedReconciler
+			}
+			err := reconciler.enforceProfilePolicy(context.Background(), hostedClient, GetHostedClusterObject("test"), tt.profile, &binding, &status)
+			if (err != nil) != (tt.wantErr != nil) || (err != nil && !errors.Is(err, tt.wantErr)) {
+				t.Fatalf("enforceProfilePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(status.Violations) != tt.wantViolations {
+				t.Errorf("violations got: %q want %d", status.Violations, tt.wantViolations)
+			}
+			if len(status.Protected) != tt.wantProtected {
+				t.Errorf("protected namespace violations got: %q want %d", status.Protected, tt.wantProtected)
+			}
+		})
+	}
+}
+
+func TestComposeGuestObjects_protectedNamespaces(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile *profiles.RoleProfile
+		wantErr bool
+	}{
+		{name: "default profile", profile: &profiles.DefaultRoleProfile},
+		{
+			name: "role binding into a protected namespace",
+			profile: &profiles.RoleProfile{Name: "developers",
+				RoleBindings: []rbacmanagerv1beta1.RoleBinding{{Namespace: "kube-system", ClusterRole: "edit"}}},
+			wantErr: true,
+		},
+		{
+			name: "role binding by a namespace selector",
+			profile: &profiles.RoleProfile{Name: "developers",
+				RoleBindings: []rbacmanagerv1beta1.RoleBinding{{Namespace: "apps", ClusterRole: "edit",
+					NamespaceSelector: v1api.LabelSelector{MatchLabels: map[string]string{"kubernetes.io/metadata.name": "kube-system"}}}}},
+			wantErr: true,
+		},
+		{
+			name:    "provisions a protected namespace",
+			profile: &profiles.RoleProfile{Name: "developers", Namespaces: []profiles.Namespace{{Name: "openshift-apps"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := composeGuestObjects(GetHostedClusterObject("test"), []string{"alice"}, tt.profile, DefaultNameTemplates, policy.DefaultProtectedNamespaces)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, policy.ErrProtectedNamespace)) {
+				t.Errorf("composeGuestObjects() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// configMapProfiles are the role profiles loaded from the profile ConfigMap, they are replaced while reconciles read them
+type configMapProfiles struct {
+	mu       sync.RWMutex
+	profiles map[string]*profiles.RoleProfile
+	// pending are the names of changed profiles whose HostedClusters were not all requested a reconcile yet
+	pending map[string]bool
+	// events requests a reconcile of the HostedClusters given a profile that changed
+	events chan event.GenericEvent
+}
+
+func newConfigMapProfiles() *configMapProfiles {
+	return &configMapProfiles{events: make(chan event.GenericEvent)}
+}
+
+func (p *configMapProfiles) get(name string) (*profiles.RoleProfile, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	profile, ok := p.profiles[name]
+	return profile, ok
+}
+
+// replace replaces the profiles and returns the sorted names of the profiles added, changed or removed, together with
+// the names still pending from an earlier replace. They stay pending until delivered is called with them
+func (p *configMapProfiles) replace(loaded map[string]*profiles.RoleProfile) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending == nil {
+		p.pending = make(map[string]bool)
+	}
+	for name, profile := range loaded {
+		if previous, ok := p.profiles[name]; !ok || !reflect.DeepEqual(previous, profile) {
+			p.pending[name] = true
+		}
+	}
+	for name := range p.profiles {
+		if _, ok := loaded[name]; !ok {
+			p.pending[name] = true
+		}
+	}
+	changed := make([]string, 0, len(p.pending))
+	for name := range p.pending {
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+	p.profiles = loaded
+	return changed
+}
+
+// delivered marks the changed profiles as no longer pending once their HostedClusters were requested a reconcile
+func (p *configMapProfiles) delivered(changed []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, name := range changed {
+		delete(p.pending, name)
+	}
+}
+
+// reloadProfiles loads the role profiles of the profile ConfigMap, a deleted ConfigMap removes them
+// The function keeps the profiles loaded last when the ConfigMap has an invalid profile, and reports it as a
+// ProfilesInvalid event on the ConfigMap. The HostedClusters given a profile that changed are reconciled again, when
+// requesting it fails the changes are kept and requested again by the retry
+func (r *HostedClusterReconciler) reloadProfiles(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("configmap", req.NamespacedName.String())
+	configMap := &corev1.ConfigMap{}
+	var loaded map[string]*profiles.RoleProfile
+	if err := r.Client.Get(ctx, req.NamespacedName, configMap); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		log.Info("profile configmap not found, no role profiles are loaded from it")
+	} else if loaded, err = r.loadConfigMapProfiles(configMap); err != nil {
+		// the update has to be fixed, the profiles loaded last keep being given meanwhile
+		log.Error(err, "invalid role profiles, keeping the role profiles loaded last")
+		if r.Recorder != nil {
+			r.Recorder.Eventf(configMap, corev1.EventTypeWarning, "ProfilesInvalid", "keeping the role profiles loaded last: %v", err)
+		}
+		return ctrl.Result{}, nil
+	}
+	changed := r.configMapProfiles.replace(loaded)
+	if len(changed) == 0 {
+		return ctrl.Result{}, nil
+	}
+	log.Info("role profiles reloaded", "changed", changed)
+	if err := r.enqueueProfileChanges(ctx, changed); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.configMapProfiles.delivered(changed)
+	return ctrl.Result{}, nil
+}
+
+// loadConfigMapProfiles parses the role profiles of the ConfigMap, they must not be named like the profiles of the
+// profiles directory
+func (r *HostedClusterReconciler) loadConfigMapProfiles(configMap *corev1.ConfigMap) (map[string]*profiles.RoleProfile, error) {
+	loaded, err := profiles.LoadData(configMap.Data)
+	if err != nil {
+		return nil, err
+	}
+	for name := range loaded {
+		if _, ok := r.Profiles[name]; ok {
+			return nil, fmt.Errorf("profile %s is already loaded from the profiles directory", name)
+		}
+	}
+	return loaded, nil
+}
+
+// enqueueProfileChanges gets the names of changed profiles and requests a reconcile of every HostedCluster given one of
+// them, and of every HostedCluster whose access failed since it may have failed on a missing profile
+func (r *HostedClusterReconciler) enqueueProfileChanges(ctx context.Context, changed []string) error {
+	names := make(map[string]bool, len(changed))
+	for _, name := range changed {
+		names[name] = true
+	}
+	hostedClusters := v1alpha1.HostedClusterList{}
+	if err := r.Client.List(ctx, &hostedClusters); err != nil {
+		return err
+	}
+	for i := range hostedClusters.Items {
+		status, err := access.GetStatus(&hostedClusters.Items[i])
+		if err != nil || status == nil || (!names[status.Profile] && status.LastError == "") {
+			continue
+		}
+		object := &v1alpha1.HostedCluster{}
+		object.SetNamespace(hostedClusters.Items[i].GetNamespace())
+		object.SetName(hostedClusters.Items[i].GetName())
+		select {
+		case r.configMapProfiles.events <- event.GenericEvent{Object: object}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestHostedClusterReconciler_reloadProfiles(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+	key := types.NamespacedName{Namespace: "permission-granter-controller-system", Name: "role-profiles"}
+	devV1 := "name: dev\nroleBindings:\n- namespace: apps\n  clusterRole: view\n"
+	devV2 := "name: dev\nroleBindings:\n- namespace: apps\n  clusterRole: edit\n"
+	prod := "name: prod\nroleBindings:\n- namespace: apps\n  clusterRole: view\n"
+	tests := []struct {
+		name         string
+		loaded       map[string]string
+		data         map[string]string
+		deleted      bool
+		wantProfiles map[string]string
+		wantEnqueued []string
+		wantEvent    bool
+	}{
+		{
+			name:         "loads the profiles",
+			data:         map[string]string{"dev.yaml": devV1, "prod.yaml": prod},
+			wantProfiles: map[string]string{"dev": "view", "prod": "view"},
+			wantEnqueued: []string{"given-dev", "given-prod", "failed"},
+		},
+		{
+			name:         "reloads changed profiles",
+			loaded:       map[string]string{"dev.yaml": devV1, "prod.yaml": prod},
+			data:         map[string]string{"dev.yaml": devV2, "prod.yaml": prod},
+			wantProfiles: map[string]string{"dev": "edit", "prod": "view"},
+			wantEnqueued: []string{"given-dev", "failed"},
+		},
+		{
+			name:         "unchanged profiles",
+			loaded:       map[string]string{"dev.yaml": devV1},
+			data:         map[string]string{"dev.yaml": devV1, "notes.txt": "not a profile"},
+			wantProfiles: map[string]string{"dev": "view"},
+		},
+		{
+			name:         "keeps the last valid profiles",
+			loaded:       map[string]string{"dev.yaml": devV1},
+			data:         map[string]string{"dev.yaml": devV2, "prod.yaml": "name: prod\nroleBindings:\n- namespace: apps\n"},
+			wantProfiles: map[string]string{"dev": "view"},
+			wantEvent:    true,
+		},
+		{
+			name:         "profiles directory names are reserved",
+			loaded:       map[string]string{"dev.yaml": devV1},
+			data:         map[string]string{"dev.yaml": devV1, "static.yaml": "name: static\n"},
+			wantProfiles: map[string]string{"dev": "view"},
+			wantEvent:    true,
+		},
+		{
+			name:         "deleted configmap removes the profiles",
+			loaded:       map[string]string{"dev.yaml": devV1},
+			deleted:      true,
+			wantEnqueued: []string{"given-dev", "failed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			givenDev := withAccessStatus(t, GetHostedClusterObject("given-dev"), access.Status{Group: "group", Profile: "dev"})
+			givenProd := withAccessStatus(t, GetHostedClusterObject("given-prod"), access.Status{Group: "group", Profile: "prod"})
+			failed := withAccessStatus(t, GetHostedClusterObject("failed"), access.Status{LastError: "role profile not found"})
+			builder := fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(givenDev, givenProd, failed, GetHostedClusterObject("no-status"))
+			if !tt.deleted {
+				builder = builder.WithObjects(&corev1.ConfigMap{
+					ObjectMeta: v1api.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+					Data:       tt.data,
+				})
+			}
+			recorder := record.NewFakeRecorder(10)
+			r := &HostedClusterReconciler{
+				Client:            builder.Build(),
+				Log:               ctrl.Log.WithName("test"),
+				Recorder:          recorder,
+				Profiles:          map[string]*profiles.RoleProfile{"static": {Name: "static"}},
+				ProfileConfigMap:  key,
+				configMapProfiles: &configMapProfiles{events: make(chan event.GenericEvent, 10)},
+			}
+			if tt.loaded != nil {
+				loaded, err := profiles.LoadData(tt.loaded)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.configMapProfiles.delivered(r.configMapProfiles.replace(loaded))
+			}
+			if _, err := r.reloadProfiles(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("reloadProfiles() error = %v", err)
+			}
+			for name, clusterRole := range tt.wantProfiles {
+				profile, ok := r.profileByName(name)
+				if !ok || profile.RoleBindings[0].ClusterRole != clusterRole {
+					t.Errorf("profile %s = %+v, want it to bind %s", name, profile, clusterRole)
+				}
+			}
+			if len(tt.wantProfiles) == 0 {
+				if _, ok := r.profileByName("dev"); ok {
+					t.Errorf("profile dev is still loaded")
+				}
+			}
+			close(r.configMapProfiles.events)
+			var enqueued []string
+			for e := range r.configMapProfiles.events {
+				enqueued = append(enqueued, e.Object.GetName())
+			}
+			sort.Strings(enqueued)
+			wantEnqueued := append([]string{}, tt.wantEnqueued...)
+			sort.Strings(wantEnqueued)
+			if len(enqueued) > 0 || len(wantEnqueued) > 0 {
+				if !reflect.DeepEqual(enqueued, wantEnqueued) {
+					t.Errorf("enqueued %v, want %v", enqueued, wantEnqueued)
+				}
+			}
+			if gotEvent := len(recorder.Events) > 0; gotEvent != tt.wantEvent {
+				t.Errorf("recorded %d events, want a ProfilesInvalid event %v", len(recorder.Events), tt.wantEvent)
+			}
+		})
+	}
+}
+
+// failingListClient fails the first List, as the API server may while the profiles are reloaded
+type failingListClient struct {
+	client.Client
+	failed *bool
+}
+
+func (c failingListClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if !*c.failed {
+		*c.failed = true
+		return errors.New("list failed")
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func TestHostedClusterReconciler_reloadProfilesRetry(t *testing.T) {
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+	key := types.NamespacedName{Namespace: "permission-granter-controller-system", Name: "role-profiles"}
+	givenDev := withAccessStatus(t, GetHostedClusterObject("given-dev"), access.Status{Group: "group", Profile: "dev"})
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(givenDev, &corev1.ConfigMap{
+		ObjectMeta: v1api.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+		Data:       map[string]string{"dev.yaml": "name: dev\nroleBindings:\n- namespace: apps\n  clusterRole: view\n"},
+	}).Build()
+	r := &HostedClusterReconciler{
+		Client:            failingListClient{Client: c, failed: new(bool)},
+		Log:               ctrl.Log.WithName("test"),
+		ProfileConfigMap:  key,
+		configMapProfiles: &configMapProfiles{events: make(chan event.GenericEvent, 10)},
+	}
+	if _, err := r.reloadProfiles(ctx, ctrl.Request{NamespacedName: key}); err == nil {
+		t.Fatalf("reloadProfiles() error = nil, want the list error")
+	}
+	if _, ok := r.profileByName("dev"); !ok {
+		t.Errorf("profile dev is not loaded")
+	}
+	// the retry finds the profiles unchanged and still requests the reconciles the failed attempt missed
+	if _, err := r.reloadProfiles(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("reloadProfiles() error = %v", err)
+	}
+	if len(r.configMapProfiles.events) != 1 {
+		t.Fatalf("enqueued %d HostedClusters, want given-dev", len(r.configMapProfiles.events))
+	}
+	if e := <-r.configMapProfiles.events; e.Object.GetName() != "given-dev" {
+		t.Errorf("enqueued %s, want given-dev", e.Object.GetName())
+	}
+	if _, err := r.reloadProfiles(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("reloadProfiles() error = %v", err)
+	}
+	if len(r.configMapProfiles.events) != 0 {
+		t.Errorf("enqueued %d HostedClusters once the changes were delivered, want none", len(r.configMapProfiles.events))
+	}
+}
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	permissionsv1alpha1 "github.com/dana-team/permission-granter-controller/api/v1alpha1"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var errProfileNotFound = errors.New("role profile not found")
+
+// profilePolicyRule is a rule of a ProfilePolicy and where it is defined
+type profilePolicyRule struct {
+	policy string
+	index  int
+	rule   permissionsv1alpha1.ProfilePolicyRule
+}
+
+// String names the rule by its policy and position, e.g. "environments[1]"
+func (r profilePolicyRule) String() string {
+	return fmt.Sprintf("%s[%d]", r.policy, r.index)
+}
+
+// matchProfilePolicies gets the ProfilePolicies and the labels of a HostedCluster
+// The function returns the matching rule with the highest priority, rules of equal priority are ordered by policy name
+// and position. It returns nil when no rule matches, and the rules whose selector is invalid
+func matchProfilePolicies(policies []permissionsv1alpha1.ProfilePolicy, hostedClusterLabels map[string]string) (*profilePolicyRule, []error) {
+	var rules []profilePolicyRule
+	for _, policy := range policies {
+		for i, rule := range policy.Spec.Rules {
+			rules = append(rules, profilePolicyRule{policy: policy.Name, index: i, rule: rule})
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].rule.Priority != rules[j].rule.Priority {
+			return rules[i].rule.Priority > rules[j].rule.Priority
+		}
+		if rules[i].policy != rules[j].policy {
+			return rules[i].policy < rules[j].policy
+		}
+		return rules[i].index < rules[j].index
+	})
+	var invalid []error
+	for i := range rules {
+		selector, err := v1api.LabelSelectorAsSelector(&rules[i].rule.HostedClusterSelector)
+		if err != nil {
+			invalid = append(invalid, fmt.Errorf("profile policy rule %s: %w", rules[i], err))
+			continue
+		}
+		if selector.Matches(labels.Set(hostedClusterLabels)) {
+			return &rules[i], invalid
+		}
+	}
+	return nil, invalid
+}
+
+// profileByName returns the role profile the reconciler knows by name: the profiles it was given, the profiles loaded
+// from the profile ConfigMap, the configured profile and the default profile
+func (r *HostedClusterReconciler) profileByName(name string) (*profiles.RoleProfile, bool) {
+	if profile, ok := r.Profiles[name]; ok {
+		return profile, true
+	}
+	if r.configMapProfiles != nil {
+		if profile, ok := r.configMapProfiles.get(name); ok {
+			return profile, true
+		}
+	}
+	if r.Profile != nil && r.Profile.Name == name {
+		return r.Profile, true
+	}
+	if profiles.DefaultRoleProfile.Name == name {
+		return &profiles.DefaultRoleProfile, true
+	}
+	return nil, false
+}
+
+// selectProfile gets the HostedCluster and context
+// The function returns the role profile of the highest priority ProfilePolicy rule selecting the HostedCluster and the
+// rule, or the configured profile when no rule selects it. A rule naming an unknown profile results in an error wrapping
+// errProfileNotFound, the configured profile is not used in its place
+func (r *HostedClusterReconciler) selectProfile(ctx context.Context, hostedCluster *v1alpha1.HostedCluster) (*profiles.RoleProfile, string, error) {
+	if r.Policies == nil {
+		return r.roleProfile(), "", nil
+	}
+	policies := permissionsv1alpha1.ProfilePolicyList{}
+	if err := r.Policies.List(ctx, &policies); err != nil {
+		r.Log.Error(err, "could not list profile policies")
+		return nil, "", err
+	}
+	matched, invalid := matchProfilePolicies(policies.Items, hostedCluster.GetLabels())
+	for _, err := range invalid {
+		r.Log.Error(err, "ignoring profile policy rule")
+	}
+	if matched == nil {
+		return r.roleProfile(), "", nil
+	}
+	profile, ok := r.profileByName(matched.rule.Profile)
+	if !ok {
+		err := fmt.Errorf("%w: profile policy rule %s selects profile %s", errProfileNotFound, matched, matched.rule.Profile)
+		if r.Recorder != nil {
+			r.Recorder.Event(hostedCluster, corev1.EventTypeWarning, "ProfileNotFound", err.Error())
+		}
+		return nil, matched.String(), err
+	}
+	return profile, matched.String(), nil
+}
+
+// hostedClustersForProfilePolicy returns a request for every HostedCluster, a changed ProfilePolicy or ProfileRollout
+// may give a different profile to any of them
+func (r *HostedClusterReconciler) hostedClustersForProfilePolicy(client.Object) []reconcile.Request {
+	hostedClusters := v1alpha1.HostedClusterList{}
+	if err := r.Client.List(context.Background(), &hostedClusters); err != nil {
+		r.Log.Error(err, "could not list hosted clusters for a changed profile policy")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(hostedClusters.Items))
+	for _, hostedCluster := range hostedClusters.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&hostedCluster)})
+	}
+	return requests
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"testing"
+
+	permissionsv1alpha1 "github.com/dana-team/permission-granter-controller/api/v1alpha1"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func profilePolicy(name string, rules ...permissionsv1alpha1.ProfilePolicyRule) permissionsv1alpha1.ProfilePolicy {
+	return permissionsv1alpha1.ProfilePolicy{ObjectMeta: v1api.ObjectMeta{Name: name}, Spec: permissionsv1alpha1.ProfilePolicySpec{Rules: rules}}
+}
+
+func profilePolicyRuleFor(priority int32, profile string, matchLabels map[string]string) permissionsv1alpha1.ProfilePolicyRule {
+	return permissionsv1alpha1.ProfilePolicyRule{
+		Priority:              priority,
+		HostedClusterSelector: v1api.LabelSelector{MatchLabels: matchLabels},
+		Profile:               profile,
+	}
+}
+
+func TestMatchProfilePolicies(t *testing.T) {
+	environments := profilePolicy("environments",
+		profilePolicyRuleFor(0, "dev", map[string]string{"env": "dev"}),
+		profilePolicyRuleFor(0, "prod", map[string]string{"env": "prod"}),
+	)
+	fallback := profilePolicy("fallback", profilePolicyRuleFor(-10, "restricted", nil))
+	overrides := profilePolicy("overrides", profilePolicyRuleFor(100, "platform", map[string]string{"team": "platform"}))
+	tied := profilePolicy("a-tied", profilePolicyRuleFor(0, "tied", map[string]string{"env": "dev"}))
+	invalid := profilePolicy("invalid", permissionsv1alpha1.ProfilePolicyRule{
+		Priority: 1000,
+		HostedClusterSelector: v1api.LabelSelector{MatchExpressions: []v1api.LabelSelectorRequirement{
+			{Key: "env", Operator: "Unknown"},
+		}},
+		Profile: "broken",
+	})
+	tests := []struct {
+		name        string
+		policies    []permissionsv1alpha1.ProfilePolicy
+		labels      map[string]string
+		wantRule    string
+		wantProfile string
+		wantInvalid int
+	}{
+		{name: "no policies", labels: map[string]string{"env": "dev"}},
+		{
+			name:        "selector matches",
+			policies:    []permissionsv1alpha1.ProfilePolicy{environments, fallback},
+			labels:      map[string]string{"env": "prod"},
+			wantRule:    "environments[1]",
+			wantProfile: "prod",
+		},
+		{
+			name:        "empty selector matches the rest",
+			policies:    []permissionsv1alpha1.ProfilePolicy{environments, fallback},
+			labels:      map[string]string{"env": "staging"},
+			wantRule:    "fallback[0]",
+			wantProfile: "restricted",
+		},
+		{
+			name:        "higher priority wins",
+			policies:    []permissionsv1alpha1.ProfilePolicy{environments, overrides},
+			labels:      map[string]string{"env": "dev", "team": "platform"},
+			wantRule:    "overrides[0]",
+			wantProfile: "platform",
+		},
+		{
+			name:        "equal priority is ordered by policy name",
+			policies:    []permissionsv1alpha1.ProfilePolicy{environments, tied},
+			labels:      map[string]string{"env": "dev"},
+			wantRule:    "a-tied[0]",
+			wantProfile: "tied",
+		},
+		{
+			name:        "invalid selectors are skipped",
+			policies:    []permissionsv1alpha1.ProfilePolicy{invalid, environments},
+			labels:      map[string]string{"env": "dev"},
+			wantRule:    "environments[0]",
+			wantProfile: "dev",
+			wantInvalid: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, invalidRules := matchProfilePolicies(tt.policies, tt.labels)
+			if len(invalidRules) != tt.wantInvalid {
+				t.Errorf("matchProfilePolicies() invalid = %v, want %d", invalidRules, tt.wantInvalid)
+			}
+			if tt.wantRule == "" {
+				if got != nil {
+					t.Errorf("matchProfilePolicies() = %s, want no match", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("matchProfilePolicies() matched nothing, want %s", tt.wantRule)
+			}
+			if got.String() != tt.wantRule || got.rule.Profile != tt.wantProfile {
+				t.Errorf("matchProfilePolicies() = %s selecting %s, want %s selecting %s", got, got.rule.Profile, tt.wantRule, tt.wantProfile)
+			}
+		})
+	}
+}
+
+func TestHostedClusterReconciler_selectProfile(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = permissionsv1alpha1.AddToScheme(scheme)
+	environments := profilePolicy("environments",
+		profilePolicyRuleFor(0, "dev", map[string]string{"env": "dev"}),
+		profilePolicyRuleFor(0, "missing", map[string]string{"env": "prod"}),
+		profilePolicyRuleFor(0, "default", map[string]string{"env": "staging"}),
+	)
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&environments).Build()
+	dev := &profiles.RoleProfile{Name: "dev"}
+	configured := &profiles.RoleProfile{Name: "configured"}
+	tests := []struct {
+		name        string
+		noPolicies  bool
+		labels      map[string]string
+		wantProfile string
+		wantRule    string
+		wantErr     error
+	}{
+		{name: "policies disabled", noPolicies: true, labels: map[string]string{"env": "dev"}, wantProfile: "configured"},
+		{name: "no rule matches", labels: map[string]string{"env": "qa"}, wantProfile: "configured"},
+		{name: "named profile", labels: map[string]string{"env": "dev"}, wantProfile: "dev", wantRule: "environments[0]"},
+		{name: "default profile by name", labels: map[string]string{"env": "staging"}, wantProfile: "default", wantRule: "environments[2]"},
+		{name: "unknown profile", labels: map[string]string{"env": "prod"}, wantRule: "environments[1]", wantErr: errProfileNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &HostedClusterReconciler{
+				Log:      ctrl.Log.WithName("test"),
+				Recorder: recorder,
+				Profile:  configured,
+				Profiles: map[string]*profiles.RoleProfile{"dev": dev},
+				Policies: reader,
+			}
+			if tt.noPolicies {
+				r.Policies = nil
+			}
+			hostedCluster := GetHostedClusterObject("test")
+			hostedCluster.SetLabels(tt.labels)
+			profile, rule, err := r.selectProfile(context.Background(), hostedCluster)
+			if !goerrors.Is(err, tt.wantErr) {
+				t.Fatalf("selectProfile() error = %v, want %v", err, tt.wantErr)
+			}
+			if rule != tt.wantRule {
+				t.Errorf("selectProfile() rule = %q, want %q", rule, tt.wantRule)
+			}
+			if tt.wantErr != nil {
+				if len(recorder.Events) != 1 {
+					t.Errorf("selectProfile() recorded %d events, want a ProfileNotFound event", len(recorder.Events))
+				}
+				return
+			}
+			if profile.Name != tt.wantProfile {
+				t.Errorf("selectProfile() profile = %s, want %s", profile.Name, tt.wantProfile)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/openshift/hypershift/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	// propagatedLabelsAnnotation and propagatedAnnotationsAnnotation record the keys the controller copied onto a guest
+	// object, so keys removed from the HostedCluster or from the allowlist are removed from the object as well
+	propagatedLabelsAnnotation      = "dana.io/propagated-labels"
+	propagatedAnnotationsAnnotation = "dana.io/propagated-annotations"
+)
+
+// Propagation is the allowlist of HostedCluster label and annotation keys copied onto the custom cluster admin group
+// and the namespaces the controller manages at the hosted cluster. A key ending with * matches every key with that prefix,
+// e.g. cost.example.com/*
+type Propagation struct {
+	Labels      []string
+	Annotations []string
+}
+
+// Validate returns an error if a key of the allowlist is not a valid label or annotation key
+func (p Propagation) Validate() error {
+	for _, key := range append(append([]string{}, p.Labels...), p.Annotations...) {
+		name := key
+		if strings.HasSuffix(key, "*") {
+			// a prefix is validated as the prefix of a complete key
+			name = strings.TrimSuffix(key, "*") + "x"
+		}
+		if errs := validation.IsQualifiedName(name); len(errs) > 0 {
+			return fmt.Errorf("invalid propagated key %q: %s", key, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// allowed returns true if the key matches the allowlist.
+// The keys the controller manages itself are never propagated
+func allowed(allowlist []string, key string) bool {
+	if key == managedByLabel || strings.HasPrefix(key, "dana.io/") {
+		return false
+	}
+	for _, allowedKey := range allowlist {
+		if allowedKey == key || (strings.HasSuffix(allowedKey, "*") && strings.HasPrefix(key, strings.TrimSuffix(allowedKey, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply gets the HostedCluster and a guest object
+// The function copies the allowed labels and annotations of the HostedCluster onto the object and records their keys
+func (p Propagation) apply(hostedCluster *v1alpha1.HostedCluster, obj client.Object) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	var labelKeys, annotationKeys []string
+	for key, value := range hostedCluster.GetLabels() {
+		if allowed(p.Labels, key) {
+			labels[key] = value
+			labelKeys = append(labelKeys, key)
+		}
+	}
+	for key, value := range hostedCluster.GetAnnotations() {
+		if allowed(p.Annotations, key) {
+			annotations[key] = value
+			annotationKeys = append(annotationKeys, key)
+		}
+	}
+	setKeys(annotations, propagatedLabelsAnnotation, labelKeys)
+	setKeys(annotations, propagatedAnnotationsAnnotation, annotationKeys)
+	obj.SetLabels(labels)
+	obj.SetAnnotations(annotations)
+}
+
+// setKeys records the sorted keys in the annotation, removing it when there are none
+func setKeys(annotations map[string]string, annotation string, keys []string) {
+	if len(keys) == 0 {
+		delete(annotations, annotation)
+		return
+	}
+	sort.Strings(keys)
+	annotations[annotation] = strings.Join(keys, ",")
+}
+
+// getKeys returns the keys recorded in the annotation
+func getKeys(annotations map[string]string, annotation string) []string {
+	if annotations[annotation] == "" {
+		return nil
+	}
+	return strings.Split(annotations[annotation], ",")
+}
+
+// dropStalePropagated gets the existing guest object, the desired object and the merged labels and annotations
+// The function removes the keys that were propagated onto the existing object and are no longer propagated by the desired one
+func dropStalePropagated(existing client.Object, desired client.Object, labels map[string]string, annotations map[string]string) {
+	for _, tracked := range []struct {
+		annotation string
+		values     map[string]string
+		desired    map[string]string
+	}{
+		{propagatedLabelsAnnotation, labels, desired.GetLabels()},
+		{propagatedAnnotationsAnnotation, annotations, desired.GetAnnotations()},
+	} {
+		stillPropagated := make(map[string]bool)
+		for _, key := range getKeys(desired.GetAnnotations(), tracked.annotation) {
+			stillPropagated[key] = true
+		}
+		for _, key := range getKeys(existing.GetAnnotations(), tracked.annotation) {
+			if _, composed := tracked.desired[key]; !stillPropagated[key] && !composed {
+				delete(tracked.values, key)
+			}
+		}
+		if _, ok := desired.GetAnnotations()[tracked.annotation]; !ok {
+			delete(annotations, tracked.annotation)
+		}
+	}
+}
+
+// propagateToNamespaces gets HostedCluster client, the HostedCluster and context
+// The function copies the allowed labels and annotations of the HostedCluster onto every namespace the controller manages
+// for it at the hosted cluster
+func (r *HostedClusterReconciler) propagateToNamespaces(ctx context.Context, hostedClient client.Client, hostedCluster *v1alpha1.HostedCluster) error {
+	namespaces := corev1.NamespaceList{}
+	if err := hostedClient.List(ctx, &namespaces, client.MatchingLabels{managedByLabel: managedByValue}); err != nil {
+		return err
+	}
+	hostedClusterName := hostedCluster.GetNamespace() + "/" + hostedCluster.GetName()
+	for i := range namespaces.Items {
+		namespace := &namespaces.Items[i]
+		if namespace.GetAnnotations()[hostedClusterAnnotation] != hostedClusterName {
+			continue
+		}
+		desired := &corev1.Namespace{}
+		desired.SetName(namespace.GetName())
+		desired.Spec = namespace.Spec
+		desired.SetLabels(map[string]string{})
+		desired.SetAnnotations(map[string]string{})
+		r.Propagation.apply(hostedCluster, desired)
+		if err := r.applyGuestObject(ctx, hostedClient, hostedCluster, desired); err != nil {
+			return err
+		}
+	}
+	return nil
+}
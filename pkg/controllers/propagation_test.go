@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	userv1 "github.com/openshift/api/user/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPropagation_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		propagation Propagation
+		wantErr     bool
+	}{
+		{name: "keys and prefixes", propagation: Propagation{Labels: []string{"team", "cost.example.com/*"}, Annotations: []string{"example.com/owner"}}},
+		{name: "empty", propagation: Propagation{}},
+		{name: "invalid key", propagation: Propagation{Labels: []string{"not a key"}}, wantErr: true},
+		{name: "invalid prefix", propagation: Propagation{Annotations: []string{"-bad/*"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.propagation.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHostedClusterReconciler_propagation(t *testing.T) {
+	ctx := context.Background()
+	hostedCluster := GetHostedClusterObject("test")
+	hostedCluster.SetNamespace("clusters")
+	managedNamespace := &corev1.Namespace{ObjectMeta: v1api.ObjectMeta{Name: "team-a", Labels: map[string]string{"keep": "yes"}}}
+	setManaged(managedNamespace, "clusters/test")
+	otherNamespace := &corev1.Namespace{ObjectMeta: v1api.ObjectMeta{Name: "team-b"}}
+	setManaged(otherNamespace, "clusters/other")
+	hostedClient := fake.NewClientBuilder().WithScheme(hostedScheme).WithObjects(managedNamespace, otherNamespace).Build()
+	r := &HostedClusterReconciler{
+		Log:         ctrl.Log.WithName("test"),
+		Propagation: Propagation{Labels: []string{"cost.example.com/*", "team"}, Annotations: []string{"example.com/owner"}},
+	}
+
+	tests := []struct {
+		name            string
+		labels          map[string]string
+		annotations     map[string]string
+		wantLabels      map[string]string
+		wantAnnotations map[string]string
+	}{
+		{
+			name:            "copies allowed keys",
+			labels:          map[string]string{"cost.example.com/center": "42", "team": "platform", "ignored": "true", managedByLabel: "someone"},
+			annotations:     map[string]string{"example.com/owner": "alice", "example.com/other": "x"},
+			wantLabels:      map[string]string{"cost.example.com/center": "42", "team": "platform"},
+			wantAnnotations: map[string]string{"example.com/owner": "alice"},
+		},
+		{
+			name:            "follows changes",
+			labels:          map[string]string{"cost.example.com/center": "43", "team": "platform"},
+			wantLabels:      map[string]string{"cost.example.com/center": "43", "team": "platform"},
+			wantAnnotations: map[string]string{},
+		},
+		{
+			name:            "removes keys no longer set",
+			labels:          map[string]string{"team": "platform"},
+			wantLabels:      map[string]string{"team": "platform"},
+			wantAnnotations: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostedCluster.SetLabels(tt.labels)
+			hostedCluster.SetAnnotations(tt.annotations)
+			group := &userv1.Group{ObjectMeta: v1api.ObjectMeta{Name: "custom-admins"}}
+			setManaged(group, "clusters/test")
+			r.Propagation.apply(hostedCluster, group)
+			if err := r.applyGuestObject(ctx, hostedClient, hostedCluster, group); err != nil {
+				t.Fatalf("applyGuestObject() error = %v", err)
+			}
+			if err := r.propagateToNamespaces(ctx, hostedClient, hostedCluster); err != nil {
+				t.Fatalf("propagateToNamespaces() error = %v", err)
+			}
+			namespace := corev1.Namespace{}
+			if err := hostedClient.Get(ctx, types.NamespacedName{Name: "team-a"}, &namespace); err != nil {
+				t.Fatal(err)
+			}
+			if err := hostedClient.Get(ctx, types.NamespacedName{Name: group.GetName()}, group); err != nil {
+				t.Fatal(err)
+			}
+			wantLabels := mergeMaps(tt.wantLabels, map[string]string{managedByLabel: managedByValue})
+			if !reflect.DeepEqual(group.GetLabels(), wantLabels) {
+				t.Errorf("group labels got: %v want %v", group.GetLabels(), wantLabels)
+			}
+			if !reflect.DeepEqual(namespace.GetLabels(), mergeMaps(wantLabels, map[string]string{"keep": "yes"})) {
+				t.Errorf("namespace labels got: %v want %v", namespace.GetLabels(), wantLabels)
+			}
+			for _, obj := range []map[string]string{group.GetAnnotations(), namespace.GetAnnotations()} {
+				for key := range obj {
+					if _, ok := tt.wantAnnotations[key]; !ok && !strings.HasPrefix(key, "dana.io/") {
+						t.Errorf("unexpected annotation %s", key)
+					}
+				}
+				if _, ok := obj[propagatedAnnotationsAnnotation]; ok && len(tt.wantAnnotations) == 0 {
+					t.Errorf("%s was not removed", propagatedAnnotationsAnnotation)
+				}
+				for key, value := range tt.wantAnnotations {
+					if obj[key] != value {
+						t.Errorf("annotation %s got: %q want %q", key, obj[key], value)
+					}
+				}
+			}
+			other := corev1.Namespace{}
+			if err := hostedClient.Get(ctx, types.NamespacedName{Name: "team-b"}, &other); err != nil {
+				t.Fatal(err)
+			}
+			if other.GetLabels()["team"] != "" {
+				t.Errorf("namespace of another hosted cluster was changed")
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/policy"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	rbacmanagerv1beta1 "github.com/fairwindsops/rbac-manager/pkg/apis/rbacmanager/v1beta1"
+	v1 "github.com/openshift/api/user/v1"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+var errProfileRender = errors.New("could not render role profile")
+
+// guestObjects are the objects the controller manages at a single HostedCluster
+type guestObjects struct {
+	group          *v1.Group
+	rbacDefinition *rbacmanagerv1beta1.RBACDefinition
+	namespaces     []guestNamespace
+	clusterRoles   []*rbacv1.ClusterRole
+}
+
+// roleProfile returns the role profile the reconciler gives to the custom cluster admin group
+func (r *HostedClusterReconciler) roleProfile() *profiles.RoleProfile {
+	if r.Profile != nil {
+		return r.Profile
+	}
+	return &profiles.DefaultRoleProfile
+}
+
+// templateData returns what role profile templates are rendered with for the HostedCluster
+func templateData(hostedCluster *v1alpha1.HostedCluster) profiles.TemplateData {
+	return profiles.TemplateData{
+		Cluster: profiles.TemplateCluster{
+			Name:        hostedCluster.GetName(),
+			Namespace:   hostedCluster.GetNamespace(),
+			Labels:      mergeMaps(hostedCluster.GetLabels(), nil),
+			Annotations: mergeMaps(hostedCluster.GetAnnotations(), nil),
+		},
+		Requester: access.GetRequester(hostedCluster),
+	}
+}
+
+// RenderProfile returns the role profile rendered for the HostedCluster, profiles without templates are returned as they are
+func RenderProfile(hostedCluster *v1alpha1.HostedCluster, profile *profiles.RoleProfile) (*profiles.RoleProfile, error) {
+	return profile.Render(templateData(hostedCluster))
+}
+
+// renderProfile gets the HostedCluster and the role profile selected for it
+// The function returns the profile rendered for the HostedCluster. A profile that cannot be rendered results in an error
+// wrapping errProfileRender and is reported as an event, the error is recorded in the access status
+func (r *HostedClusterReconciler) renderProfile(hostedCluster *v1alpha1.HostedCluster, profile *profiles.RoleProfile) (*profiles.RoleProfile, error) {
+	rendered, err := RenderProfile(hostedCluster, profile)
+	if err != nil {
+		r.Log.Info("could not render role profile", "hosted cluster", hostedCluster.GetName(), "profile", profile.Name, "error", err.Error())
+		if r.Recorder != nil {
+			r.Recorder.Eventf(hostedCluster, corev1.EventTypeWarning, "ProfileRenderFailed", "could not render role profile %s: %v", profile.Name, err)
+		}
+		return nil, fmt.Errorf("%w %s: %v", errProfileRender, profile.Name, err)
+	}
+	return rendered, nil
+}
+
+// composeGuestObjects gets the HostedCluster, the users that should have access, the role profile and the name templates
+// The function returns the desired group, RBACDefinition, namespaces and ClusterRoles at the HostedCluster, marked as managed by the controller
+// RoleBindings into protected namespaces or by a namespace selector and protected provisioned namespaces are refused with an error
+// wrapping policy.ErrProtectedNamespace
+func composeGuestObjects(hostedCluster *v1alpha1.HostedCluster, users []string, profile *profiles.RoleProfile, nameTemplates NameTemplates, protected policy.ProtectedNamespaces) (guestObjects, error) {
+	for _, roleBinding := range profile.RoleBindings {
+		// rbac-manager binds in every namespace the selector matches, protected ones included
+		if profiles.HasNamespaceSelector(roleBinding) {
+			return guestObjects{}, fmt.Errorf("%w: profile %s binds %s by a namespace selector, use namespaceRoleBindings to bind by labels",
+				policy.ErrProtectedNamespace, profile.Name, roleBinding.ClusterRole+roleBinding.Role)
+		}
+		if err := protected.CheckNamespace(roleBinding.Namespace, "profile "+profile.Name+" binds "+roleBinding.ClusterRole+roleBinding.Role+" in it"); err != nil {
+			return guestObjects{}, err
+		}
+	}
+	for _, namespace := range profile.Namespaces {
+		if err := protected.CheckNamespace(namespace.Name, "profile "+profile.Name+" provisions it"); err != nil {
+			return guestObjects{}, err
+		}
+	}
+	names, err := nameTemplates.resolveNames(hostedCluster)
+	if err != nil {
+		return guestObjects{}, err
+	}
+	owner := hostedCluster.GetNamespace() + "/" + hostedCluster.GetName()
+
+	group := composeCustomClusterAdminGroup(names.Group, users)
+	setManaged(&group, owner)
+	rbacDefinition := composeCustomAdminRBACDefinition(names.RBACDefinition, names.Group, profile)
+	setManaged(&rbacDefinition, owner)
+	namespaces := composeGuestNamespaces(profile.Namespaces, owner)
+	clusterRoles, err := composeProfileClusterRoles(profile, owner)
+	if err != nil {
+		return guestObjects{}, err
+	}
+	return guestObjects{group: &group, rbacDefinition: &rbacDefinition, namespaces: namespaces, clusterRoles: clusterRoles}, nil
+}
+
+// RenderGuestObjects gets a HostedCluster, a role profile, the name templates, the propagated keys and the protected namespaces
+// The function returns the objects the controller would apply at the HostedCluster without contacting any cluster, and notes
+// on the steps of the reconcile that need the hosted cluster or the management cluster and were not rendered.
+// The HostedCluster must carry the requester annotation or active grants, a cluster-admin ClusterRoleBinding is rendered as well
+// if the HostedCluster records that one was given. A profile handing out permissions amounting to cluster-admin is refused with
+// an error wrapping errPolicyViolation, and one reaching protected namespaces with an error wrapping policy.ErrProtectedNamespace,
+// like the reconciler refuses them. Resources are assumed namespaced unless they are built-in cluster scoped resources
+func RenderGuestObjects(hostedCluster *v1alpha1.HostedCluster, profile *profiles.RoleProfile, nameTemplates NameTemplates, propagation Propagation, protected policy.ProtectedNamespaces) ([]client.Object, []string, error) {
+	if profile == nil {
+		profile = &profiles.DefaultRoleProfile
+	}
+	profile, err := RenderProfile(hostedCluster, profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	users, _, err := access.Subjects(hostedCluster, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(users) == 0 {
+		return nil, nil, fmt.Errorf("hosted cluster %s has no %s annotation or active grants", hostedCluster.GetName(), requesterAnnotation)
+	}
+	desired, err := composeGuestObjects(hostedCluster, users, profile, nameTemplates, protected)
+	if err != nil {
+		return nil, nil, err
+	}
+	violations, protectedViolations, err := profileViolations(context.Background(), offlineReader{}, profile, &desired.rbacDefinition.RBACBindings[0],
+		protected, policy.Namespaced)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(violations) > 0 && !profile.Privileged {
+		return nil, nil, fmt.Errorf("%w: profile %s: %s", errPolicyViolation, profile.Name, strings.Join(policy.Strings(violations), "; "))
+	}
+	if len(protectedViolations) > 0 && !profile.Privileged {
+		return nil, nil, fmt.Errorf("%w: profile %s: %s", policy.ErrProtectedNamespace, profile.Name, strings.Join(policy.Strings(protectedViolations), "; "))
+	}
+	propagation.apply(hostedCluster, desired.group)
+	var objects []client.Object
+	for _, guest := range desired.namespaces {
+		propagation.apply(hostedCluster, guest.namespace)
+		objects = append(objects, guest.namespace)
+		if guest.resourceQuota != nil {
+			objects = append(objects, guest.resourceQuota)
+		}
+		if guest.limitRange != nil {
+			objects = append(objects, guest.limitRange)
+		}
+	}
+	for _, clusterRole := range desired.clusterRoles {
+		objects = append(objects, clusterRole)
+	}
+	objects = append(objects, desired.group, desired.rbacDefinition)
+	if clusterAdmin, ok := hostedCluster.GetAnnotations()[clusterAdminAnnotation]; ok {
+		clusterRoleBinding := composeClusterAdminCRB(clusterAdmin)
+		objects = append(objects, &clusterRoleBinding)
+	}
+	for _, obj := range objects {
+		gvk, err := apiutil.GVKForObject(obj, hostedScheme)
+		if err != nil {
+			return nil, nil, err
+		}
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+	}
+	return objects, renderNotes(profile), nil
+}
+
+// renderNotes returns the steps of the reconcile an offline render of the role profile leaves out
+func renderNotes(profile *profiles.RoleProfile) []string {
+	notes := []string{fmt.Sprintf("role profile %s is rendered as given, ProfilePolicies and ProfileRollouts selecting another profile are not applied", profile.Name)}
+	for _, binding := range profile.NamespaceRoleBindings {
+		var selects []string
+		if binding.NamespacePattern != "" {
+			selects = append(selects, "named "+binding.NamespacePattern)
+		}
+		if binding.NamespaceSelector != nil {
+			selects = append(selects, "labeled "+v1api.FormatLabelSelector(binding.NamespaceSelector))
+		}
+		notes = append(notes, fmt.Sprintf("unresolved namespace role binding: %s%s in the namespaces %s, they are selected at the hosted cluster",
+			binding.ClusterRole, binding.Role, strings.Join(selects, " and ")))
+	}
+	declared := make(map[string]bool)
+	for _, clusterRole := range profile.ClusterRoles {
+		declared[clusterRole.Name] = true
+	}
+	var unchecked []string
+	for _, binding := range profile.ClusterRoleBindings {
+		if !declared[binding.ClusterRole] {
+			unchecked = append(unchecked, "ClusterRole/"+binding.ClusterRole)
+		}
+	}
+	for _, binding := range profile.RoleBindings {
+		if binding.Role != "" {
+			unchecked = append(unchecked, "Role/"+binding.Namespace+"/"+binding.Role)
+		} else if !declared[binding.ClusterRole] {
+			unchecked = append(unchecked, "ClusterRole/"+binding.ClusterRole)
+		}
+	}
+	if len(unchecked) > 0 {
+		notes = append(notes, "not checked for privilege escalation, the roles are read from the hosted cluster: "+strings.Join(unchecked, ", "))
+	}
+	return notes
+}
+
+// offlineReader reads the objects of a hosted cluster that is not contacted, none of them exist
+type offlineReader struct{}
+
+func (offlineReader) Get(_ context.Context, key client.ObjectKey, obj client.Object) error {
+	return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func (offlineReader) List(context.Context, client.ObjectList, ...client.ListOption) error {
+	return nil
+}
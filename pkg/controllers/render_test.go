@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"testing"
+
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	rbacmanagerv1beta1 "github.com/fairwindsops/rbac-manager/pkg/apis/rbacmanager/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHostedClusterReconciler_templatedProfile(t *testing.T) {
+	profile, err := profiles.Parse([]byte("name: team\nroleBindings:\n- namespace: '{{ .Cluster.Labels.team }}-apps'\n  clusterRole: edit\n"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	tests := []struct {
+		name          string
+		labels        map[string]string
+		wantNamespace string
+		wantErr       error
+	}{
+		{name: "renders the profile for the hosted cluster", labels: map[string]string{"team": "payments"}, wantNamespace: "payments-apps"},
+		{name: "rendering error", wantErr: errProfileRender},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			hostedClient := fake.NewClientBuilder().WithScheme(hostedScheme).Build()
+			hostedCluster := GetHostedClusterObject("test")
+			hostedCluster.SetLabels(tt.labels)
+			recorder := record.NewFakeRecorder(10)
+			r := &HostedClusterReconciler{Log: ctrl.Log.WithName("test"), Recorder: recorder, Profile: profile}
+			status, err := r.addCustomClusterAdminGroup(hostedClient, hostedCluster, []string{"alice"}, nil, ctx)
+			if !goerrors.Is(err, tt.wantErr) {
+				t.Fatalf("addCustomClusterAdminGroup() error = %v, want %v", err, tt.wantErr)
+			}
+			if status.Profile != "team" {
+				t.Errorf("status profile = %q, want team", status.Profile)
+			}
+			if tt.wantErr != nil {
+				if len(recorder.Events) != 1 {
+					t.Errorf("recorded %d events, want a ProfileRenderFailed event", len(recorder.Events))
+				}
+				return
+			}
+			rbacDefinition := rbacmanagerv1beta1.RBACDefinition{}
+			if err := hostedClient.Get(ctx, types.NamespacedName{Name: status.RBACDefinition}, &rbacDefinition); err != nil {
+				t.Fatalf("rbac definition: %v", err)
+			}
+			roleBindings := rbacDefinition.RBACBindings[0].RoleBindings
+			if len(roleBindings) != 1 || roleBindings[0].Namespace != tt.wantNamespace {
+				t.Errorf("role bindings = %+v, want edit in %s", roleBindings, tt.wantNamespace)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+
+	permissionsv1alpha1 "github.com/dana-team/permission-granter-controller/api/v1alpha1"
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	"github.com/go-logr/logr"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// rolloutWave gets a ProfileRollout and a HostedCluster
+// The function returns the index of the first wave selecting the HostedCluster, by label selector or by the hash
+// bucket of the HostedCluster falling under the percentage of the wave. HostedClusters no wave selects are in the last wave
+func rolloutWave(rollout *permissionsv1alpha1.ProfileRollout, hostedCluster client.Object) (int, error) {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(rollout.Name + "/" + hostedCluster.GetNamespace() + "/" + hostedCluster.GetName()))
+	bucket := int32(hash.Sum32() % 100)
+	for i, wave := range rollout.Spec.Waves {
+		if bucket < wave.Percentage {
+			return i, nil
+		}
+		if wave.HostedClusterSelector == nil {
+			continue
+		}
+		selector, err := v1api.LabelSelectorAsSelector(wave.HostedClusterSelector)
+		if err != nil {
+			return 0, fmt.Errorf("profile rollout %s wave %d: %w", rollout.Name, i, err)
+		}
+		if selector.Matches(labels.Set(hostedCluster.GetLabels())) {
+			return i, nil
+		}
+	}
+	return len(rollout.Spec.Waves) - 1, nil
+}
+
+// findRollout returns the ProfileRollout of the named profile, the first by name when several roll it out,
+// or nil when the profile is not being rolled out
+func findRollout(rollouts []permissionsv1alpha1.ProfileRollout, profile string) *permissionsv1alpha1.ProfileRollout {
+	var found *permissionsv1alpha1.ProfileRollout
+	for i := range rollouts {
+		if rollouts[i].Spec.Profile != profile || len(rollouts[i].Spec.Waves) == 0 {
+			continue
+		}
+		if found == nil || rollouts[i].Name < found.Name {
+			found = &rollouts[i]
+		}
+	}
+	return found
+}
+
+// applyRollout gets the context, the HostedCluster and the role profile selected for it
+// The function returns the profile the HostedCluster is given and where it is in the ProfileRollout of the selected
+// profile. Until its wave is promoted the HostedCluster is pinned to the stable profile of the rollout, and while the
+// rollout is paused only the HostedClusters already given the profile keep it
+func (r *HostedClusterReconciler) applyRollout(ctx context.Context, hostedCluster *v1alpha1.HostedCluster, profile *profiles.RoleProfile) (*profiles.RoleProfile, *access.Rollout, error) {
+	if r.Policies == nil {
+		return profile, nil, nil
+	}
+	rollouts := permissionsv1alpha1.ProfileRolloutList{}
+	if err := r.Policies.List(ctx, &rollouts); err != nil {
+		r.Log.Error(err, "could not list profile rollouts")
+		return nil, nil, err
+	}
+	rollout := findRollout(rollouts.Items, profile.Name)
+	if rollout == nil {
+		return profile, nil, nil
+	}
+	wave, err := rolloutWave(rollout, hostedCluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	status := &access.Rollout{Name: rollout.Name, Wave: wave}
+	if int32(wave) < rollout.Spec.PromotedWaves {
+		status.Promoted = rollout.Status.Phase != permissionsv1alpha1.RolloutPaused
+		if previous, _ := access.GetStatus(hostedCluster); previous != nil && previous.Rollout != nil {
+			// a paused rollout does not take the profile back from the HostedClusters already given it
+			status.Promoted = status.Promoted || (previous.Rollout.Name == rollout.Name && previous.Rollout.Promoted)
+		}
+	}
+	if status.Promoted {
+		return profile, status, nil
+	}
+	stable, ok := r.profileByName(rollout.Spec.StableProfile)
+	if !ok {
+		return nil, status, fmt.Errorf("%w: profile rollout %s pins to profile %s", errProfileNotFound, rollout.Name, rollout.Spec.StableProfile)
+	}
+	return stable, status, nil
+}
+
+// ProfileRolloutReconciler reports the progress of ProfileRollouts from the access status of the HostedClusters
+type ProfileRolloutReconciler struct {
+	Client client.Client
+	Log    logr.Logger
+}
+
+//+kubebuilder:rbac:groups=permissions.dana.io,resources=profilerollouts,verbs=get;list;watch
+//+kubebuilder:rbac:groups=permissions.dana.io,resources=profilerollouts/status,verbs=get;update;patch
+
+// Reconcile summarizes the HostedClusters of every wave of the ProfileRollout in its status
+func (r *ProfileRolloutReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	rollout := &permissionsv1alpha1.ProfileRollout{}
+	if err := r.Client.Get(ctx, req.NamespacedName, rollout); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	hostedClusters := v1alpha1.HostedClusterList{}
+	if err := r.Client.List(ctx, &hostedClusters); err != nil {
+		return ctrl.Result{}, err
+	}
+	status := summarizeRollout(rollout, hostedClusters.Items)
+	if reflect.DeepEqual(rollout.Status, status) {
+		return ctrl.Result{}, nil
+	}
+	r.Log.Info("profile rollout progressed", "profile rollout", rollout.Name, "phase", status.Phase,
+		"updated", status.Updated, "clusters", status.Clusters, "failed", status.Failed)
+	rollout.Status = status
+	return ctrl.Result{}, r.Client.Status().Update(ctx, rollout)
+}
+
+// summarizeRollout gets a ProfileRollout and the HostedClusters
+// The function returns the status of the rollout counting, for every wave, the HostedClusters in the rollout, those
+// given the profile and those given it whose access failed. The rollout is paused when more HostedClusters failed than
+// it allows, and complete when every wave is promoted and every HostedCluster was given the profile
+func summarizeRollout(rollout *permissionsv1alpha1.ProfileRollout, hostedClusters []v1alpha1.HostedCluster) permissionsv1alpha1.ProfileRolloutStatus {
+	status := permissionsv1alpha1.ProfileRolloutStatus{
+		ObservedGeneration: rollout.Generation,
+		Waves:              make([]permissionsv1alpha1.RolloutWaveStatus, len(rollout.Spec.Waves)),
+	}
+	for i := range hostedClusters {
+		accessStatus, err := access.GetStatus(&hostedClusters[i])
+		if err != nil || accessStatus == nil || accessStatus.Rollout == nil || accessStatus.Rollout.Name != rollout.Name {
+			continue
+		}
+		wave := accessStatus.Rollout.Wave
+		if wave < 0 || wave >= len(status.Waves) {
+			continue
+		}
+		status.Waves[wave].Clusters++
+		if !accessStatus.Rollout.Promoted {
+			continue
+		}
+		if accessStatus.Failed() {
+			status.Waves[wave].Failed++
+		} else {
+			status.Waves[wave].Updated++
+		}
+	}
+	for _, wave := range status.Waves {
+		status.Clusters += wave.Clusters
+		status.Updated += wave.Updated
+		status.Failed += wave.Failed
+	}
+	switch {
+	case status.Failed > rollout.Spec.MaxFailures:
+		status.Phase = permissionsv1alpha1.RolloutPaused
+	case int(rollout.Spec.PromotedWaves) >= len(rollout.Spec.Waves) && status.Updated == status.Clusters:
+		status.Phase = permissionsv1alpha1.RolloutComplete
+	default:
+		status.Phase = permissionsv1alpha1.RolloutProgressing
+	}
+	return status
+}
+
+// profileRolloutsForHostedCluster returns a request for every ProfileRollout, the access status of a changed
+// HostedCluster may count in any of them
+func (r *ProfileRolloutReconciler) profileRolloutsForHostedCluster(client.Object) []reconcile.Request {
+	rollouts := permissionsv1alpha1.ProfileRolloutList{}
+	if err := r.Client.List(context.Background(), &rollouts); err != nil {
+		r.Log.Error(err, "could not list profile rollouts for a changed hosted cluster")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(rollouts.Items))
+	for _, rollout := range rollouts.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&rollout)})
+	}
+	return requests
+}
+
+// rolloutChangedPredicate passes the ProfileRollout changes that change the profile of HostedClusters: its spec, and its
+// phase pausing or resuming it. The counts of the status change with every HostedCluster reconciled and are ignored
+var rolloutChangedPredicate = predicate.Or(predicate.GenerationChangedPredicate{}, predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldRollout, ok := e.ObjectOld.(*permissionsv1alpha1.ProfileRollout)
+		if !ok {
+			return false
+		}
+		newRollout, ok := e.ObjectNew.(*permissionsv1alpha1.ProfileRollout)
+		return ok && oldRollout.Status.Phase != newRollout.Status.Phase
+	},
+})
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ProfileRolloutReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&permissionsv1alpha1.ProfileRollout{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &v1alpha1.HostedCluster{}}, handler.EnqueueRequestsFromMapFunc(r.profileRolloutsForHostedCluster)).
+		Complete(r)
+}
@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	goerrors "errors"
+	"fmt"
+	"testing"
+
+	permissionsv1alpha1 "github.com/dana-team/permission-granter-controller/api/v1alpha1"
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func profileRollout(name string, promotedWaves int32, waves ...permissionsv1alpha1.RolloutWave) permissionsv1alpha1.ProfileRollout {
+	return permissionsv1alpha1.ProfileRollout{
+		ObjectMeta: v1api.ObjectMeta{Name: name},
+		Spec: permissionsv1alpha1.ProfileRolloutSpec{
+			Profile:       "next",
+			StableProfile: "stable",
+			Waves:         waves,
+			PromotedWaves: promotedWaves,
+		},
+	}
+}
+
+func ptrRollout(rollout permissionsv1alpha1.ProfileRollout) *permissionsv1alpha1.ProfileRollout {
+	return &rollout
+}
+
+func canaryWave() permissionsv1alpha1.RolloutWave {
+	return permissionsv1alpha1.RolloutWave{HostedClusterSelector: &v1api.LabelSelector{MatchLabels: map[string]string{"canary": "true"}}}
+}
+
+func withAccessStatus(t *testing.T, hostedCluster *v1alpha1.HostedCluster, status access.Status) *v1alpha1.HostedCluster {
+	value, err := json.Marshal(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostedCluster.SetAnnotations(map[string]string{access.StatusAnnotation: string(value)})
+	return hostedCluster
+}
+
+func TestRolloutWave(t *testing.T) {
+	rollout := profileRollout("next", 0, canaryWave(),
+		permissionsv1alpha1.RolloutWave{Percentage: 10},
+		permissionsv1alpha1.RolloutWave{Percentage: 50},
+		permissionsv1alpha1.RolloutWave{Percentage: 100},
+	)
+	counts := make([]int, len(rollout.Spec.Waves))
+	for i := 0; i < 1000; i++ {
+		hostedCluster := GetHostedClusterObject(fmt.Sprintf("cluster-%d", i))
+		wave, err := rolloutWave(&rollout, hostedCluster)
+		if err != nil {
+			t.Fatalf("rolloutWave() error = %v", err)
+		}
+		again, _ := rolloutWave(&rollout, hostedCluster)
+		if again != wave {
+			t.Fatalf("rolloutWave() = %d then %d, want a stable wave", wave, again)
+		}
+		counts[wave]++
+	}
+	// the percentages are cumulative, the waves get about 10%, 40% and 50% of the hosted clusters
+	for i, want := range []int{0, 100, 400, 500} {
+		if counts[i] < want-50 || counts[i] > want+50 {
+			t.Errorf("wave %d has %d hosted clusters, want about %d", i, counts[i], want)
+		}
+	}
+
+	canary := GetHostedClusterObject("cluster-0")
+	canary.SetLabels(map[string]string{"canary": "true"})
+	if wave, _ := rolloutWave(&rollout, canary); wave != 0 {
+		t.Errorf("rolloutWave() = %d for a canary, want 0", wave)
+	}
+	selectorOnly := profileRollout("next", 0, canaryWave(), canaryWave())
+	if wave, _ := rolloutWave(&selectorOnly, GetHostedClusterObject("test")); wave != 1 {
+		t.Errorf("rolloutWave() = %d for a hosted cluster no wave selects, want the last wave", wave)
+	}
+	invalid := profileRollout("next", 0, permissionsv1alpha1.RolloutWave{HostedClusterSelector: &v1api.LabelSelector{
+		MatchExpressions: []v1api.LabelSelectorRequirement{{Key: "canary", Operator: "Unknown"}},
+	}})
+	if _, err := rolloutWave(&invalid, GetHostedClusterObject("test")); err == nil {
+		t.Errorf("rolloutWave() with an invalid selector returned no error")
+	}
+}
+
+func TestHostedClusterReconciler_applyRollout(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = permissionsv1alpha1.AddToScheme(scheme)
+	next := &profiles.RoleProfile{Name: "next"}
+	stable := &profiles.RoleProfile{Name: "stable"}
+	promotedStatus := access.Status{Group: "group", Rollout: &access.Rollout{Name: "next", Wave: 0, Promoted: true}}
+	tests := []struct {
+		name        string
+		noPolicies  bool
+		rollout     *permissionsv1alpha1.ProfileRollout
+		phase       string
+		stable      bool
+		canary      bool
+		previous    *access.Status
+		wantProfile string
+		wantRollout *access.Rollout
+		wantErr     error
+	}{
+		{name: "no rollout", wantProfile: "next"},
+		{name: "policies disabled", noPolicies: true, rollout: ptrRollout(profileRollout("next", 0, canaryWave())), canary: true, wantProfile: "next"},
+		{
+			name:        "pinned until the wave is promoted",
+			rollout:     ptrRollout(profileRollout("next", 0, canaryWave())),
+			stable:      true,
+			canary:      true,
+			wantProfile: "stable",
+			wantRollout: &access.Rollout{Name: "next", Wave: 0},
+		},
+		{
+			name:        "promoted wave",
+			rollout:     ptrRollout(profileRollout("next", 1, canaryWave(), permissionsv1alpha1.RolloutWave{Percentage: 100})),
+			stable:      true,
+			canary:      true,
+			wantProfile: "next",
+			wantRollout: &access.Rollout{Name: "next", Wave: 0, Promoted: true},
+		},
+		{
+			name:        "later wave stays pinned",
+			rollout:     ptrRollout(profileRollout("next", 1, canaryWave(), permissionsv1alpha1.RolloutWave{Percentage: 100})),
+			stable:      true,
+			wantProfile: "stable",
+			wantRollout: &access.Rollout{Name: "next", Wave: 1},
+		},
+		{
+			name:        "paused rollout promotes no more hosted clusters",
+			rollout:     ptrRollout(profileRollout("next", 1, canaryWave())),
+			phase:       permissionsv1alpha1.RolloutPaused,
+			stable:      true,
+			canary:      true,
+			wantProfile: "stable",
+			wantRollout: &access.Rollout{Name: "next", Wave: 0},
+		},
+		{
+			name:        "paused rollout keeps promoted hosted clusters",
+			rollout:     ptrRollout(profileRollout("next", 1, canaryWave())),
+			phase:       permissionsv1alpha1.RolloutPaused,
+			stable:      true,
+			canary:      true,
+			previous:    &promotedStatus,
+			wantProfile: "next",
+			wantRollout: &access.Rollout{Name: "next", Wave: 0, Promoted: true},
+		},
+		{
+			name:        "lowering the promoted waves rolls back",
+			rollout:     ptrRollout(profileRollout("next", 0, canaryWave())),
+			stable:      true,
+			canary:      true,
+			previous:    &promotedStatus,
+			wantProfile: "stable",
+			wantRollout: &access.Rollout{Name: "next", Wave: 0},
+		},
+		{
+			name:        "unknown stable profile",
+			rollout:     ptrRollout(profileRollout("next", 0, canaryWave())),
+			canary:      true,
+			wantErr:     errProfileNotFound,
+			wantRollout: &access.Rollout{Name: "next", Wave: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(scheme)
+			if tt.rollout != nil {
+				tt.rollout.Status.Phase = tt.phase
+				builder = builder.WithObjects(tt.rollout)
+			}
+			r := &HostedClusterReconciler{
+				Log:      ctrl.Log.WithName("test"),
+				Profiles: map[string]*profiles.RoleProfile{"next": next},
+				Policies: builder.Build(),
+			}
+			if tt.stable {
+				r.Profiles["stable"] = stable
+			}
+			if tt.noPolicies {
+				r.Policies = nil
+			}
+			hostedCluster := GetHostedClusterObject("test")
+			if tt.previous != nil {
+				withAccessStatus(t, hostedCluster, *tt.previous)
+			}
+			if tt.canary {
+				hostedCluster.SetLabels(map[string]string{"canary": "true"})
+			}
+			profile, rollout, err := r.applyRollout(context.Background(), hostedCluster, next)
+			if !goerrors.Is(err, tt.wantErr) {
+				t.Fatalf("applyRollout() error = %v, want %v", err, tt.wantErr)
+			}
+			if (rollout == nil) != (tt.wantRollout == nil) || (rollout != nil && *rollout != *tt.wantRollout) {
+				t.Errorf("applyRollout() rollout = %+v, want %+v", rollout, tt.wantRollout)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if profile.Name != tt.wantProfile {
+				t.Errorf("applyRollout() profile = %s, want %s", profile.Name, tt.wantProfile)
+			}
+		})
+	}
+}
+
+func TestSummarizeRollout(t *testing.T) {
+	hostedCluster := func(name string, status *access.Status) v1alpha1.HostedCluster {
+		object := GetHostedClusterObject(name)
+		if status != nil {
+			withAccessStatus(t, object, *status)
+		}
+		return *object
+	}
+	inWave := func(wave int, promoted bool, lastError string) *access.Status {
+		return &access.Status{Group: "group", LastError: lastError, Rollout: &access.Rollout{Name: "next", Wave: wave, Promoted: promoted}}
+	}
+	hostedClusters := []v1alpha1.HostedCluster{
+		hostedCluster("canary-1", inWave(0, true, "")),
+		hostedCluster("canary-2", inWave(0, true, "could not reach the hosted cluster")),
+		hostedCluster("pinned", inWave(1, false, "")),
+		hostedCluster("other-rollout", &access.Status{Group: "group", Rollout: &access.Rollout{Name: "other", Promoted: true}}),
+		hostedCluster("no-status", nil),
+	}
+	tests := []struct {
+		name          string
+		promotedWaves int32
+		maxFailures   int32
+		clusters      []v1alpha1.HostedCluster
+		wantPhase     string
+		wantUpdated   int32
+		wantFailed    int32
+		wantClusters  int32
+	}{
+		{name: "failures within the limit", promotedWaves: 1, maxFailures: 1, clusters: hostedClusters,
+			wantPhase: permissionsv1alpha1.RolloutProgressing, wantUpdated: 1, wantFailed: 1, wantClusters: 3},
+		{name: "too many failures pause the rollout", promotedWaves: 1, clusters: hostedClusters,
+			wantPhase: permissionsv1alpha1.RolloutPaused, wantUpdated: 1, wantFailed: 1, wantClusters: 3},
+		{
+			name:          "every wave promoted and updated",
+			promotedWaves: 2,
+			clusters:      []v1alpha1.HostedCluster{hostedCluster("canary-1", inWave(0, true, "")), hostedCluster("rest", inWave(1, true, ""))},
+			wantPhase:     permissionsv1alpha1.RolloutComplete,
+			wantUpdated:   2,
+			wantClusters:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rollout := profileRollout("next", tt.promotedWaves, canaryWave(), permissionsv1alpha1.RolloutWave{Percentage: 100})
+			rollout.Spec.MaxFailures = tt.maxFailures
+			status := summarizeRollout(&rollout, tt.clusters)
+			if status.Phase != tt.wantPhase {
+				t.Errorf("summarizeRollout() phase = %s, want %s", status.Phase, tt.wantPhase)
+			}
+			if status.Updated != tt.wantUpdated || status.Failed != tt.wantFailed || status.Clusters != tt.wantClusters {
+				t.Errorf("summarizeRollout() = %d updated, %d failed of %d, want %d updated, %d failed of %d",
+					status.Updated, status.Failed, status.Clusters, tt.wantUpdated, tt.wantFailed, tt.wantClusters)
+			}
+			if len(status.Waves) != 2 {
+				t.Fatalf("summarizeRollout() waves = %+v, want 2", status.Waves)
+			}
+		})
+	}
+}
+
+func TestRolloutChangedPredicate(t *testing.T) {
+	rollout := ptrRollout(profileRollout("rollout", 1, canaryWave()))
+	rollout.Generation = 1
+	rollout.Status = permissionsv1alpha1.ProfileRolloutStatus{Phase: permissionsv1alpha1.RolloutProgressing, Updated: 1}
+	counted := rollout.DeepCopy()
+	counted.Status.Updated = 2
+	paused := rollout.DeepCopy()
+	paused.Status.Phase = permissionsv1alpha1.RolloutPaused
+	promoted := rollout.DeepCopy()
+	promoted.Generation = 2
+	tests := []struct {
+		name    string
+		updated *permissionsv1alpha1.ProfileRollout
+		want    bool
+	}{
+		{name: "status counts", updated: counted},
+		{name: "phase", updated: paused, want: true},
+		{name: "spec", updated: promoted, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rolloutChangedPredicate.Update(event.UpdateEvent{ObjectOld: rollout, ObjectNew: tt.updated}); got != tt.want {
+				t.Errorf("Update() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	goerrors "errors"
+	"reflect"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/state"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// updateAccessStatus gets the HostedCluster, the status it currently reports and the new status
+// The function patches the status annotation of the HostedCluster when the status changed.
+// A status without a group means nothing is managed at the HostedCluster anymore and removes the annotation
+func (r *HostedClusterReconciler) updateAccessStatus(ctx context.Context, hostedCluster *v1alpha1.HostedCluster, previous *access.Status, status access.Status) error {
+	if r.DryRun {
+		return nil
+	}
+	if previous != nil {
+		status.UpdatedAt = previous.UpdatedAt
+		if reflect.DeepEqual(*previous, status) {
+			return nil
+		}
+	} else if status.Group == "" && status.LastError == "" && !status.OwnerInfo {
+		return nil
+	}
+	patch := client.MergeFrom(hostedCluster.DeepCopy())
+	annotations := mergeMaps(hostedCluster.GetAnnotations(), nil)
+	if status.Group == "" && status.LastError == "" && !status.OwnerInfo {
+		delete(annotations, access.StatusAnnotation)
+	} else {
+		status.UpdatedAt = v1api.NewTime(time.Now().UTC().Truncate(time.Second))
+		value, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		annotations[access.StatusAnnotation] = string(value)
+	}
+	hostedCluster.SetAnnotations(annotations)
+	return r.Client.Patch(ctx, hostedCluster, patch)
+}
+
+// keepRecordedObjects gets the access status of a failed reconcile and the status the HostedCluster reported before it
+// The function keeps the group and RBACDefinition the last status recorded, and who is in the group, when the failed
+// reconcile did not get to record them. They are still at the hosted cluster and a later revoke has to find them
+func keepRecordedObjects(status *access.Status, previousStatus *access.Status) {
+	if previousStatus == nil {
+		return
+	}
+	if status.Group == "" {
+		status.Group = previousStatus.Group
+		status.RBACDefinition = previousStatus.RBACDefinition
+	}
+	if status.Users == nil && status.Group == previousStatus.Group {
+		status.Users = previousStatus.Users
+		status.Unnotified = previousStatus.Unnotified
+	}
+}
+
+// recordState gets the HostedCluster, the users that should have access, the access status of the last reconcile and
+// whether the hosted cluster answered, and records them in the state store served by the API
+func (r *HostedClusterReconciler) recordState(hostedCluster *v1alpha1.HostedCluster, subjects []string, status access.Status, reachable bool) {
+	if r.State == nil {
+		return
+	}
+	grants, _ := access.GetGrants(hostedCluster)
+	r.State.Set(state.ClusterState{
+		Namespace:         hostedCluster.GetNamespace(),
+		Name:              hostedCluster.GetName(),
+		Reachable:         reachable,
+		LastReconcileTime: time.Now().UTC(),
+		LastError:         status.LastError,
+		Profile:           status.Profile,
+		Group:             status.Group,
+		RBACDefinition:    status.RBACDefinition,
+		DesiredSubjects:   subjects,
+		ObservedSubjects:  status.Users,
+		Grants:            grants,
+	})
+}
+
+// forgetState removes a HostedCluster that is gone or no longer managed from the state store
+func (r *HostedClusterReconciler) forgetState(name types.NamespacedName) {
+	if r.State != nil {
+		r.State.Delete(name)
+	}
+}
+
+// isAPIError returns true if the error was returned by an API server, meaning the server was reachable
+func isAPIError(err error) bool {
+	var apiStatus apierrors.APIStatus
+	return goerrors.As(err, &apiStatus)
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+)
+
+func TestKeepRecordedObjects(t *testing.T) {
+	previous := &access.Status{Group: "admins", RBACDefinition: "admins-access", Users: []string{"alice"}, Unnotified: []string{"alice"}}
+	tests := []struct {
+		name           string
+		status         access.Status
+		previousStatus *access.Status
+		want           access.Status
+	}{
+		{
+			name:   "no previous status",
+			status: access.Status{LastError: "role profile not found"},
+			want:   access.Status{LastError: "role profile not found"},
+		},
+		{
+			name:           "failed before the group was recorded",
+			status:         access.Status{LastError: "role profile not found"},
+			previousStatus: previous,
+			want: access.Status{LastError: "role profile not found", Group: "admins", RBACDefinition: "admins-access",
+				Users: []string{"alice"}, Unnotified: []string{"alice"}},
+		},
+		{
+			name:           "failed revoke",
+			status:         access.Status{LastError: "could not delete group"},
+			previousStatus: previous,
+			want: access.Status{LastError: "could not delete group", Group: "admins", RBACDefinition: "admins-access",
+				Users: []string{"alice"}, Unnotified: []string{"alice"}},
+		},
+		{
+			name:           "failed after the group was applied",
+			status:         access.Status{LastError: "could not apply rbac definition", Group: "admins", RBACDefinition: "admins-access", Users: []string{"bob"}},
+			previousStatus: previous,
+			want:           access.Status{LastError: "could not apply rbac definition", Group: "admins", RBACDefinition: "admins-access", Users: []string{"bob"}},
+		},
+		{
+			name:           "failed after a rename",
+			status:         access.Status{LastError: "could not apply group", Group: "renamed", RBACDefinition: "renamed-access"},
+			previousStatus: previous,
+			want:           access.Status{LastError: "could not apply group", Group: "renamed", RBACDefinition: "renamed-access"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := tt.status
+			keepRecordedObjects(&status, tt.previousStatus)
+			if !reflect.DeepEqual(status, tt.want) {
+				t.Errorf("keepRecordedObjects() got: %+v want %+v", status, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// authenticatedGroup is the group the API server puts every authenticated user in
+const authenticatedGroup = "system:authenticated"
+
+// verificationRetryInterval is by default how long to wait before checking again while rbac-manager has not materialized the bindings yet
+var verificationRetryInterval = 30 * time.Second
+
+// verifyAccess gets HostedCluster client, the users of the group, the group, the access checks of the profile and context
+// The function issues a SubjectAccessReview at the hosted cluster for every user and check and returns the verification result.
+// Users are reviewed as members of the group and of system:authenticated, which every logged in user is, since group membership
+// is resolved when a user authenticates, not by the review. Permissions users hold through other groups are not covered
+func verifyAccess(ctx context.Context, hostedClient client.Client, users []string, group string, checks []profiles.AccessCheck) (*access.Verification, error) {
+	if len(checks) == 0 {
+		return nil, nil
+	}
+	verification := &access.Verification{Passed: true}
+	for _, user := range users {
+		for _, check := range checks {
+			review := &authorizationv1.SubjectAccessReview{
+				Spec: authorizationv1.SubjectAccessReviewSpec{
+					User:   user,
+					Groups: []string{group, authenticatedGroup},
+					ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Namespace:   check.Namespace,
+						Verb:        check.Verb,
+						Group:       check.Group,
+						Resource:    check.Resource,
+						Subresource: check.Subresource,
+						Name:        check.Name,
+					},
+				},
+			}
+			if err := hostedClient.Create(ctx, review); err != nil {
+				return nil, err
+			}
+			allowed := review.Status.Allowed && !review.Status.Denied
+			if allowed == (check.Expect == profiles.ExpectAllow) {
+				continue
+			}
+			verification.Passed = false
+			if allowed {
+				verification.Failures = append(verification.Failures, fmt.Sprintf("%s can %s", user, check))
+			} else {
+				verification.Failures = append(verification.Failures, fmt.Sprintf("%s cannot %s", user, check))
+			}
+		}
+	}
+	return verification, nil
+}
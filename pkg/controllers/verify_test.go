@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// reviewingClient answers SubjectAccessReviews with the permissions of the group it is given and of every authenticated user
+type reviewingClient struct {
+	client.Client
+	group         string
+	allowed       map[string]bool
+	authenticated map[string]bool
+}
+
+func (c *reviewingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	review, ok := obj.(*authorizationv1.SubjectAccessReview)
+	if !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	attributes := review.Spec.ResourceAttributes
+	key := attributes.Verb + " " + attributes.Resource + " " + attributes.Namespace
+	for _, group := range review.Spec.Groups {
+		switch group {
+		case c.group:
+			review.Status.Allowed = review.Status.Allowed || c.allowed[key]
+		case "system:authenticated":
+			review.Status.Allowed = review.Status.Allowed || c.authenticated[key]
+		}
+	}
+	return nil
+}
+
+func TestVerifyAccess(t *testing.T) {
+	hostedClient := &reviewingClient{
+		Client:        fake.NewClientBuilder().WithScheme(hostedScheme).Build(),
+		group:         "test-admins",
+		allowed:       map[string]bool{"create deployments apps": true},
+		authenticated: map[string]bool{"get projects ": true},
+	}
+	createDeployments := profiles.AccessCheck{Verb: "create", Group: "apps", Resource: "deployments", Namespace: "apps", Expect: profiles.ExpectAllow}
+	deleteNodes := profiles.AccessCheck{Verb: "delete", Resource: "nodes", Expect: profiles.ExpectDeny}
+	tests := []struct {
+		name   string
+		group  string
+		checks []profiles.AccessCheck
+		want   *access.Verification
+	}{
+		{name: "no checks", group: "test-admins"},
+		{
+			name:   "passed",
+			group:  "test-admins",
+			checks: []profiles.AccessCheck{createDeployments, deleteNodes},
+			want:   &access.Verification{Passed: true},
+		},
+		{
+			name:   "bindings not materialized yet",
+			group:  "other-admins",
+			checks: []profiles.AccessCheck{createDeployments, deleteNodes},
+			want: &access.Verification{Failures: []string{
+				"alice cannot create deployments.apps in apps",
+				"bob cannot create deployments.apps in apps",
+			}},
+		},
+		{
+			name:   "allowed more than expected",
+			group:  "test-admins",
+			checks: []profiles.AccessCheck{{Verb: "create", Resource: "deployments", Namespace: "apps", Expect: profiles.ExpectDeny}},
+			want:   &access.Verification{Failures: []string{"alice can create deployments in apps", "bob can create deployments in apps"}},
+		},
+		{
+			name:   "allowed to every authenticated user",
+			group:  "test-admins",
+			checks: []profiles.AccessCheck{{Verb: "get", Resource: "projects", Expect: profiles.ExpectDeny}},
+			want:   &access.Verification{Failures: []string{"alice can get projects", "bob can get projects"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifyAccess(context.Background(), hostedClient, []string{"alice", "bob"}, tt.group, tt.checks)
+			if err != nil {
+				t.Fatalf("verifyAccess() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("verifyAccess() got %+v want %+v", got, tt.want)
+			}
+		})
+	}
+}
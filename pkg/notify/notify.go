@@ -0,0 +1,129 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Notification tells a user they were given access to a hosted cluster and how to log in
+type Notification struct {
+	// User is the user that was given access, as it appears in the custom cluster admin group
+	User       string     `json:"user"`
+	Cluster    string     `json:"cluster"`
+	Namespace  string     `json:"namespace"`
+	APIURL     string     `json:"apiURL,omitempty"`
+	ConsoleURL string     `json:"consoleURL,omitempty"`
+	Profile    string     `json:"profile,omitempty"`
+	GrantedBy  string     `json:"grantedBy,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Notifier delivers notifications
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// Multi delivers every notification with each of the notifiers, a failing notifier does not stop the others
+type Multi []Notifier
+
+// Notify delivers the notification with every notifier and returns their errors joined
+func (m Multi) Notify(ctx context.Context, notification Notification) error {
+	var errs []string
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, notification); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// DefaultSubjectTemplate and DefaultBodyTemplate are used unless other templates are configured.
+// Templates are executed with a Notification
+var (
+	DefaultSubjectTemplate = `Access granted to hosted cluster {{ .Cluster }}`
+	DefaultBodyTemplate    = `Hello {{ .User }},
+
+You were given access to the hosted cluster {{ .Namespace }}/{{ .Cluster }}{{ with .Profile }} with the {{ . }} role profile{{ end }}{{ with .GrantedBy }} by {{ . }}{{ end }}.
+{{ with .APIURL }}
+Log in with:
+  oc login {{ . }}
+{{ end }}{{ with .ConsoleURL }}
+Web console: {{ . }}
+{{ end }}{{ with .ExpiresAt }}
+Your access expires at {{ .UTC.Format "2006-01-02 15:04 MST" }}.
+{{ end }}`
+)
+
+// Templates render the subject and text of notifications
+type Templates struct {
+	Subject *template.Template
+	Body    *template.Template
+}
+
+// DefaultTemplates returns the default subject and body templates
+func DefaultTemplates() Templates {
+	templates, err := ParseTemplates(DefaultSubjectTemplate, DefaultBodyTemplate)
+	if err != nil {
+		panic(err)
+	}
+	return templates
+}
+
+// ParseTemplates parses the subject and body templates, missing keys fail the execution
+func ParseTemplates(subject string, body string) (Templates, error) {
+	subjectTemplate, err := template.New("subject").Option("missingkey=error").Parse(subject)
+	if err != nil {
+		return Templates{}, fmt.Errorf("invalid subject template: %w", err)
+	}
+	bodyTemplate, err := template.New("body").Option("missingkey=error").Parse(body)
+	if err != nil {
+		return Templates{}, fmt.Errorf("invalid body template: %w", err)
+	}
+	return Templates{Subject: subjectTemplate, Body: bodyTemplate}, nil
+}
+
+// LoadTemplates reads the subject and body templates from files, the default is used for an empty path
+func LoadTemplates(subjectPath string, bodyPath string) (Templates, error) {
+	subject, body := DefaultSubjectTemplate, DefaultBodyTemplate
+	if subjectPath != "" {
+		data, err := os.ReadFile(subjectPath)
+		if err != nil {
+			return Templates{}, err
+		}
+		subject = strings.TrimSpace(string(data))
+	}
+	if bodyPath != "" {
+		data, err := os.ReadFile(bodyPath)
+		if err != nil {
+			return Templates{}, err
+		}
+		body = string(data)
+	}
+	return ParseTemplates(subject, body)
+}
+
+// Render returns the subject and body of the notification
+func (t Templates) Render(notification Notification) (string, string, error) {
+	if t.Subject == nil || t.Body == nil {
+		t = DefaultTemplates()
+	}
+	subject := bytes.Buffer{}
+	if err := t.Subject.Execute(&subject, notification); err != nil {
+		return "", "", err
+	}
+	body := bytes.Buffer{}
+	if err := t.Body.Execute(&body, notification); err != nil {
+		return "", "", err
+	}
+	// a subject is a single header line
+	return strings.Join(strings.Fields(subject.String()), " "), body.String(), nil
+}
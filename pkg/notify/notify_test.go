@@ -0,0 +1,190 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testNotification() Notification {
+	expiresAt := time.Date(2022, 10, 2, 12, 0, 0, 0, time.UTC)
+	return Notification{
+		User:       "alice",
+		Cluster:    "test",
+		Namespace:  "clusters",
+		APIURL:     "https://api.test.example.com:6443",
+		ConsoleURL: "https://console-openshift-console.apps.test.example.com",
+		Profile:    "developers",
+		GrantedBy:  "admin",
+		ExpiresAt:  &expiresAt,
+	}
+}
+
+func TestTemplates_Render(t *testing.T) {
+	custom, err := ParseTemplates("{{ .Cluster }}\nready", "{{ .User }} {{ .Profile }}")
+	if err != nil {
+		t.Fatalf("ParseTemplates() error = %v", err)
+	}
+	missingKey, err := ParseTemplates("{{ .Unknown }}", "")
+	if err != nil {
+		t.Fatalf("ParseTemplates() error = %v", err)
+	}
+	tests := []struct {
+		name        string
+		templates   Templates
+		wantSubject string
+		wantBody    []string
+		wantErr     bool
+	}{
+		{
+			name:        "default",
+			wantSubject: "Access granted to hosted cluster test",
+			wantBody: []string{
+				"You were given access to the hosted cluster clusters/test with the developers role profile by admin.",
+				"oc login https://api.test.example.com:6443",
+				"Web console: https://console-openshift-console.apps.test.example.com",
+				"Your access expires at 2022-10-02 12:00 UTC.",
+			},
+		},
+		{
+			name:        "custom subject is a single line",
+			templates:   custom,
+			wantSubject: "test ready",
+			wantBody:    []string{"alice developers"},
+		},
+		{
+			name:      "unknown field",
+			templates: missingKey,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, body, err := tt.templates.Render(testNotification())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if subject != tt.wantSubject {
+				t.Errorf("subject got: %q want %q", subject, tt.wantSubject)
+			}
+			for _, line := range tt.wantBody {
+				if !strings.Contains(body, line) {
+					t.Errorf("body %q does not contain %q", body, line)
+				}
+			}
+		})
+	}
+}
+
+// fakeSMTPServer accepts a single message and sends its recipient and data to the returned channels
+func fakeSMTPServer(t *testing.T) (string, chan string, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	recipients := make(chan string, 1)
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				recipients <- strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>")
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 go ahead")
+				data := strings.Builder{}
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				messages <- data.String()
+				reply("250 OK")
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return listener.Addr().String(), recipients, messages
+}
+
+func TestSMTPNotifier_Notify(t *testing.T) {
+	addr, recipients, messages := fakeSMTPServer(t)
+	notifier := &SMTPNotifier{Addr: addr, From: "controller@example.com", Domain: "example.com"}
+	if err := notifier.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if recipient := <-recipients; recipient != "alice@example.com" {
+		t.Errorf("recipient got: %s want alice@example.com", recipient)
+	}
+	message := <-messages
+	for _, want := range []string{"To: alice@example.com\r\n", "Subject: Access granted to hosted cluster test\r\n", "oc login https://api.test.example.com:6443\r\n"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("message %q does not contain %q", message, want)
+		}
+	}
+
+	// a server that accepts the connection but never greets must not block the reconcile past its context
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer listener.Close()
+	silent := &SMTPNotifier{Addr: listener.Addr().String(), From: "controller@example.com", Domain: "example.com"}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := silent.Notify(ctx, testNotification()); err == nil {
+		t.Errorf("Notify() expected an error for a server that does not answer")
+	}
+
+	withoutDomain := &SMTPNotifier{Addr: addr, From: "controller@example.com"}
+	if err := withoutDomain.Notify(context.Background(), testNotification()); err == nil {
+		t.Errorf("Notify() expected an error for a user without an email address")
+	}
+}
+
+func TestWebhookNotifier_Notify(t *testing.T) {
+	var payload map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+	notifier := &WebhookNotifier{URL: server.URL}
+	if err := notifier.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if payload["user"] != "alice" || payload["apiURL"] != "https://api.test.example.com:6443" ||
+		payload["subject"] != "Access granted to hosted cluster test" || !strings.Contains(payload["text"].(string), "oc login") {
+		t.Errorf("unexpected payload %v", payload)
+	}
+}
@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// smtpTimeout bounds sending an email when the context has no earlier deadline
+const smtpTimeout = 30 * time.Second
+
+// SMTPNotifier emails the notification to the user
+type SMTPNotifier struct {
+	// Addr is the host:port of the SMTP server
+	Addr string
+	From string
+	// Username and Password authenticate with PLAIN auth when Username is set, the server must then offer TLS
+	Username string
+	Password string
+	// Domain is appended to users that are not email addresses, e.g. alice becomes alice@Domain
+	Domain    string
+	Templates Templates
+}
+
+// Notify sends the notification email
+func (s *SMTPNotifier) Notify(ctx context.Context, notification Notification) error {
+	to, err := s.recipient(notification.User)
+	if err != nil {
+		return err
+	}
+	subject, body, err := s.Templates.Render(notification)
+	if err != nil {
+		return err
+	}
+	message := strings.Builder{}
+	for _, header := range [][2]string{
+		{"From", s.From},
+		{"To", to},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", `text/plain; charset="utf-8"`},
+	} {
+		fmt.Fprintf(&message, "%s: %s\r\n", header[0], header[1])
+	}
+	message.WriteString("\r\n")
+	message.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+
+	return s.send(ctx, to, []byte(message.String()))
+}
+
+// send delivers the message to the recipient like smtp.SendMail, the connection is closed when the context is done
+// or its deadline, at most smtpTimeout from now, passes
+func (s *SMTPNotifier) send(ctx context.Context, to string, message []byte) error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("smtp server %s does not support authentication", s.Addr)
+		}
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	writer, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// recipient returns the email address of a user
+func (s *SMTPNotifier) recipient(user string) (string, error) {
+	address := user
+	if !strings.Contains(user, "@") {
+		if s.Domain == "" {
+			return "", fmt.Errorf("user %s is not an email address and no email domain is configured", user)
+		}
+		address = user + "@" + s.Domain
+	}
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid email address for user %s: %w", user, err)
+	}
+	return parsed.Address, nil
+}
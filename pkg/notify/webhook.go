@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WebhookNotifier posts the notification as JSON, with the rendered subject and text, to an HTTP endpoint
+type WebhookNotifier struct {
+	URL string
+	// Headers are added to every request, e.g. an Authorization header
+	Headers   map[string]string
+	Templates Templates
+	// Client sends the requests, a client with a 10 seconds timeout is used when nil
+	Client *http.Client
+}
+
+// webhookPayload is the body posted to the webhook
+type webhookPayload struct {
+	Notification
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+}
+
+// Notify posts the notification to the webhook, any response other than 2xx is an error
+func (w *WebhookNotifier) Notify(ctx context.Context, notification Notification) error {
+	subject, text, err := w.Templates.Render(notification)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(webhookPayload{Notification: notification, Subject: subject, Text: text})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range w.Headers {
+		request.Header.Set(key, value)
+	}
+	httpClient := w.Client
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("notification webhook %s returned %s", w.URL, response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,449 @@
+// Package permissions expands role profiles into the verbs they give on every resource of a hosted cluster
+// and compares them with cluster-admin
+package permissions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	rbacv1 "k8s.io/api/rbac/v1"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// nonResourceVerbs are the verbs requests to non resource URLs are authorized for
+var nonResourceVerbs = []string{"get", "head", "post", "put", "patch", "delete", "options"}
+
+// Snapshot is the discovery data and the roles of a hosted cluster a profile is expanded against
+type Snapshot struct {
+	Resources    []v1api.APIResourceList `json:"resources"`
+	ClusterRoles []rbacv1.ClusterRole    `json:"clusterRoles,omitempty"`
+	Roles        []rbacv1.Role           `json:"roles,omitempty"`
+}
+
+// Fetch reads the preferred resources and the roles of a hosted cluster into a snapshot.
+// API groups that fail discovery are left out, as kubectl does
+func Fetch(ctx context.Context, clientset kubernetes.Interface) (*Snapshot, error) {
+	lists, err := clientset.Discovery().ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+	snapshot := &Snapshot{}
+	for _, list := range lists {
+		if list != nil {
+			snapshot.Resources = append(snapshot.Resources, *list)
+		}
+	}
+	clusterRoles, err := clientset.RbacV1().ClusterRoles().List(ctx, v1api.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, clusterRole := range clusterRoles.Items {
+		clusterRole.ManagedFields = nil
+		snapshot.ClusterRoles = append(snapshot.ClusterRoles, clusterRole)
+	}
+	roles, err := clientset.RbacV1().Roles("").List(ctx, v1api.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles.Items {
+		role.ManagedFields = nil
+		snapshot.Roles = append(snapshot.Roles, role)
+	}
+	return snapshot, nil
+}
+
+// LoadSnapshot reads a snapshot saved in YAML or JSON at path
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{}
+	if err := yaml.Unmarshal(data, snapshot); err != nil {
+		return nil, err
+	}
+	if len(snapshot.Resources) == 0 {
+		return nil, fmt.Errorf("snapshot %s has no resources", path)
+	}
+	return snapshot, nil
+}
+
+// Resource is an API resource of the hosted cluster and the verbs it supports
+type Resource struct {
+	Group      string
+	Resource   string
+	Namespaced bool
+	Verbs      []string
+}
+
+// String returns the resource qualified by its group, e.g. "deployments.apps"
+func (r Resource) String() string {
+	if r.Group == "" {
+		return r.Resource
+	}
+	return r.Resource + "." + r.Group
+}
+
+// resources returns the resources of the snapshot supporting at least one verb, sorted by group and resource
+func (s *Snapshot) resources() ([]Resource, error) {
+	seen := make(map[string]bool)
+	var resources []Resource
+	for _, list := range s.Resources {
+		groupVersion, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, apiResource := range list.APIResources {
+			resource := Resource{Group: groupVersion.Group, Resource: apiResource.Name, Namespaced: apiResource.Namespaced, Verbs: apiResource.Verbs}
+			if len(resource.Verbs) == 0 || seen[resource.String()] {
+				continue
+			}
+			seen[resource.String()] = true
+			resources = append(resources, resource)
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Group != resources[j].Group {
+			return resources[i].Group < resources[j].Group
+		}
+		return resources[i].Resource < resources[j].Resource
+	})
+	return resources, nil
+}
+
+// PartialVerb is a verb a profile gives only in some namespaces, or for non resource URLs only on some URLs
+type PartialVerb struct {
+	Verb string   `json:"verb"`
+	Only []string `json:"only"`
+}
+
+// Entry is a resource, or the non resource URLs, on which a profile does not give every verb cluster-admin has
+type Entry struct {
+	Group          string `json:"group,omitempty"`
+	Resource       string `json:"resource,omitempty"`
+	NonResourceURL string `json:"nonResourceURL,omitempty"`
+	Namespaced     bool   `json:"namespaced"`
+	// Missing are the verbs the profile does not give at all
+	Missing []string `json:"missing,omitempty"`
+	// Partial are the verbs the profile gives in some namespaces, or on some URLs, only
+	Partial []PartialVerb `json:"partial,omitempty"`
+}
+
+// Diff lists what a role profile cannot do compared to cluster-admin
+type Diff struct {
+	Profile string `json:"profile"`
+	// Resources is the number of resources compared
+	Resources int     `json:"resources"`
+	Entries   []Entry `json:"entries"`
+	// Unresolved are the roles the profile binds that are not in the snapshot, they are counted as giving nothing
+	Unresolved []string `json:"unresolved,omitempty"`
+}
+
+// grant is a set of rules given cluster wide, when scope is empty, or in the namespaces scope describes
+type grant struct {
+	rules []rbacv1.PolicyRule
+	scope string
+}
+
+// Compare expands the profile against the snapshot into the verbs it gives on every resource, cluster wide or in some
+// namespaces, and returns the verbs cluster-admin has that the profile does not give cluster wide.
+// Rules restricted to resource names give access to single objects only and are not counted
+func Compare(profile *profiles.RoleProfile, snapshot *Snapshot) (*Diff, error) {
+	resources, err := snapshot.resources()
+	if err != nil {
+		return nil, err
+	}
+	grants, unresolved := expand(profile, snapshot)
+	diff := &Diff{Profile: profile.Name, Resources: len(resources), Entries: []Entry{}, Unresolved: unresolved}
+	for _, resource := range resources {
+		entry := Entry{Group: resource.Group, Resource: resource.Resource, Namespaced: resource.Namespaced}
+		for _, verb := range resource.Verbs {
+			var only []string
+			cluster := false
+			for _, grant := range grants {
+				if !grantsResource(grant.rules, resource, verb) {
+					continue
+				}
+				if grant.scope == "" {
+					cluster = true
+					break
+				}
+				// a role bound in a namespace gives nothing on cluster scoped resources
+				if resource.Namespaced {
+					only = appendUnique(only, grant.scope)
+				}
+			}
+			switch {
+			case cluster:
+			case len(only) > 0:
+				entry.Partial = append(entry.Partial, PartialVerb{Verb: verb, Only: only})
+			default:
+				entry.Missing = append(entry.Missing, verb)
+			}
+		}
+		if len(entry.Missing) > 0 || len(entry.Partial) > 0 {
+			diff.Entries = append(diff.Entries, entry)
+		}
+	}
+	// cluster-admin is given every verb on every non resource URL, roles bound in a namespace give none
+	entry := Entry{NonResourceURL: "*"}
+	for _, verb := range nonResourceVerbs {
+		var only []string
+		cluster := false
+		for _, grant := range grants {
+			if grant.scope != "" {
+				continue
+			}
+			for _, rule := range grant.rules {
+				if !contains(rule.Verbs, verb) && !contains(rule.Verbs, rbacv1.VerbAll) {
+					continue
+				}
+				for _, url := range rule.NonResourceURLs {
+					if url == "*" {
+						cluster = true
+					}
+					only = appendUnique(only, url)
+				}
+			}
+		}
+		switch {
+		case cluster:
+		case len(only) > 0:
+			sort.Strings(only)
+			entry.Partial = append(entry.Partial, PartialVerb{Verb: verb, Only: only})
+		default:
+			entry.Missing = append(entry.Missing, verb)
+		}
+	}
+	if len(entry.Missing) > 0 || len(entry.Partial) > 0 {
+		diff.Entries = append(diff.Entries, entry)
+	}
+	return diff, nil
+}
+
+// expand returns the rules the profile gives and the scope they are given in, and the roles it binds that the
+// snapshot does not have. The ClusterRoles the profile declares replace those of the snapshot and take part in aggregation
+func expand(profile *profiles.RoleProfile, snapshot *Snapshot) ([]grant, []string) {
+	clusterRoles := make(map[string][]rbacv1.PolicyRule)
+	for _, clusterRole := range snapshot.ClusterRoles {
+		clusterRoles[clusterRole.Name] = clusterRole.Rules
+	}
+	for _, declared := range profile.ClusterRoles {
+		clusterRoles[declared.Name] = declared.Rules
+	}
+	// roles of the snapshot are already aggregated, only the declared ClusterRoles are aggregated into them
+	for _, clusterRole := range snapshot.ClusterRoles {
+		for _, declared := range profile.ClusterRoles {
+			if declared.Name != clusterRole.Name && aggregates(clusterRole.AggregationRule, declared.Labels) {
+				clusterRoles[clusterRole.Name] = append(clusterRoles[clusterRole.Name], declared.Rules...)
+			}
+		}
+	}
+	for _, declared := range profile.ClusterRoles {
+		if declared.AggregationRule == nil {
+			continue
+		}
+		for _, clusterRole := range snapshot.ClusterRoles {
+			if clusterRole.Name != declared.Name && aggregates(declared.AggregationRule, clusterRole.Labels) {
+				clusterRoles[declared.Name] = append(clusterRoles[declared.Name], clusterRole.Rules...)
+			}
+		}
+		for _, other := range profile.ClusterRoles {
+			if other.Name != declared.Name && aggregates(declared.AggregationRule, other.Labels) {
+				clusterRoles[declared.Name] = append(clusterRoles[declared.Name], other.Rules...)
+			}
+		}
+	}
+	roles := make(map[string][]rbacv1.PolicyRule)
+	roleNames := make(map[string][]rbacv1.PolicyRule)
+	for _, role := range snapshot.Roles {
+		roles[role.Namespace+"/"+role.Name] = role.Rules
+		roleNames[role.Name] = append(roleNames[role.Name], role.Rules...)
+	}
+
+	var grants []grant
+	unresolved := make(map[string]bool)
+	add := func(kind, name string, rules []rbacv1.PolicyRule, found bool, scope string) {
+		if !found {
+			unresolved[kind+"/"+name] = true
+			return
+		}
+		grants = append(grants, grant{rules: rules, scope: scope})
+	}
+	for _, clusterRoleBinding := range profile.ClusterRoleBindings {
+		rules, found := clusterRoles[clusterRoleBinding.ClusterRole]
+		add("ClusterRole", clusterRoleBinding.ClusterRole, rules, found, "")
+	}
+	for _, roleBinding := range profile.RoleBindings {
+		if roleBinding.ClusterRole != "" {
+			rules, found := clusterRoles[roleBinding.ClusterRole]
+			add("ClusterRole", roleBinding.ClusterRole, rules, found, roleBinding.Namespace)
+			continue
+		}
+		name := roleBinding.Namespace + "/" + roleBinding.Role
+		rules, found := roles[name]
+		add("Role", name, rules, found, roleBinding.Namespace)
+	}
+	for _, roleBinding := range profile.NamespaceRoleBindings {
+		scope := describeSelection(roleBinding)
+		if roleBinding.ClusterRole != "" {
+			rules, found := clusterRoles[roleBinding.ClusterRole]
+			add("ClusterRole", roleBinding.ClusterRole, rules, found, scope)
+			continue
+		}
+		// the namespaces the binding selects are not known offline, the rules of every Role of that name are counted
+		rules, found := roleNames[roleBinding.Role]
+		add("Role", roleBinding.Role, rules, found, scope)
+	}
+	var unresolvedNames []string
+	for name := range unresolved {
+		unresolvedNames = append(unresolvedNames, name)
+	}
+	sort.Strings(unresolvedNames)
+	return grants, unresolvedNames
+}
+
+// describeSelection describes the namespaces a namespace role binding selects, e.g. "team-* with env=dev"
+func describeSelection(binding profiles.NamespaceRoleBinding) string {
+	var parts []string
+	if binding.NamespacePattern != "" {
+		parts = append(parts, binding.NamespacePattern)
+	}
+	if binding.NamespaceSelector != nil {
+		parts = append(parts, v1api.FormatLabelSelector(binding.NamespaceSelector))
+	}
+	return strings.Join(parts, " with ")
+}
+
+// aggregates returns true when a ClusterRole with the labels is aggregated by the aggregation rule
+func aggregates(aggregationRule *rbacv1.AggregationRule, roleLabels map[string]string) bool {
+	if aggregationRule == nil {
+		return false
+	}
+	for i := range aggregationRule.ClusterRoleSelectors {
+		selector, err := v1api.LabelSelectorAsSelector(&aggregationRule.ClusterRoleSelectors[i])
+		if err == nil && !selector.Empty() && selector.Matches(labels.Set(roleLabels)) {
+			return true
+		}
+	}
+	return false
+}
+
+// grantsResource returns true when one of the rules gives the verb on every object of the resource,
+// matching resources and subresources the way the RBAC authorizer does
+func grantsResource(rules []rbacv1.PolicyRule, resource Resource, verb string) bool {
+	for _, rule := range rules {
+		if len(rule.ResourceNames) > 0 || !(contains(rule.Verbs, verb) || contains(rule.Verbs, rbacv1.VerbAll)) {
+			continue
+		}
+		if !contains(rule.APIGroups, resource.Group) && !contains(rule.APIGroups, rbacv1.APIGroupAll) {
+			continue
+		}
+		for _, ruleResource := range rule.Resources {
+			if ruleResource == rbacv1.ResourceAll || ruleResource == resource.Resource {
+				return true
+			}
+			if index := strings.Index(resource.Resource, "/"); index >= 0 && ruleResource == "*"+resource.Resource[index:] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(items []string, item string) bool {
+	for _, candidate := range items {
+		if candidate == item {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(items []string, item string) []string {
+	if contains(items, item) {
+		return items
+	}
+	return append(items, item)
+}
+
+// WriteJSON writes the diff as indented JSON
+func (d *Diff) WriteJSON(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(d)
+}
+
+// WriteTable writes the diff as a table with a row per resource, verbs given in some namespaces only are listed
+// with the namespaces, followed by a summary
+func (d *Diff) WriteTable(out io.Writer) error {
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "RESOURCE\tSCOPE\tMISSING\tPARTIAL")
+	for _, entry := range d.Entries {
+		name, scope := entry.NonResourceURL, "nonResourceURL"
+		if entry.NonResourceURL == "" {
+			name = Resource{Group: entry.Group, Resource: entry.Resource}.String()
+			scope = "cluster"
+			if entry.Namespaced {
+				scope = "namespaced"
+			}
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", name, scope, orDash(strings.Join(entry.Missing, ",")), orDash(formatPartial(entry.Partial)))
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nprofile %s does not give every verb of cluster-admin on %d of %d resources\n", d.Profile, d.resourceEntries(), d.Resources)
+	if len(d.Unresolved) > 0 {
+		fmt.Fprintf(out, "roles not found at the hosted cluster, counted as giving nothing: %s\n", strings.Join(d.Unresolved, ", "))
+	}
+	return nil
+}
+
+// resourceEntries returns the number of entries that are resources, not non resource URLs
+func (d *Diff) resourceEntries() int {
+	count := 0
+	for _, entry := range d.Entries {
+		if entry.NonResourceURL == "" {
+			count++
+		}
+	}
+	return count
+}
+
+// formatPartial groups the verbs given in the same namespaces, e.g. "get,list in apps,dev; create in apps"
+func formatPartial(partial []PartialVerb) string {
+	var groups []string
+	verbs := make(map[string][]string)
+	for _, verb := range partial {
+		only := strings.Join(verb.Only, ",")
+		if _, ok := verbs[only]; !ok {
+			groups = append(groups, only)
+		}
+		verbs[only] = append(verbs[only], verb.Verb)
+	}
+	var parts []string
+	for _, only := range groups {
+		parts = append(parts, strings.Join(verbs[only], ",")+" in "+only)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func orDash(text string) string {
+	if text == "" {
+		return "-"
+	}
+	return text
+}
@@ -0,0 +1,187 @@
+package permissions
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dana-team/permission-granter-controller/pkg/profiles"
+	rbacmanagerv1beta1 "github.com/fairwindsops/rbac-manager/pkg/apis/rbacmanager/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func testSnapshot() *Snapshot {
+	return &Snapshot{
+		Resources: []v1api.APIResourceList{
+			{GroupVersion: "v1", APIResources: []v1api.APIResource{
+				{Name: "configmaps", Namespaced: true, Verbs: []string{"get", "list", "create", "delete"}},
+				{Name: "nodes", Namespaced: false, Verbs: []string{"get", "list"}},
+				{Name: "pods", Namespaced: true, Verbs: []string{"get", "delete"}},
+				{Name: "pods/log", Namespaced: true, Verbs: []string{"get"}},
+				{Name: "bindings", Namespaced: true},
+			}},
+			{GroupVersion: "apps/v1", APIResources: []v1api.APIResource{
+				{Name: "deployments", Namespaced: true, Verbs: []string{"get", "create"}},
+			}},
+		},
+		ClusterRoles: []rbacv1.ClusterRole{
+			{
+				ObjectMeta: v1api.ObjectMeta{Name: "cluster-admin"},
+				Rules: []rbacv1.PolicyRule{
+					{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}},
+					{NonResourceURLs: []string{"*"}, Verbs: []string{"*"}},
+				},
+			},
+			{
+				ObjectMeta: v1api.ObjectMeta{Name: "view"},
+				Rules: []rbacv1.PolicyRule{
+					{APIGroups: []string{"", "apps"}, Resources: []string{"configmaps", "pods", "pods/log", "deployments"}, Verbs: []string{"get", "list"}},
+				},
+			},
+			{
+				ObjectMeta:      v1api.ObjectMeta{Name: "edit"},
+				AggregationRule: &rbacv1.AggregationRule{ClusterRoleSelectors: []v1api.LabelSelector{{MatchLabels: map[string]string{"aggregate-to-edit": "true"}}}},
+				Rules: []rbacv1.PolicyRule{
+					{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"*"}},
+				},
+			},
+		},
+		Roles: []rbacv1.Role{
+			{
+				ObjectMeta: v1api.ObjectMeta{Name: "pod-deleter", Namespace: "apps"},
+				Rules:      []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"delete"}}},
+			},
+		},
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name           string
+		profile        profiles.RoleProfile
+		wantEntries    []Entry
+		wantUnresolved []string
+	}{
+		{
+			name: "cluster-admin differs in nothing",
+			profile: profiles.RoleProfile{Name: "admin", ClusterRoleBindings: []rbacmanagerv1beta1.ClusterRoleBinding{
+				{ClusterRole: "cluster-admin"},
+			}},
+			wantEntries: []Entry{},
+		},
+		{
+			name: "view cluster wide and edit in a namespace",
+			profile: profiles.RoleProfile{
+				Name:                "viewer",
+				ClusterRoleBindings: []rbacmanagerv1beta1.ClusterRoleBinding{{ClusterRole: "view"}},
+				RoleBindings: []rbacmanagerv1beta1.RoleBinding{
+					{Namespace: "apps", ClusterRole: "edit"},
+					{Namespace: "apps", Role: "pod-deleter"},
+					{Namespace: "dev", Role: "missing"},
+				},
+			},
+			wantEntries: []Entry{
+				{Resource: "configmaps", Namespaced: true, Partial: []PartialVerb{{Verb: "create", Only: []string{"apps"}}, {Verb: "delete", Only: []string{"apps"}}}},
+				{Resource: "nodes", Missing: []string{"get", "list"}},
+				{Resource: "pods", Namespaced: true, Partial: []PartialVerb{{Verb: "delete", Only: []string{"apps"}}}},
+				{Group: "apps", Resource: "deployments", Namespaced: true, Missing: []string{"create"}},
+				{NonResourceURL: "*", Missing: nonResourceVerbs},
+			},
+			wantUnresolved: []string{"Role/dev/missing"},
+		},
+		{
+			name: "declared cluster roles aggregate and wildcard subresources",
+			profile: profiles.RoleProfile{
+				Name: "declared",
+				ClusterRoles: []profiles.ClusterRole{
+					{
+						Name:   "node-reader",
+						Labels: map[string]string{"aggregate-to-edit": "true"},
+						Rules:  []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get", "list"}}},
+					},
+					{
+						Name:  "logs",
+						Rules: []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"*/log"}, Verbs: []string{"get"}}},
+					},
+					{
+						Name:  "health",
+						Rules: []rbacv1.PolicyRule{{NonResourceURLs: []string{"/healthz", "/readyz"}, Verbs: []string{"get"}}},
+					},
+				},
+				ClusterRoleBindings: []rbacmanagerv1beta1.ClusterRoleBinding{{ClusterRole: "edit"}, {ClusterRole: "logs"}, {ClusterRole: "health"}},
+				NamespaceRoleBindings: []profiles.NamespaceRoleBinding{
+					{ClusterRole: "view", NamespacePattern: "team-*"},
+				},
+			},
+			wantEntries: []Entry{
+				{Resource: "pods", Namespaced: true, Missing: []string{"delete"}, Partial: []PartialVerb{{Verb: "get", Only: []string{"team-*"}}}},
+				{Group: "apps", Resource: "deployments", Namespaced: true, Missing: []string{"create"}, Partial: []PartialVerb{{Verb: "get", Only: []string{"team-*"}}}},
+				{NonResourceURL: "*", Missing: []string{"head", "post", "put", "patch", "delete", "options"},
+					Partial: []PartialVerb{{Verb: "get", Only: []string{"/healthz", "/readyz"}}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := Compare(&tt.profile, testSnapshot())
+			if err != nil {
+				t.Fatalf("Compare() error = %v", err)
+			}
+			if diff.Resources != 5 {
+				t.Errorf("Compare() compared %d resources, want 5", diff.Resources)
+			}
+			if !reflect.DeepEqual(diff.Entries, tt.wantEntries) {
+				t.Errorf("Compare() entries = %+v, want %+v", diff.Entries, tt.wantEntries)
+			}
+			if !reflect.DeepEqual(diff.Unresolved, tt.wantUnresolved) {
+				t.Errorf("Compare() unresolved = %v, want %v", diff.Unresolved, tt.wantUnresolved)
+			}
+		})
+	}
+}
+
+func TestDiff_WriteTable(t *testing.T) {
+	diff := &Diff{
+		Profile:   "viewer",
+		Resources: 5,
+		Entries: []Entry{
+			{Group: "apps", Resource: "deployments", Namespaced: true, Missing: []string{"create"},
+				Partial: []PartialVerb{{Verb: "get", Only: []string{"apps", "dev"}}, {Verb: "list", Only: []string{"apps", "dev"}}, {Verb: "delete", Only: []string{"apps"}}}},
+			{NonResourceURL: "*", Missing: []string{"get"}},
+		},
+		Unresolved: []string{"Role/dev/missing"},
+	}
+	var out bytes.Buffer
+	if err := diff.WriteTable(&out); err != nil {
+		t.Fatalf("WriteTable() error = %v", err)
+	}
+	for _, want := range []string{
+		"deployments.apps  namespaced      create   get,list in apps,dev; delete in apps",
+		"*                 nonResourceURL  get      -",
+		"on 1 of 5 resources",
+		"counted as giving nothing: Role/dev/missing",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("WriteTable() output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	clientset := kubefake.NewSimpleClientset(
+		&rbacv1.ClusterRole{ObjectMeta: v1api.ObjectMeta{Name: "view"}},
+		&rbacv1.Role{ObjectMeta: v1api.ObjectMeta{Name: "pod-deleter", Namespace: "apps"}},
+	)
+	snapshot, err := Fetch(context.Background(), clientset)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	// the fake discovery client does not serve preferred resources, only the roles are checked
+	if len(snapshot.ClusterRoles) != 1 || len(snapshot.Roles) != 1 {
+		t.Errorf("Fetch() = %+v, want one cluster role and role", snapshot)
+	}
+}
@@ -0,0 +1,100 @@
+// Package policy checks the permissions a role profile hands out for privilege escalation
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// forbiddenVerbs let the holder grant itself, or act as, anybody else
+var forbiddenVerbs = map[string]string{
+	"escalate":    "escalate allows granting permissions the holder does not have",
+	"bind":        "bind allows binding roles the holder does not have",
+	"impersonate": "impersonate allows acting as any user, group or service account",
+}
+
+// Violation is a rule of a role that amounts to cluster-admin or lets the holder escalate its privileges
+type Violation struct {
+	// Role is the kind and name of the role holding the rule, e.g. ClusterRole/route-editor
+	Role   string
+	Rule   rbacv1.PolicyRule
+	Reason string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Role, v.Reason)
+}
+
+// Check gets the name of a role, its rules and whether it is bound in a single namespace, and returns the violations found in them.
+// Impersonating service accounts is allowed within a namespace, like the built-in edit role does, not cluster wide
+func Check(role string, rules []rbacv1.PolicyRule, namespaced bool) []Violation {
+	var violations []Violation
+	for _, rule := range rules {
+		for _, reason := range checkRule(rule, namespaced) {
+			violations = append(violations, Violation{Role: role, Rule: rule, Reason: reason})
+		}
+	}
+	return violations
+}
+
+// checkRule returns why the rule is forbidden, nothing if it is allowed
+func checkRule(rule rbacv1.PolicyRule, namespaced bool) []string {
+	var reasons []string
+	for _, verb := range rule.Verbs {
+		if verb == rbacv1.VerbAll {
+			reasons = append(reasons, fmt.Sprintf("wildcard verb on %s", describeTargets(rule)))
+		} else if strings.EqualFold(verb, "impersonate") && namespaced && onlyServiceAccounts(rule) {
+			continue
+		} else if reason, ok := forbiddenVerbs[strings.ToLower(verb)]; ok {
+			reasons = append(reasons, fmt.Sprintf("%s on %s", reason, describeTargets(rule)))
+		}
+	}
+	for _, resource := range rule.Resources {
+		if resource == rbacv1.ResourceAll {
+			reasons = append(reasons, fmt.Sprintf("wildcard resource in API groups %s", strings.Join(rule.APIGroups, ",")))
+		}
+	}
+	for _, url := range rule.NonResourceURLs {
+		if url == rbacv1.NonResourceAll {
+			reasons = append(reasons, "wildcard non resource URL")
+		}
+	}
+	return reasons
+}
+
+// onlyServiceAccounts returns true if the rule targets nothing but service accounts
+func onlyServiceAccounts(rule rbacv1.PolicyRule) bool {
+	if len(rule.Resources) == 0 || len(rule.NonResourceURLs) > 0 {
+		return false
+	}
+	for _, resource := range rule.Resources {
+		if resource != "serviceaccounts" {
+			return false
+		}
+	}
+	for _, group := range rule.APIGroups {
+		if group != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// describeTargets returns the resources or non resource URLs of a rule
+func describeTargets(rule rbacv1.PolicyRule) string {
+	if len(rule.NonResourceURLs) > 0 {
+		return strings.Join(rule.NonResourceURLs, ",")
+	}
+	return strings.Join(rule.Resources, ",")
+}
+
+// Strings returns the violations as text, e.g. to report them in a status
+func Strings(violations []Violation) []string {
+	var text []string
+	for _, violation := range violations {
+		text = append(text, violation.String())
+	}
+	return text
+}
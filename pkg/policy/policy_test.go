@@ -0,0 +1,61 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		rules      []rbacv1.PolicyRule
+		namespaced bool
+		want       []string
+	}{
+		{
+			name:  "allowed",
+			rules: []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}}},
+		},
+		{
+			name:  "cluster-admin",
+			rules: []rbacv1.PolicyRule{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}}},
+			want:  []string{"ClusterRole/test: wildcard verb on *", "ClusterRole/test: wildcard resource in API groups *"},
+		},
+		{
+			name: "escalation verbs",
+			rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"clusterroles"}, Verbs: []string{"bind", "escalate"}},
+				{APIGroups: []string{""}, Resources: []string{"users", "groups"}, Verbs: []string{"impersonate"}},
+			},
+			want: []string{
+				"ClusterRole/test: bind allows binding roles the holder does not have on clusterroles",
+				"ClusterRole/test: escalate allows granting permissions the holder does not have on clusterroles",
+				"ClusterRole/test: impersonate allows acting as any user, group or service account on users,groups",
+			},
+		},
+		{
+			name:       "impersonating service accounts in a namespace",
+			rules:      []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"serviceaccounts"}, Verbs: []string{"impersonate"}}},
+			namespaced: true,
+		},
+		{
+			name:  "impersonating service accounts cluster wide",
+			rules: []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"serviceaccounts"}, Verbs: []string{"impersonate"}}},
+			want:  []string{"ClusterRole/test: impersonate allows acting as any user, group or service account on serviceaccounts"},
+		},
+		{
+			name:  "wildcard non resource URL",
+			rules: []rbacv1.PolicyRule{{NonResourceURLs: []string{"*"}, Verbs: []string{"get"}}},
+			want:  []string{"ClusterRole/test: wildcard non resource URL"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Strings(Check("ClusterRole/test", tt.rules, tt.namespaced)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() got %q want %q", got, tt.want)
+			}
+		})
+	}
+}
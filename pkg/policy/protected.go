@@ -0,0 +1,110 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// ErrProtectedNamespace is returned when a role profile grants or provisions something in a protected namespace
+var ErrProtectedNamespace = errors.New("protected namespace")
+
+// DefaultProtectedNamespaces are the namespaces of the hosted cluster platform, managed by OpenShift and HyperShift
+var DefaultProtectedNamespaces = ProtectedNamespaces{"default", "kube-*", "openshift", "openshift-*", "hypershift", "hypershift-*"}
+
+// writeVerbs modify objects, a rule with one of them bound cluster wide modifies protected namespaces
+var writeVerbs = map[string]bool{
+	"create": true, "update": true, "patch": true, "delete": true, "deletecollection": true, rbacv1.VerbAll: true,
+}
+
+// clusterScoped are the built-in resources of Kubernetes and OpenShift whose objects never live in a namespace, by API group and resource
+var clusterScoped = map[string]bool{
+	"/nodes": true, "/namespaces": true, "/persistentvolumes": true, "/componentstatuses": true,
+	"rbac.authorization.k8s.io/clusterroles": true, "rbac.authorization.k8s.io/clusterrolebindings": true,
+	"storage.k8s.io/storageclasses": true, "storage.k8s.io/csidrivers": true, "storage.k8s.io/csinodes": true,
+	"storage.k8s.io/volumeattachments": true, "apiextensions.k8s.io/customresourcedefinitions": true,
+	"apiregistration.k8s.io/apiservices": true, "scheduling.k8s.io/priorityclasses": true,
+	"admissionregistration.k8s.io/mutatingwebhookconfigurations": true, "admissionregistration.k8s.io/validatingwebhookconfigurations": true,
+	"certificates.k8s.io/certificatesigningrequests": true, "node.k8s.io/runtimeclasses": true,
+	"user.openshift.io/users": true, "user.openshift.io/groups": true, "user.openshift.io/identities": true,
+	"console.openshift.io/consolenotifications": true, "rbacmanager.reactiveops.io/rbacdefinitions": true,
+}
+
+// Namespaced returns true unless the resource of the API group is a built-in resource whose objects never live in a
+// namespace, resources it does not know are assumed to be namespaced
+func Namespaced(group string, resource string) bool {
+	return !clusterScoped[group+"/"+resource]
+}
+
+// ProtectedNamespaces are shell patterns of namespaces custom cluster admins must not be given access to
+type ProtectedNamespaces []string
+
+// Validate returns an error if a pattern is malformed
+func (p ProtectedNamespaces) Validate() error {
+	for _, pattern := range p {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid protected namespace pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Protects returns true if the namespace matches one of the patterns
+func (p ProtectedNamespaces) Protects(namespace string) bool {
+	for _, pattern := range p {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckNamespace returns an error wrapping ErrProtectedNamespace if the namespace is protected, what describes
+// what the profile would do in it
+func (p ProtectedNamespaces) CheckNamespace(namespace string, what string) error {
+	if p.Protects(namespace) {
+		return fmt.Errorf("%w %s: %s", ErrProtectedNamespace, namespace, what)
+	}
+	return nil
+}
+
+// CheckClusterWide gets the name of a role bound cluster wide, its rules and whether objects of a resource live in a namespace
+// The function returns a violation for every rule modifying objects that may live in a namespace: namespaced resources,
+// every resource of an API group and resources of every API group, since bound cluster wide they reach the protected
+// namespaces. Rules modifying only cluster scoped resources do not reach them and are left to the escalation checks
+func (p ProtectedNamespaces) CheckClusterWide(role string, rules []rbacv1.PolicyRule, namespaced func(group string, resource string) bool) []Violation {
+	if len(p) == 0 {
+		return nil
+	}
+	var violations []Violation
+	for _, rule := range rules {
+		if len(rule.Resources) == 0 || !reachesNamespaces(rule, namespaced) {
+			continue
+		}
+		for _, verb := range rule.Verbs {
+			if writeVerbs[strings.ToLower(verb)] {
+				violations = append(violations, Violation{Role: role, Rule: rule,
+					Reason: fmt.Sprintf("%s on %s bound cluster wide reaches protected namespaces", verb, describeTargets(rule))})
+				break
+			}
+		}
+	}
+	return violations
+}
+
+// reachesNamespaces returns true if the rule covers a resource whose objects may live in a namespace
+func reachesNamespaces(rule rbacv1.PolicyRule, namespaced func(group string, resource string) bool) bool {
+	for _, group := range rule.APIGroups {
+		for _, resource := range rule.Resources {
+			// a subresource lives where its resource does
+			resource = strings.SplitN(resource, "/", 2)[0]
+			if group == rbacv1.APIGroupAll || resource == rbacv1.ResourceAll || namespaced(group, resource) {
+				return true
+			}
+		}
+	}
+	return false
+}
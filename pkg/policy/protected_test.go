@@ -0,0 +1,63 @@
+package policy
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestProtectedNamespaces(t *testing.T) {
+	tests := []struct {
+		namespace string
+		want      bool
+	}{
+		{namespace: "kube-system", want: true},
+		{namespace: "openshift-monitoring", want: true},
+		{namespace: "openshift", want: true},
+		{namespace: "hypershift", want: true},
+		{namespace: "team-a"},
+		{namespace: "openshifty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			if got := DefaultProtectedNamespaces.Protects(tt.namespace); got != tt.want {
+				t.Errorf("Protects() got %v want %v", got, tt.want)
+			}
+			err := DefaultProtectedNamespaces.CheckNamespace(tt.namespace, "role binding")
+			if (err != nil) != tt.want || (err != nil && !errors.Is(err, ErrProtectedNamespace)) {
+				t.Errorf("CheckNamespace() error = %v", err)
+			}
+		})
+	}
+	if err := (ProtectedNamespaces{"team-["}).Validate(); err == nil {
+		t.Errorf("Validate() expected an error for a malformed pattern")
+	}
+}
+
+func TestProtectedNamespaces_CheckClusterWide(t *testing.T) {
+	rules := []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}},
+		{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "update"}},
+		{NonResourceURLs: []string{"/healthz"}, Verbs: []string{"get"}},
+		{APIGroups: []string{""}, Resources: []string{"nodes", "persistentvolumes"}, Verbs: []string{"patch", "delete"}},
+		{APIGroups: []string{"storage.k8s.io"}, Resources: []string{"*"}, Verbs: []string{"create"}},
+		{APIGroups: []string{"*"}, Resources: []string{"nodes"}, Verbs: []string{"delete"}},
+		{APIGroups: []string{""}, Resources: []string{"pods/eviction"}, Verbs: []string{"create"}},
+		{APIGroups: []string{"example.com"}, Resources: []string{"widgets"}, Verbs: []string{"delete"}},
+	}
+	want := []string{
+		"ClusterRole/test: update on configmaps bound cluster wide reaches protected namespaces",
+		"ClusterRole/test: create on * bound cluster wide reaches protected namespaces",
+		"ClusterRole/test: delete on nodes bound cluster wide reaches protected namespaces",
+		"ClusterRole/test: create on pods/eviction bound cluster wide reaches protected namespaces",
+		"ClusterRole/test: delete on widgets bound cluster wide reaches protected namespaces",
+	}
+	if got := Strings(DefaultProtectedNamespaces.CheckClusterWide("ClusterRole/test", rules, Namespaced)); !reflect.DeepEqual(got, want) {
+		t.Errorf("CheckClusterWide() got %q want %q", got, want)
+	}
+	if got := (ProtectedNamespaces{}).CheckClusterWide("ClusterRole/test", rules, Namespaced); len(got) != 0 {
+		t.Errorf("CheckClusterWide() without protected namespaces got %v", got)
+	}
+}
@@ -0,0 +1,331 @@
+package profiles
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	rbacmanagerv1beta1 "github.com/fairwindsops/rbac-manager/pkg/apis/rbacmanager/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// RoleProfile describes the permissions given to the custom cluster admin group at a hosted cluster
+type RoleProfile struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Privileged profiles may hand out permissions amounting to cluster-admin, the controller rejects them otherwise
+	Privileged          bool                                    `json:"privileged,omitempty"`
+	RoleBindings        []rbacmanagerv1beta1.RoleBinding        `json:"roleBindings,omitempty"`
+	ClusterRoleBindings []rbacmanagerv1beta1.ClusterRoleBinding `json:"clusterRoleBindings,omitempty"`
+	// NamespaceRoleBindings bind a role in every namespace of the hosted cluster they select, including namespaces created later
+	NamespaceRoleBindings []NamespaceRoleBinding `json:"namespaceRoleBindings,omitempty"`
+	// Namespaces are created at the hosted cluster before the bindings are applied
+	Namespaces []Namespace `json:"namespaces,omitempty"`
+	// ClusterRoles are created at the hosted cluster before the bindings are applied, bindings can reference them by name
+	ClusterRoles []ClusterRole `json:"clusterRoles,omitempty"`
+	// Checks are verified for every user of the group once the profile is applied
+	Checks []AccessCheck `json:"checks,omitempty"`
+
+	// document is the decoded profile document when string values of it are templates, see Render
+	document interface{}
+}
+
+const (
+	// ExpectAllow and ExpectDeny are the results an access check expects
+	ExpectAllow = "allow"
+	ExpectDeny  = "deny"
+)
+
+// AccessCheck is an action users given the profile are expected to be allowed, or denied, at the hosted cluster
+type AccessCheck struct {
+	Verb        string `json:"verb"`
+	Group       string `json:"group,omitempty"`
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource,omitempty"`
+	// Namespace is empty for cluster scoped resources and checks across all namespaces
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	// Expect is allow or deny
+	Expect string `json:"expect"`
+}
+
+// String describes the check, e.g. "create deployments.apps in apps"
+func (c AccessCheck) String() string {
+	resource := c.Resource
+	if c.Subresource != "" {
+		resource += "/" + c.Subresource
+	}
+	if c.Group != "" {
+		resource += "." + c.Group
+	}
+	if c.Name != "" {
+		resource += " " + c.Name
+	}
+	if c.Namespace != "" {
+		return fmt.Sprintf("%s %s in %s", c.Verb, resource, c.Namespace)
+	}
+	return fmt.Sprintf("%s %s", c.Verb, resource)
+}
+
+// ClusterRole describes a ClusterRole the controller manages at the hosted cluster
+type ClusterRole struct {
+	Name string `json:"name"`
+	// Labels are set on the ClusterRole, e.g. rbac.authorization.k8s.io/aggregate-to-edit to aggregate it into edit
+	Labels          map[string]string       `json:"labels,omitempty"`
+	Rules           []rbacv1.PolicyRule     `json:"rules,omitempty"`
+	AggregationRule *rbacv1.AggregationRule `json:"aggregationRule,omitempty"`
+}
+
+// NamespaceRoleBinding binds a role in the namespaces of the hosted cluster matching a label selector and a name pattern.
+// When both are set a namespace has to match both
+type NamespaceRoleBinding struct {
+	ClusterRole       string               `json:"clusterRole,omitempty"`
+	Role              string               `json:"role,omitempty"`
+	NamespaceSelector *v1api.LabelSelector `json:"namespaceSelector,omitempty"`
+	// NamespacePattern is a shell pattern matched against the namespace name, e.g. team-*
+	NamespacePattern string `json:"namespacePattern,omitempty"`
+}
+
+// Matches returns true if the namespace with the given name and labels is selected by the binding
+func (b NamespaceRoleBinding) Matches(name string, namespaceLabels map[string]string) (bool, error) {
+	if b.NamespacePattern != "" {
+		matched, err := path.Match(b.NamespacePattern, name)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	if b.NamespaceSelector != nil {
+		selector, err := v1api.LabelSelectorAsSelector(b.NamespaceSelector)
+		if err != nil {
+			return false, err
+		}
+		return selector.Matches(labels.Set(namespaceLabels)), nil
+	}
+	return true, nil
+}
+
+// Namespace describes a namespace the controller provisions at the hosted cluster
+type Namespace struct {
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ResourceQuota and LimitRange are applied in the namespace when set
+	ResourceQuota *corev1.ResourceQuotaSpec `json:"resourceQuota,omitempty"`
+	LimitRange    *corev1.LimitRangeSpec    `json:"limitRange,omitempty"`
+	// DeleteOnRevoke deletes the namespace, and everything in it, once nobody has access to the hosted cluster anymore
+	DeleteOnRevoke bool `json:"deleteOnRevoke,omitempty"`
+}
+
+// DefaultRoleProfile is used when no profile is configured
+// we are waiting for OCP and to give us required permissions list, meanwhile this is just an example
+var DefaultRoleProfile = RoleProfile{
+	Name: "default",
+	RoleBindings: []rbacmanagerv1beta1.RoleBinding{
+		{
+			Namespace:   "customAdminNamespace",
+			ClusterRole: "edit",
+		},
+	},
+}
+
+// HasNamespaceSelector returns whether rbac-manager binds the RoleBinding in the namespaces its selector matches instead
+// of its namespace
+func HasNamespaceSelector(roleBinding rbacmanagerv1beta1.RoleBinding) bool {
+	return len(roleBinding.NamespaceSelector.MatchLabels) > 0 || len(roleBinding.NamespaceSelector.MatchExpressions) > 0
+}
+
+// Validate returns an error describing the first problem found in the profile
+func (p *RoleProfile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("profile name must be set")
+	}
+	for i, roleBinding := range p.RoleBindings {
+		if (roleBinding.ClusterRole == "") == (roleBinding.Role == "") {
+			return fmt.Errorf("profile %s: roleBindings[%d] must set exactly one of clusterRole and role", p.Name, i)
+		}
+		if roleBinding.Namespace == "" {
+			return fmt.Errorf("profile %s: roleBindings[%d] must set namespace", p.Name, i)
+		}
+		if HasNamespaceSelector(roleBinding) {
+			return fmt.Errorf("profile %s: roleBindings[%d] must not set namespaceSelector, use namespaceRoleBindings to bind by labels", p.Name, i)
+		}
+	}
+	for i, clusterRoleBinding := range p.ClusterRoleBindings {
+		if clusterRoleBinding.ClusterRole == "" {
+			return fmt.Errorf("profile %s: clusterRoleBindings[%d] must set clusterRole", p.Name, i)
+		}
+	}
+	for i, roleBinding := range p.NamespaceRoleBindings {
+		if (roleBinding.ClusterRole == "") == (roleBinding.Role == "") {
+			return fmt.Errorf("profile %s: namespaceRoleBindings[%d] must set exactly one of clusterRole and role", p.Name, i)
+		}
+		if roleBinding.NamespaceSelector == nil && roleBinding.NamespacePattern == "" {
+			return fmt.Errorf("profile %s: namespaceRoleBindings[%d] must set namespaceSelector or namespacePattern", p.Name, i)
+		}
+		if _, err := roleBinding.Matches("", nil); err != nil {
+			return fmt.Errorf("profile %s: namespaceRoleBindings[%d]: %w", p.Name, i, err)
+		}
+	}
+	roleNames := make(map[string]bool)
+	for i, clusterRole := range p.ClusterRoles {
+		if errs := validation.IsDNS1123Subdomain(clusterRole.Name); len(errs) > 0 {
+			return fmt.Errorf("profile %s: clusterRoles[%d] has invalid name %q: %s", p.Name, i, clusterRole.Name, strings.Join(errs, ", "))
+		}
+		if roleNames[clusterRole.Name] {
+			return fmt.Errorf("profile %s: cluster role %s is declared more than once", p.Name, clusterRole.Name)
+		}
+		roleNames[clusterRole.Name] = true
+		if len(clusterRole.Rules) == 0 && clusterRole.AggregationRule == nil {
+			return fmt.Errorf("profile %s: cluster role %s must set rules or aggregationRule", p.Name, clusterRole.Name)
+		}
+		for j, rule := range clusterRole.Rules {
+			if len(rule.Verbs) == 0 {
+				return fmt.Errorf("profile %s: cluster role %s rules[%d] must set verbs", p.Name, clusterRole.Name, j)
+			}
+			if (len(rule.Resources) == 0) == (len(rule.NonResourceURLs) == 0) {
+				return fmt.Errorf("profile %s: cluster role %s rules[%d] must set exactly one of resources and nonResourceURLs", p.Name, clusterRole.Name, j)
+			}
+		}
+		for key, value := range clusterRole.Labels {
+			if errs := append(validation.IsQualifiedName(key), validation.IsValidLabelValue(value)...); len(errs) > 0 {
+				return fmt.Errorf("profile %s: cluster role %s has invalid label %s: %s", p.Name, clusterRole.Name, key, strings.Join(errs, ", "))
+			}
+		}
+	}
+	for i, check := range p.Checks {
+		if check.Verb == "" || check.Resource == "" {
+			return fmt.Errorf("profile %s: checks[%d] must set verb and resource", p.Name, i)
+		}
+		if check.Expect != ExpectAllow && check.Expect != ExpectDeny {
+			return fmt.Errorf("profile %s: checks[%d] must expect %s or %s", p.Name, i, ExpectAllow, ExpectDeny)
+		}
+	}
+	names := make(map[string]bool)
+	for i, namespace := range p.Namespaces {
+		if errs := validation.IsDNS1123Label(namespace.Name); len(errs) > 0 {
+			return fmt.Errorf("profile %s: namespaces[%d] has invalid name %q: %s", p.Name, i, namespace.Name, strings.Join(errs, ", "))
+		}
+		if names[namespace.Name] {
+			return fmt.Errorf("profile %s: namespace %s is declared more than once", p.Name, namespace.Name)
+		}
+		names[namespace.Name] = true
+		for key, value := range namespace.Labels {
+			if errs := append(validation.IsQualifiedName(key), validation.IsValidLabelValue(value)...); len(errs) > 0 {
+				return fmt.Errorf("profile %s: namespace %s has invalid label %s: %s", p.Name, namespace.Name, key, strings.Join(errs, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// Parse decodes a YAML or JSON role profile document and validates it.
+// The templates of a templated profile are checked and the rest of it is validated with placeholders in place of the
+// templates, the profile is validated again once it is rendered
+func Parse(data []byte) (*RoleProfile, error) {
+	return parseProfile(data, true)
+}
+
+// parseProfile decodes a role profile document and validates it, templates are looked for only when templates is true
+// so the values a rendered profile was rendered with are never taken for templates
+func parseProfile(data []byte, templates bool) (*RoleProfile, error) {
+	profile := &RoleProfile{}
+	if err := yaml.UnmarshalStrict(data, profile); err != nil {
+		return nil, err
+	}
+	if templates {
+		if err := profile.parseTemplates(data); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", profile.Name, err)
+		}
+	}
+	if profile.Templated() {
+		if profile.Name == "" {
+			return nil, fmt.Errorf("profile name must be set")
+		}
+		if err := profile.validateTemplated(); err != nil {
+			return nil, err
+		}
+		return profile, nil
+	}
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// LoadFile reads and parses the role profile at path
+func LoadFile(path string) (*RoleProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// LoadDir reads and parses every YAML and JSON file in dir and returns the role profiles by name
+func LoadDir(dir string) (map[string]*RoleProfile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	loaded := make(map[string]*RoleProfile)
+	for _, entry := range entries {
+		if entry.IsDir() || !isProfileFile(entry.Name()) {
+			continue
+		}
+		profile, err := LoadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		if err := addProfile(loaded, entry.Name(), profile); err != nil {
+			return nil, err
+		}
+	}
+	return loaded, nil
+}
+
+// LoadData parses every YAML and JSON key of the data of a ConfigMap and returns the role profiles by name
+func LoadData(data map[string]string) (map[string]*RoleProfile, error) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		if isProfileFile(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	loaded := make(map[string]*RoleProfile)
+	for _, key := range keys {
+		profile, err := Parse([]byte(data[key]))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		if err := addProfile(loaded, key, profile); err != nil {
+			return nil, err
+		}
+	}
+	return loaded, nil
+}
+
+// isProfileFile returns true for the file names role profiles are loaded from
+func isProfileFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+func addProfile(loaded map[string]*RoleProfile, source string, profile *RoleProfile) error {
+	if _, ok := loaded[profile.Name]; ok {
+		return fmt.Errorf("%s: profile %s is defined more than once", source, profile.Name)
+	}
+	loaded[profile.Name] = profile
+	return nil
+}
@@ -0,0 +1,279 @@
+package profiles
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			data: `
+name: developers
+roleBindings:
+- namespace: apps
+  clusterRole: edit
+clusterRoleBindings:
+- clusterRole: view
+`,
+		},
+		{
+			name:    "missing name",
+			data:    "roleBindings: []",
+			wantErr: true,
+		},
+		{
+			name: "role and cluster role",
+			data: `
+name: developers
+roleBindings:
+- namespace: apps
+  clusterRole: edit
+  role: edit
+`,
+			wantErr: true,
+		},
+		{
+			name: "namespaces",
+			data: `
+name: developers
+namespaces:
+- name: apps
+  labels:
+    team: developers
+  resourceQuota:
+    hard:
+      requests.cpu: "4"
+      pods: "20"
+  limitRange:
+    limits:
+    - type: Container
+      default:
+        memory: 512Mi
+  deleteOnRevoke: true
+roleBindings:
+- namespace: apps
+  clusterRole: edit
+`,
+		},
+		{
+			name: "namespace role bindings",
+			data: `
+name: developers
+namespaceRoleBindings:
+- clusterRole: edit
+  namespacePattern: team-*
+- role: deployer
+  namespaceSelector:
+    matchLabels:
+      team: developers
+`,
+		},
+		{
+			name:    "role binding with namespace selector",
+			data:    "name: developers\nroleBindings:\n- clusterRole: edit\n  namespace: apps\n  namespaceSelector:\n    matchLabels:\n      kubernetes.io/metadata.name: kube-system",
+			wantErr: true,
+		},
+		{
+			name:    "namespace role binding without selector",
+			data:    "name: developers\nnamespaceRoleBindings:\n- clusterRole: edit",
+			wantErr: true,
+		},
+		{
+			name:    "invalid namespace pattern",
+			data:    "name: developers\nnamespaceRoleBindings:\n- clusterRole: edit\n  namespacePattern: \"team-[\"",
+			wantErr: true,
+		},
+		{
+			name:    "invalid namespace selector",
+			data:    "name: developers\nnamespaceRoleBindings:\n- clusterRole: edit\n  namespaceSelector:\n    matchExpressions:\n    - key: team\n      operator: Unknown",
+			wantErr: true,
+		},
+		{
+			name: "cluster roles",
+			data: `
+name: developers
+clusterRoles:
+- name: route-editor
+  labels:
+    rbac.authorization.k8s.io/aggregate-to-edit: "true"
+  rules:
+  - apiGroups: [route.openshift.io]
+    resources: [routes]
+    verbs: [get, list, create, update, delete]
+clusterRoleBindings:
+- clusterRole: route-editor
+`,
+		},
+		{
+			name:    "cluster role without verbs",
+			data:    "name: developers\nclusterRoles:\n- name: routes\n  rules:\n  - apiGroups: ['']\n    resources: [pods]",
+			wantErr: true,
+		},
+		{
+			name:    "empty cluster role",
+			data:    "name: developers\nclusterRoles:\n- name: routes",
+			wantErr: true,
+		},
+		{
+			name: "checks",
+			data: `
+name: developers
+roleBindings:
+- namespace: apps
+  clusterRole: edit
+checks:
+- verb: create
+  group: apps
+  resource: deployments
+  namespace: apps
+  expect: allow
+- verb: delete
+  resource: nodes
+  expect: deny
+`,
+		},
+		{
+			name:    "check without expectation",
+			data:    "name: developers\nchecks:\n- verb: get\n  resource: pods",
+			wantErr: true,
+		},
+		{
+			name:    "invalid namespace name",
+			data:    "name: developers\nnamespaces:\n- name: customAdminNamespace",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate namespace",
+			data:    "name: developers\nnamespaces:\n- name: apps\n- name: apps",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			data:    "name: developers\nbindings: []",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.data)); (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNamespaceRoleBinding_Matches(t *testing.T) {
+	tests := []struct {
+		name      string
+		binding   NamespaceRoleBinding
+		namespace string
+		labels    map[string]string
+		want      bool
+	}{
+		{name: "pattern", binding: NamespaceRoleBinding{NamespacePattern: "team-*"}, namespace: "team-a", want: true},
+		{name: "pattern mismatch", binding: NamespaceRoleBinding{NamespacePattern: "team-*"}, namespace: "kube-system"},
+		{
+			name:      "selector",
+			binding:   NamespaceRoleBinding{NamespaceSelector: &v1api.LabelSelector{MatchLabels: map[string]string{"team": "a"}}},
+			namespace: "apps",
+			labels:    map[string]string{"team": "a"},
+			want:      true,
+		},
+		{
+			name: "pattern and selector",
+			binding: NamespaceRoleBinding{NamespacePattern: "team-*",
+				NamespaceSelector: &v1api.LabelSelector{MatchLabels: map[string]string{"team": "a"}}},
+			namespace: "team-b",
+			labels:    map[string]string{"team": "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.binding.Matches(tt.namespace, tt.labels)
+			if err != nil {
+				t.Fatalf("Matches() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Matches() got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func profileNames(loaded map[string]*RoleProfile) []string {
+	var names []string
+	for name := range loaded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestLoadDir(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     map[string]string
+		wantNames []string
+		wantErr   bool
+	}{
+		{
+			name: "loads profiles by name",
+			files: map[string]string{
+				"dev.yaml":   "name: dev\nroleBindings:\n- namespace: apps\n  clusterRole: edit\n",
+				"prod.json":  `{"name": "prod", "roleBindings": [{"namespace": "apps", "clusterRole": "view"}]}`,
+				"README.md":  "not a profile",
+				"notes.yml~": "not a profile either",
+			},
+			wantNames: []string{"dev", "prod"},
+		},
+		{
+			name: "duplicate name",
+			files: map[string]string{
+				"a.yaml": "name: dev\n",
+				"b.yaml": "name: dev\n",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "invalid profile",
+			files:   map[string]string{"a.yaml": "roleBindings: []\n"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := LoadDir(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadDir() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if names := profileNames(got); !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("LoadDir() names = %v, want %v", names, tt.wantNames)
+			}
+			// the keys of a ConfigMap are loaded like the files of a directory
+			got, err = LoadData(tt.files)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if names := profileNames(got); !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("LoadData() names = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
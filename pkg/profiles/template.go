@@ -0,0 +1,265 @@
+package profiles
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"sigs.k8s.io/yaml"
+)
+
+// maxRenderedSize bounds the output of a single template of a profile
+const maxRenderedSize = 64 * 1024
+
+// templateFuncs are the only functions profile templates may call besides the text/template builtins, call excepted
+var templateFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"default": func(value, s string) string {
+		if s == "" {
+			return value
+		}
+		return s
+	},
+}
+
+// TemplateData is what the templates of a profile are rendered with, e.g. {{ .Cluster.Labels.team }}-apps
+type TemplateData struct {
+	Cluster   TemplateCluster
+	Requester string
+}
+
+// TemplateCluster describes the HostedCluster a profile is rendered for
+type TemplateCluster struct {
+	Name        string
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// Templated returns true when string values of the profile are Go templates rendered for every HostedCluster
+func (p *RoleProfile) Templated() bool {
+	return p.document != nil
+}
+
+// parseTemplates keeps the decoded document of the profile when one of its string values is a template,
+// after checking every template is sandboxed. The name of the profile must not be a template
+func (p *RoleProfile) parseTemplates(data []byte) error {
+	if !bytes.Contains(data, []byte("{{")) {
+		return nil
+	}
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return err
+	}
+	var document interface{}
+	if err := json.Unmarshal(jsonData, &document); err != nil {
+		return err
+	}
+	templated := false
+	err = walkStrings(document, "", func(path, value string) (string, error) {
+		if !strings.Contains(value, "{{") {
+			return value, nil
+		}
+		if path == ".name" {
+			return "", fmt.Errorf("profile name must not be a template")
+		}
+		templated = true
+		_, err := parseTemplate(path, value)
+		return value, err
+	})
+	if err != nil {
+		return err
+	}
+	if templated {
+		p.document = document
+	}
+	return nil
+}
+
+// validateTemplated validates a templated profile with every template replaced by a distinct placeholder, so the values
+// that are not templates are checked when the profile is loaded and not only once it is rendered for a HostedCluster
+func (p *RoleProfile) validateTemplated() error {
+	placeholders := 0
+	document, err := copyStrings(p.document, "", func(path, value string) (string, error) {
+		if !strings.Contains(value, "{{") {
+			return value, nil
+		}
+		if strings.HasSuffix(path, ".expect") {
+			return ExpectAllow, nil
+		}
+		placeholders++
+		return fmt.Sprintf("templated-%d", placeholders), nil
+	})
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	_, err = parseProfile(data, false)
+	return err
+}
+
+// Render returns the profile with its templates rendered with data and validated, profiles without templates are
+// returned as they are. Templates fail on labels and annotations the HostedCluster does not have, use index to allow them
+func (p *RoleProfile) Render(data TemplateData) (*RoleProfile, error) {
+	if !p.Templated() {
+		return p, nil
+	}
+	document, err := copyStrings(p.document, "", func(path, value string) (string, error) {
+		if !strings.Contains(value, "{{") {
+			return value, nil
+		}
+		tmpl, err := parseTemplate(path, value)
+		if err != nil {
+			return "", err
+		}
+		out := &limitedBuffer{limit: maxRenderedSize}
+		if err := tmpl.Execute(out, data); err != nil {
+			return "", fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+		return out.String(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := parseProfile(rendered, false)
+	if err != nil {
+		return nil, fmt.Errorf("rendered profile %s: %w", p.Name, err)
+	}
+	return profile, nil
+}
+
+// parseTemplate parses the template at path of a profile and checks it is sandboxed: it calls only the builtins and
+// templateFuncs, and neither defines nor includes other templates
+func parseTemplate(path, text string) (*template.Template, error) {
+	tmpl, err := template.New(path).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(tmpl.Templates()) > 1 {
+		return nil, fmt.Errorf("template %s must not define templates", path)
+	}
+	if err := checkSandbox(tmpl.Tree.Root); err != nil {
+		return nil, fmt.Errorf("template %s: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+// checkSandbox rejects the nodes of a template that reach outside of the data it is rendered with
+func checkSandbox(node parse.Node) error {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return nil
+		}
+		for _, child := range node.Nodes {
+			if err := checkSandbox(child); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkSandbox(node.Pipe)
+	case *parse.IfNode:
+		return checkBranch(&node.BranchNode)
+	case *parse.RangeNode:
+		return checkBranch(&node.BranchNode)
+	case *parse.WithNode:
+		return checkBranch(&node.BranchNode)
+	case *parse.TemplateNode:
+		return fmt.Errorf("including template %s is not allowed", node.Name)
+	case *parse.PipeNode:
+		if node == nil {
+			return nil
+		}
+		for _, command := range node.Cmds {
+			if err := checkSandbox(command); err != nil {
+				return err
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			if err := checkSandbox(arg); err != nil {
+				return err
+			}
+		}
+	case *parse.ChainNode:
+		return checkSandbox(node.Node)
+	case *parse.IdentifierNode:
+		if node.Ident == "call" {
+			return errors.New("function call is not allowed")
+		}
+	}
+	return nil
+}
+
+func checkBranch(node *parse.BranchNode) error {
+	if err := checkSandbox(node.Pipe); err != nil {
+		return err
+	}
+	if err := checkSandbox(node.List); err != nil {
+		return err
+	}
+	return checkSandbox(node.ElseList)
+}
+
+// walkStrings calls visit with the path and value of every string in a decoded JSON document
+func walkStrings(document interface{}, path string, visit func(path, value string) (string, error)) error {
+	_, err := copyStrings(document, path, visit)
+	return err
+}
+
+// copyStrings returns a copy of a decoded JSON document with every string replaced by the result of visit
+func copyStrings(document interface{}, path string, visit func(path, value string) (string, error)) (interface{}, error) {
+	switch value := document.(type) {
+	case string:
+		return visit(path, value)
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			itemCopy, err := copyStrings(item, path+"."+key, visit)
+			if err != nil {
+				return nil, err
+			}
+			copied[key] = itemCopy
+		}
+		return copied, nil
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, item := range value {
+			itemCopy, err := copyStrings(item, fmt.Sprintf("%s[%d]", path, i), visit)
+			if err != nil {
+				return nil, err
+			}
+			copied[i] = itemCopy
+		}
+		return copied, nil
+	}
+	return document, nil
+}
+
+// limitedBuffer is a buffer failing writes beyond its limit
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, fmt.Errorf("rendered template is larger than %d bytes", b.limit)
+	}
+	return b.Buffer.Write(p)
+}
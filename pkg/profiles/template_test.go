@@ -0,0 +1,194 @@
+package profiles
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	rbacmanagerv1beta1 "github.com/fairwindsops/rbac-manager/pkg/apis/rbacmanager/v1beta1"
+)
+
+func TestParse_templates(t *testing.T) {
+	tests := []struct {
+		name          string
+		document      string
+		wantTemplated bool
+		wantErr       string
+	}{
+		{name: "plain profile", document: "name: dev\nroleBindings:\n- namespace: apps\n  clusterRole: edit\n"},
+		{
+			name:          "templated namespace",
+			document:      "name: team\nroleBindings:\n- namespace: '{{ .Cluster.Labels.team }}-apps'\n  clusterRole: edit\n",
+			wantTemplated: true,
+		},
+		{
+			name:          "allowed functions",
+			document:      "name: team\nroleBindings:\n- namespace: '{{ index .Cluster.Labels \"team\" | default \"shared\" | lower }}'\n  clusterRole: edit\n",
+			wantTemplated: true,
+		},
+		{
+			name: "templated namespaces and expectation",
+			document: "name: team\nnamespaces:\n- name: '{{ .Cluster.Name }}-apps'\n- name: '{{ .Cluster.Name }}-data'\n" +
+				"checks:\n- verb: get\n  resource: pods\n  expect: '{{ index .Cluster.Labels \"expect\" }}'\n",
+			wantTemplated: true,
+		},
+		{
+			name:     "invalid value beside templates",
+			document: "name: team\nroleBindings:\n- namespace: '{{ .Cluster.Labels.team }}-apps'\n",
+			wantErr:  "roleBindings[0] must set exactly one of clusterRole and role",
+		},
+		{
+			name:     "invalid cluster role beside templates",
+			document: "name: team\nclusterRoles:\n- name: '{{ .Cluster.Name }}-reader'\n  rules:\n  - resources: [pods]\n",
+			wantErr:  "rules[0] must set verbs",
+		},
+		{
+			name:     "templated name",
+			document: "name: '{{ .Cluster.Name }}'\n",
+			wantErr:  "profile name must not be a template",
+		},
+		{
+			name:     "syntax error",
+			document: "name: team\nroleBindings:\n- namespace: '{{ .Cluster.Labels.team '\n  clusterRole: edit\n",
+			wantErr:  "unclosed action",
+		},
+		{
+			name:     "unknown function",
+			document: "name: team\nroleBindings:\n- namespace: '{{ env \"HOME\" }}'\n  clusterRole: edit\n",
+			wantErr:  `function "env" not defined`,
+		},
+		{
+			name:     "call is not allowed",
+			document: "name: team\nroleBindings:\n- namespace: '{{ call .Cluster.Name }}'\n  clusterRole: edit\n",
+			wantErr:  "function call is not allowed",
+		},
+		{
+			name:     "defining templates is not allowed",
+			document: "name: team\nroleBindings:\n- namespace: '{{ define \"x\" }}apps{{ end }}{{ template \"x\" }}'\n  clusterRole: edit\n",
+			wantErr:  "must not define templates",
+		},
+		{
+			name:     "unknown field",
+			document: "name: team\nroleBinding:\n- namespace: '{{ .Cluster.Name }}'\n",
+			wantErr:  "unknown field",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := Parse([]byte(tt.document))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if profile.Templated() != tt.wantTemplated {
+				t.Errorf("Templated() = %v, want %v", profile.Templated(), tt.wantTemplated)
+			}
+		})
+	}
+}
+
+func TestRoleProfile_Render(t *testing.T) {
+	document := `
+name: team
+roleBindings:
+- namespace: '{{ .Cluster.Labels.team }}-apps'
+  clusterRole: edit
+- namespace: '{{ index .Cluster.Labels "env" | default "dev" }}-{{ .Cluster.Name }}'
+  clusterRole: '{{ index .Cluster.Annotations "example.com/role" | default "view" }}'
+namespaces:
+- name: '{{ .Cluster.Labels.team }}-apps'
+  annotations:
+    owner: '{{ .Requester }}'
+`
+	profile, err := Parse([]byte(document))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	data := func(labels, annotations map[string]string) TemplateData {
+		return TemplateData{
+			Cluster:   TemplateCluster{Name: "test", Namespace: "clusters", Labels: labels, Annotations: annotations},
+			Requester: "alice",
+		}
+	}
+	tests := []struct {
+		name             string
+		data             TemplateData
+		wantRoleBindings []rbacmanagerv1beta1.RoleBinding
+		wantErr          string
+	}{
+		{
+			name: "renders labels, annotations and requester",
+			data: data(map[string]string{"team": "payments", "env": "prod"}, map[string]string{"example.com/role": "admin"}),
+			wantRoleBindings: []rbacmanagerv1beta1.RoleBinding{
+				{Namespace: "payments-apps", ClusterRole: "edit"},
+				{Namespace: "prod-test", ClusterRole: "admin"},
+			},
+		},
+		{
+			name: "index falls back to defaults",
+			data: data(map[string]string{"team": "payments"}, nil),
+			wantRoleBindings: []rbacmanagerv1beta1.RoleBinding{
+				{Namespace: "payments-apps", ClusterRole: "edit"},
+				{Namespace: "dev-test", ClusterRole: "view"},
+			},
+		},
+		{
+			name:    "missing label",
+			data:    data(nil, nil),
+			wantErr: `map has no entry for key "team"`,
+		},
+		{
+			name:    "rendered profile is validated",
+			data:    data(map[string]string{"team": "Payments"}, nil),
+			wantErr: "invalid name",
+		},
+		{
+			name: "values cannot inject fields",
+			data: data(map[string]string{"team": "payments"},
+				map[string]string{"example.com/role": "view\nclusterRoleBindings:\n- clusterRole: cluster-admin"}),
+			wantRoleBindings: []rbacmanagerv1beta1.RoleBinding{
+				{Namespace: "payments-apps", ClusterRole: "edit"},
+				{Namespace: "dev-test", ClusterRole: "view\nclusterRoleBindings:\n- clusterRole: cluster-admin"},
+			},
+		},
+		{
+			name: "rendered values are not templates",
+			data: data(map[string]string{"team": "payments"}, map[string]string{"example.com/role": "{{ .Requester }}"}),
+			wantRoleBindings: []rbacmanagerv1beta1.RoleBinding{
+				{Namespace: "payments-apps", ClusterRole: "edit"},
+				{Namespace: "dev-test", ClusterRole: "{{ .Requester }}"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := profile.Render(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Render() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if rendered.Templated() {
+				t.Errorf("Render() returned a templated profile")
+			}
+			if !reflect.DeepEqual(rendered.RoleBindings, tt.wantRoleBindings) {
+				t.Errorf("Render() roleBindings = %+v, want %+v", rendered.RoleBindings, tt.wantRoleBindings)
+			}
+			if len(rendered.ClusterRoleBindings) > 0 {
+				t.Errorf("Render() clusterRoleBindings = %+v, want none", rendered.ClusterRoleBindings)
+			}
+			if rendered.Namespaces[0].Annotations["owner"] != "alice" {
+				t.Errorf("Render() namespace annotations = %v, want owner alice", rendered.Namespaces[0].Annotations)
+			}
+		})
+	}
+}
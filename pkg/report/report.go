@@ -0,0 +1,266 @@
+package report
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	rbacmanagerv1beta1 "github.com/fairwindsops/rbac-manager/pkg/apis/rbacmanager/v1beta1"
+	userv1 "github.com/openshift/api/user/v1"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Entry is a single subject having a role on a hosted cluster
+type Entry struct {
+	Namespace string     `json:"namespace"`
+	Cluster   string     `json:"cluster"`
+	Subject   string     `json:"subject"`
+	Role      string     `json:"role"`
+	Source    string     `json:"source"`
+	GrantedBy string     `json:"grantedBy,omitempty"`
+	GrantedAt *time.Time `json:"grantedAt,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Applied is true when the subject was found at the hosted cluster
+	Applied bool `json:"applied"`
+}
+
+// ClusterError records a hosted cluster whose guest state could not be read
+type ClusterError struct {
+	Namespace string `json:"namespace"`
+	Cluster   string `json:"cluster"`
+	Error     string `json:"error"`
+}
+
+// Report lists who has access to which hosted cluster
+type Report struct {
+	GeneratedAt time.Time      `json:"generatedAt"`
+	Entries     []Entry        `json:"entries"`
+	Errors      []ClusterError `json:"errors,omitempty"`
+}
+
+// GuestClientFunc returns a client for the given HostedCluster
+type GuestClientFunc func(hostedCluster *v1alpha1.HostedCluster) (client.Client, error)
+
+// SourceGuest marks subjects found at the hosted cluster that no annotation or grant accounts for
+const SourceGuest = "guest"
+
+// Generate walks every HostedCluster in namespace (all namespaces when empty) and reports the subjects that
+// should have access according to the HostedCluster annotations, matched against the group, RBACDefinition and
+// cluster-admin ClusterRoleBindings found at each hosted cluster. Clusters that cannot be reached are listed in Errors
+func Generate(ctx context.Context, c client.Client, guestClient GuestClientFunc, namespace string, now time.Time) (*Report, error) {
+	hostedClusters := v1alpha1.HostedClusterList{}
+	if err := c.List(ctx, &hostedClusters, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	report := &Report{GeneratedAt: now.UTC()}
+	for i := range hostedClusters.Items {
+		hostedCluster := &hostedClusters.Items[i]
+		entries, err := clusterEntries(ctx, hostedCluster, guestClient, now)
+		if err != nil {
+			report.Errors = append(report.Errors, ClusterError{
+				Namespace: hostedCluster.GetNamespace(),
+				Cluster:   hostedCluster.GetName(),
+				Error:     err.Error(),
+			})
+		}
+		report.Entries = append(report.Entries, entries...)
+	}
+	sort.SliceStable(report.Entries, func(i, j int) bool {
+		a, b := report.Entries[i], report.Entries[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		return a.Subject < b.Subject
+	})
+	return report, nil
+}
+
+// clusterEntries returns the entries of a single HostedCluster. The entries derived from the annotations are returned
+// even when the hosted cluster cannot be reached, with Applied left false
+func clusterEntries(ctx context.Context, hostedCluster *v1alpha1.HostedCluster, guestClient GuestClientFunc, now time.Time) ([]Entry, error) {
+	status, err := access.GetStatus(hostedCluster)
+	if err != nil {
+		return nil, err
+	}
+	grants, err := access.GetGrants(hostedCluster)
+	if err != nil {
+		return nil, err
+	}
+	annotations := hostedCluster.GetAnnotations()
+
+	var entries []Entry
+	newEntry := func(subject string, role string, source string) Entry {
+		return Entry{
+			Namespace: hostedCluster.GetNamespace(),
+			Cluster:   hostedCluster.GetName(),
+			Subject:   subject,
+			Role:      role,
+			Source:    source,
+		}
+	}
+	if requester := access.GetRequester(hostedCluster); requester != "" {
+		entries = append(entries, newEntry(requester, "", access.SourceAnnotation))
+	}
+	for _, grant := range grants {
+		if !grant.Active(now) {
+			continue
+		}
+		entry := newEntry(grant.User, "", access.SourceGrant)
+		entry.GrantedBy = grant.GrantedBy
+		grantedAt := grant.GrantedAt.Time
+		entry.GrantedAt = &grantedAt
+		if grant.ExpiresAt != nil {
+			expiresAt := grant.ExpiresAt.Time
+			entry.ExpiresAt = &expiresAt
+		}
+		entries = append(entries, entry)
+	}
+	if clusterAdmin, ok := annotations[access.ClusterAdminAnnotation]; ok {
+		entries = append(entries, newEntry(clusterAdmin, "cluster-admin", access.SourceBreakGlass))
+	}
+	if len(entries) == 0 && status == nil {
+		return nil, nil
+	}
+
+	hostedClient, err := guestClient(hostedCluster)
+	if err != nil {
+		return entries, err
+	}
+	groupRole := ""
+	groupMembers := make(map[string]bool)
+	if status != nil && status.Group != "" {
+		group := userv1.Group{}
+		if err := hostedClient.Get(ctx, types.NamespacedName{Name: status.Group}, &group); client.IgnoreNotFound(err) != nil {
+			return entries, err
+		}
+		for _, user := range group.Users {
+			groupMembers[user] = true
+		}
+		if groupRole, err = describeRBACDefinition(ctx, hostedClient, status); err != nil {
+			return entries, err
+		}
+	}
+	clusterAdmins, err := listClusterAdmins(ctx, hostedClient)
+	if err != nil {
+		return entries, err
+	}
+
+	for i := range entries {
+		if entries[i].Source == access.SourceBreakGlass {
+			entries[i].Applied = clusterAdmins[entries[i].Subject]
+			delete(clusterAdmins, entries[i].Subject)
+			continue
+		}
+		entries[i].Role = groupRole
+		entries[i].Applied = groupMembers[entries[i].Subject]
+		delete(groupMembers, entries[i].Subject)
+	}
+	for user := range groupMembers {
+		entry := newEntry(user, groupRole, SourceGuest)
+		entry.Applied = true
+		entries = append(entries, entry)
+	}
+	for user := range clusterAdmins {
+		entry := newEntry(user, "cluster-admin", SourceGuest)
+		entry.Applied = true
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// describeRBACDefinition returns a summary of the roles the RBACDefinition reported in status binds, e.g. "edit@apps"
+func describeRBACDefinition(ctx context.Context, hostedClient client.Client, status *access.Status) (string, error) {
+	if status.RBACDefinition == "" {
+		return status.Profile, nil
+	}
+	rbacDefinition := rbacmanagerv1beta1.RBACDefinition{}
+	if err := hostedClient.Get(ctx, types.NamespacedName{Name: status.RBACDefinition}, &rbacDefinition); err != nil {
+		return status.Profile, client.IgnoreNotFound(err)
+	}
+	var roles []string
+	for _, binding := range rbacDefinition.RBACBindings {
+		for _, clusterRoleBinding := range binding.ClusterRoleBindings {
+			roles = append(roles, clusterRoleBinding.ClusterRole)
+		}
+		for _, roleBinding := range binding.RoleBindings {
+			role := roleBinding.ClusterRole
+			if role == "" {
+				role = roleBinding.Role
+			}
+			roles = append(roles, role+"@"+roleBinding.Namespace)
+		}
+	}
+	description := strings.Join(roles, " ")
+	if status.Profile != "" {
+		description = fmt.Sprintf("%s (%s)", status.Profile, description)
+	}
+	return description, nil
+}
+
+// listClusterAdmins returns the users bound to the cluster-admin ClusterRole at the hosted cluster
+func listClusterAdmins(ctx context.Context, hostedClient client.Client) (map[string]bool, error) {
+	clusterRoleBindings := rbacv1.ClusterRoleBindingList{}
+	if err := hostedClient.List(ctx, &clusterRoleBindings); err != nil {
+		return nil, err
+	}
+	users := make(map[string]bool)
+	for _, clusterRoleBinding := range clusterRoleBindings.Items {
+		if clusterRoleBinding.RoleRef.Kind != "ClusterRole" || clusterRoleBinding.RoleRef.Name != "cluster-admin" {
+			continue
+		}
+		for _, subject := range clusterRoleBinding.Subjects {
+			if subject.Kind == rbacv1.UserKind {
+				users[subject.Name] = true
+			}
+		}
+	}
+	return users, nil
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteCSV writes the report entries as CSV with a header row, clusters that could not be reached are written
+// as rows with the error in the role column
+func (r *Report) WriteCSV(out io.Writer) error {
+	writer := csv.NewWriter(out)
+	if err := writer.Write([]string{"namespace", "cluster", "subject", "role", "source", "granted_by", "granted_at", "expires_at", "applied"}); err != nil {
+		return err
+	}
+	for _, entry := range r.Entries {
+		if err := writer.Write([]string{entry.Namespace, entry.Cluster, entry.Subject, entry.Role, entry.Source, entry.GrantedBy,
+			formatTime(entry.GrantedAt), formatTime(entry.ExpiresAt), fmt.Sprint(entry.Applied)}); err != nil {
+			return err
+		}
+	}
+	for _, clusterError := range r.Errors {
+		if err := writer.Write([]string{clusterError.Namespace, clusterError.Cluster, "", "error: " + clusterError.Error, "", "", "", "", ""}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,89 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"github.com/dana-team/permission-granter-controller/pkg/utils"
+	. "github.com/dana-team/permission-granter-controller/testUtils"
+	"github.com/openshift/hypershift/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGenerate(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	managed := GetHostedClusterObject("managed")
+	managed.SetNamespace("clusters")
+	managed.SetAnnotations(map[string]string{
+		access.RequesterAnnotation:    "requester",
+		access.GrantsAnnotation:       `[{"user":"alice","grantedBy":"admin","grantedAt":"2022-10-01T10:00:00Z","expiresAt":"2022-10-02T10:00:00Z"}]`,
+		access.ClusterAdminAnnotation: "breakglass",
+		access.StatusAnnotation:       `{"group":"custom-cluster-admin","profile":"default","users":["alice","requester"]}`,
+	})
+	unreachable := GetHostedClusterObject("unreachable")
+	unreachable.SetNamespace("clusters")
+	unreachable.SetAnnotations(map[string]string{access.RequesterAnnotation: "someone"})
+	untouched := GetHostedClusterObject("untouched")
+	untouched.SetNamespace("clusters")
+
+	clusterAdmin := GetClusterRoleBinding("breakglass")
+	guest := fake.NewClientBuilder().WithScheme(utils.HostedScheme).WithObjects(
+		GetGroup("custom-cluster-admin", nil, "requester", "stranger"),
+		&clusterAdmin,
+	).Build()
+	guestClient := func(hostedCluster *v1alpha1.HostedCluster) (client.Client, error) {
+		if hostedCluster.GetName() == "unreachable" {
+			return nil, context.DeadlineExceeded
+		}
+		return guest, nil
+	}
+	management := fake.NewClientBuilder().WithScheme(scheme).WithObjects(managed, unreachable, untouched).Build()
+
+	got, err := Generate(context.Background(), management, guestClient, "", now)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	want := []string{
+		"managed/alice/grant/false",
+		"managed/breakglass/break-glass/true",
+		"managed/requester/annotation/true",
+		"managed/stranger/guest/true",
+		"unreachable/someone/annotation/false",
+	}
+	var gotEntries []string
+	for _, entry := range got.Entries {
+		gotEntries = append(gotEntries, strings.Join([]string{entry.Cluster, entry.Subject, entry.Source, map[bool]string{true: "true", false: "false"}[entry.Applied]}, "/"))
+	}
+	if strings.Join(gotEntries, ",") != strings.Join(want, ",") {
+		t.Errorf("Generate() entries got %v, want %v", gotEntries, want)
+	}
+	if len(got.Errors) != 1 || got.Errors[0].Cluster != "unreachable" {
+		t.Errorf("Generate() errors got %v, want the unreachable cluster", got.Errors)
+	}
+
+	var csvOut bytes.Buffer
+	if err := got.WriteCSV(&csvOut); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(csvOut.String(), "clusters,managed,alice,default,grant,admin,2022-10-01T10:00:00Z,2022-10-02T10:00:00Z,false") {
+		t.Errorf("WriteCSV() output is missing the grant row:\n%s", csvOut.String())
+	}
+	var jsonOut bytes.Buffer
+	if err := got.WriteJSON(&jsonOut); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(jsonOut.String(), `"source": "break-glass"`) {
+		t.Errorf("WriteJSON() output is missing the break-glass entry:\n%s", jsonOut.String())
+	}
+}
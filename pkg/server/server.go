@@ -0,0 +1,275 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/state"
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Decision is whether a request may read the API
+type Decision int
+
+const (
+	// Unauthenticated requests carry no valid credentials
+	Unauthenticated Decision = iota
+	// Forbidden requests are authenticated but their user may not read the API
+	Forbidden
+	// Allowed requests may read the API
+	Allowed
+)
+
+// Authenticator decides whether a request may read the API
+type Authenticator interface {
+	Authenticate(ctx context.Context, r *http.Request) (Decision, error)
+}
+
+// KubernetesAuthenticator validates bearer tokens with a TokenReview against the management cluster and
+// authorizes the token user with a SubjectAccessReview for a get on the requested non-resource path,
+// the same way kube-rbac-proxy protects the metrics endpoint
+type KubernetesAuthenticator struct {
+	Client client.Client
+}
+
+// Authenticate returns Allowed if the request carries a valid token of a user allowed to get the request path,
+// Forbidden if the user is not allowed to and Unauthenticated if the token is missing or not valid
+func (a *KubernetesAuthenticator) Authenticate(ctx context.Context, r *http.Request) (Decision, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		return Unauthenticated, nil
+	}
+	tokenReview := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}
+	if err := a.Client.Create(ctx, tokenReview); err != nil {
+		return Unauthenticated, err
+	}
+	if !tokenReview.Status.Authenticated {
+		return Unauthenticated, nil
+	}
+	userInfo := tokenReview.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue, len(userInfo.Extra))
+	for key, value := range userInfo.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+	accessReview := &authorizationv1.SubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+		User:   userInfo.Username,
+		UID:    userInfo.UID,
+		Groups: userInfo.Groups,
+		Extra:  extra,
+		NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+			Path: r.URL.Path,
+			Verb: "get",
+		},
+	}}
+	if err := a.Client.Create(ctx, accessReview); err != nil {
+		return Unauthenticated, err
+	}
+	if !accessReview.Status.Allowed {
+		return Forbidden, nil
+	}
+	return Allowed, nil
+}
+
+// Server serves the read-only API exposing the clusters the controller manages:
+//
+//	GET /api/v1/clusters                    every known hosted cluster
+//	GET /api/v1/clusters/{name}             a single hosted cluster
+//	GET /api/v1/clusters/{name}/grants      the grants and subjects of a hosted cluster
+//
+// A cluster name is looked up in every namespace unless the namespace query parameter is set
+type Server struct {
+	Addr          string
+	CertFile      string
+	KeyFile       string
+	State         *state.Store
+	Authenticator Authenticator
+	Log           logr.Logger
+}
+
+// CheckTLS gets the address the API binds to and its TLS certificate and key files
+// The function returns an error when the API would be served without TLS on an address other hosts can reach,
+// since the bearer tokens of the requests would travel in clear text. Without TLS only loopback addresses are allowed
+func CheckTLS(addr string, certFile string, keyFile string) error {
+	if (certFile == "") != (keyFile == "") {
+		return errors.New("the TLS certificate and key of the API must be set together")
+	}
+	if certFile != "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return nil
+	}
+	return fmt.Errorf("the API binds to %s without TLS, set a TLS certificate or bind to a loopback address", addr)
+}
+
+// Start serves the API until the context is cancelled, it implements manager.Runnable
+func (s *Server) Start(ctx context.Context) error {
+	if err := CheckTLS(s.Addr, s.CertFile, s.KeyFile); err != nil {
+		return err
+	}
+	httpServer := &http.Server{
+		Addr:              s.Addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		s.Log.Info("serving API", "address", s.Addr)
+		var err error
+		if s.CertFile != "" {
+			err = httpServer.ListenAndServeTLS(s.CertFile, s.KeyFile)
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			errChan <- err
+		}
+		close(errChan)
+	}()
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return httpServer.Shutdown(shutdownCtx)
+	case err := <-errChan:
+		return err
+	}
+}
+
+// NeedLeaderElection makes the API run on the leader only, the replica whose reconciler fills the state
+func (s *Server) NeedLeaderElection() bool {
+	return true
+}
+
+// Handler returns the HTTP handler of the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/clusters", s.authenticated(s.listClusters))
+	mux.HandleFunc("/api/v1/clusters/", s.authenticated(s.getCluster))
+	return mux
+}
+
+// authenticated rejects requests that are not GET or that the Authenticator does not accept, unauthenticated requests
+// with 401 and requests of users that may not read the API with 403
+func (s *Server) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "only GET is supported")
+			return
+		}
+		if s.Authenticator != nil {
+			decision, err := s.Authenticator.Authenticate(r.Context(), r)
+			if err != nil {
+				s.Log.Error(err, "could not authenticate API request")
+				writeError(w, http.StatusInternalServerError, "could not authenticate request")
+				return
+			}
+			switch decision {
+			case Unauthenticated:
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			case Forbidden:
+				writeError(w, http.StatusForbidden, "forbidden")
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+func (s *Server) listClusters(w http.ResponseWriter, r *http.Request) {
+	clusters := s.State.List()
+	if namespace := r.URL.Query().Get("namespace"); namespace != "" {
+		var filtered []state.ClusterState
+		for _, clusterState := range clusters {
+			if clusterState.Namespace == namespace {
+				filtered = append(filtered, clusterState)
+			}
+		}
+		clusters = filtered
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": clusters})
+}
+
+// grantsView is the response of the grants endpoint
+type grantsView struct {
+	Namespace        string      `json:"namespace"`
+	Name             string      `json:"name"`
+	DesiredSubjects  []string    `json:"desiredSubjects"`
+	ObservedSubjects []string    `json:"observedSubjects"`
+	Grants           interface{} `json:"grants"`
+}
+
+func (s *Server) getCluster(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/clusters/"), "/"), "/")
+	if len(parts) > 2 || parts[0] == "" || (len(parts) == 2 && parts[1] != "grants") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	clusterState, found, ambiguous := s.lookup(parts[0], r.URL.Query().Get("namespace"))
+	if ambiguous {
+		writeError(w, http.StatusConflict, "cluster name exists in several namespaces, set the namespace query parameter")
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "cluster not found")
+		return
+	}
+	if len(parts) == 1 {
+		writeJSON(w, http.StatusOK, clusterState)
+		return
+	}
+	view := grantsView{
+		Namespace:        clusterState.Namespace,
+		Name:             clusterState.Name,
+		DesiredSubjects:  clusterState.DesiredSubjects,
+		ObservedSubjects: clusterState.ObservedSubjects,
+		Grants:           clusterState.Grants,
+	}
+	if clusterState.Grants == nil {
+		view.Grants = []interface{}{}
+	}
+	writeJSON(w, http.StatusOK, view)
+}
+
+// lookup finds a cluster by name, in the given namespace or in any namespace when it is empty
+func (s *Server) lookup(name string, namespace string) (clusterState state.ClusterState, found bool, ambiguous bool) {
+	if namespace != "" {
+		clusterState, found = s.State.Get(types.NamespacedName{Namespace: namespace, Name: name})
+		return clusterState, found, false
+	}
+	for _, candidate := range s.State.List() {
+		if candidate.Name != name {
+			continue
+		}
+		if found {
+			return state.ClusterState{}, false, true
+		}
+		clusterState, found = candidate, true
+	}
+	return clusterState, found, false
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
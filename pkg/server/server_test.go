@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/state"
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeAuthenticator struct {
+	decision Decision
+	err      error
+}
+
+func (f fakeAuthenticator) Authenticate(_ context.Context, _ *http.Request) (Decision, error) {
+	return f.decision, f.err
+}
+
+func TestServer_Handler(t *testing.T) {
+	store := state.NewStore()
+	reconciled := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	store.Set(state.ClusterState{Namespace: "clusters", Name: "a", Reachable: true, LastReconcileTime: reconciled,
+		DesiredSubjects: []string{"alice", "bob"}, ObservedSubjects: []string{"alice"}})
+	store.Set(state.ClusterState{Namespace: "clusters", Name: "shared", LastError: "timeout"})
+	store.Set(state.ClusterState{Namespace: "other", Name: "shared"})
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authenticator Authenticator
+		wantStatus    int
+		wantBody      string
+	}{
+		{
+			name:          "lists every cluster",
+			path:          "/api/v1/clusters",
+			authenticator: fakeAuthenticator{decision: Allowed},
+			wantStatus:    http.StatusOK,
+			wantBody:      `{"items":[{"namespace":"clusters","name":"a","reachable":true,"lastReconcileTime":"2022-10-01T12:00:00Z","desiredSubjects":["alice","bob"],"observedSubjects":["alice"]},{"namespace":"clusters","name":"shared","reachable":false,"lastReconcileTime":"0001-01-01T00:00:00Z","lastError":"timeout","desiredSubjects":null,"observedSubjects":null},{"namespace":"other","name":"shared","reachable":false,"lastReconcileTime":"0001-01-01T00:00:00Z","desiredSubjects":null,"observedSubjects":null}]}`,
+		},
+		{
+			name:          "lists clusters of a namespace",
+			path:          "/api/v1/clusters?namespace=other",
+			authenticator: fakeAuthenticator{decision: Allowed},
+			wantStatus:    http.StatusOK,
+			wantBody:      `{"items":[{"namespace":"other","name":"shared","reachable":false,"lastReconcileTime":"0001-01-01T00:00:00Z","desiredSubjects":null,"observedSubjects":null}]}`,
+		},
+		{
+			name:          "gets the grants of a cluster",
+			path:          "/api/v1/clusters/a/grants",
+			authenticator: fakeAuthenticator{decision: Allowed},
+			wantStatus:    http.StatusOK,
+			wantBody:      `{"namespace":"clusters","name":"a","desiredSubjects":["alice","bob"],"observedSubjects":["alice"],"grants":[]}`,
+		},
+		{
+			name:          "refuses an ambiguous name",
+			path:          "/api/v1/clusters/shared",
+			authenticator: fakeAuthenticator{decision: Allowed},
+			wantStatus:    http.StatusConflict,
+		},
+		{
+			name:          "gets an ambiguous name with a namespace",
+			path:          "/api/v1/clusters/shared?namespace=clusters",
+			authenticator: fakeAuthenticator{decision: Allowed},
+			wantStatus:    http.StatusOK,
+			wantBody:      `{"namespace":"clusters","name":"shared","reachable":false,"lastReconcileTime":"0001-01-01T00:00:00Z","lastError":"timeout","desiredSubjects":null,"observedSubjects":null}`,
+		},
+		{
+			name:          "unknown cluster",
+			path:          "/api/v1/clusters/missing",
+			authenticator: fakeAuthenticator{decision: Allowed},
+			wantStatus:    http.StatusNotFound,
+		},
+		{
+			name:          "unknown sub resource",
+			path:          "/api/v1/clusters/a/secrets",
+			authenticator: fakeAuthenticator{decision: Allowed},
+			wantStatus:    http.StatusNotFound,
+		},
+		{
+			name:          "unauthenticated",
+			path:          "/api/v1/clusters",
+			authenticator: fakeAuthenticator{decision: Unauthenticated},
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "forbidden",
+			path:          "/api/v1/clusters",
+			authenticator: fakeAuthenticator{decision: Forbidden},
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "authentication error",
+			path:          "/api/v1/clusters",
+			authenticator: fakeAuthenticator{err: errors.New("boom")},
+			wantStatus:    http.StatusInternalServerError,
+		},
+		{
+			name:          "read only",
+			method:        http.MethodPost,
+			path:          "/api/v1/clusters",
+			authenticator: fakeAuthenticator{decision: Allowed},
+			wantStatus:    http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{State: store, Authenticator: tt.authenticator, Log: logr.Discard()}
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			recorder := httptest.NewRecorder()
+			s.Handler().ServeHTTP(recorder, httptest.NewRequest(method, tt.path, nil))
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if tt.wantBody == "" {
+				var body map[string]string
+				if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || body["error"] == "" {
+					t.Errorf("expected an error body, got %s", recorder.Body.String())
+				}
+				return
+			}
+			if got := recorder.Body.String(); got != tt.wantBody+"\n" {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCheckTLS(t *testing.T) {
+	tests := []struct {
+		name     string
+		addr     string
+		certFile string
+		keyFile  string
+		wantErr  bool
+	}{
+		{name: "tls", addr: ":8443", certFile: "tls.crt", keyFile: "tls.key"},
+		{name: "loopback without tls", addr: "127.0.0.1:8443"},
+		{name: "localhost without tls", addr: "localhost:8443"},
+		{name: "every address without tls", addr: ":8443", wantErr: true},
+		{name: "pod address without tls", addr: "10.0.0.5:8443", wantErr: true},
+		{name: "certificate without key", addr: ":8443", certFile: "tls.crt", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckTLS(tt.addr, tt.certFile, tt.keyFile); (err != nil) != tt.wantErr {
+				t.Errorf("CheckTLS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// reviewingClient answers TokenReviews and SubjectAccessReviews the way the API server would
+type reviewingClient struct {
+	client.Client
+	authenticated bool
+	allowed       bool
+}
+
+func (c reviewingClient) Create(_ context.Context, obj client.Object, _ ...client.CreateOption) error {
+	switch review := obj.(type) {
+	case *authenticationv1.TokenReview:
+		review.Status.Authenticated = c.authenticated
+		review.Status.User.Username = "alice"
+	case *authorizationv1.SubjectAccessReview:
+		review.Status.Allowed = c.allowed
+	}
+	return nil
+}
+
+func TestKubernetesAuthenticator_Authenticate(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        string
+		authenticated bool
+		allowed       bool
+		want          Decision
+	}{
+		{name: "allowed", header: "Bearer token", authenticated: true, allowed: true, want: Allowed},
+		{name: "not allowed to get the path", header: "Bearer token", authenticated: true, want: Forbidden},
+		{name: "invalid token", header: "Bearer token", want: Unauthenticated},
+		{name: "no token", authenticated: true, allowed: true, want: Unauthenticated},
+		{name: "not a bearer token", header: "Basic dXNlcg==", authenticated: true, allowed: true, want: Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &KubernetesAuthenticator{Client: reviewingClient{Client: fake.NewClientBuilder().Build(), authenticated: tt.authenticated, allowed: tt.allowed}}
+			request := httptest.NewRequest(http.MethodGet, "/api/v1/clusters", nil)
+			if tt.header != "" {
+				request.Header.Set("Authorization", tt.header)
+			}
+			got, err := a.Authenticate(context.Background(), request)
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Authenticate() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
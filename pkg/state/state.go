@@ -0,0 +1,75 @@
+package state
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dana-team/permission-granter-controller/pkg/access"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ClusterState is the view the controller has of a single hosted cluster after its last reconcile
+type ClusterState struct {
+	Namespace         string         `json:"namespace"`
+	Name              string         `json:"name"`
+	Reachable         bool           `json:"reachable"`
+	LastReconcileTime time.Time      `json:"lastReconcileTime"`
+	LastError         string         `json:"lastError,omitempty"`
+	Profile           string         `json:"profile,omitempty"`
+	Group             string         `json:"group,omitempty"`
+	RBACDefinition    string         `json:"rbacDefinition,omitempty"`
+	DesiredSubjects   []string       `json:"desiredSubjects"`
+	ObservedSubjects  []string       `json:"observedSubjects"`
+	Grants            []access.Grant `json:"grants,omitempty"`
+}
+
+// Store keeps the latest state of every hosted cluster the controller reconciled, it is safe for concurrent use
+type Store struct {
+	mu       sync.RWMutex
+	clusters map[types.NamespacedName]ClusterState
+}
+
+// NewStore returns an empty Store
+func NewStore() *Store {
+	return &Store{clusters: make(map[types.NamespacedName]ClusterState)}
+}
+
+// Set records the state of a hosted cluster, replacing the previous one
+func (s *Store) Set(clusterState ClusterState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clusters[types.NamespacedName{Namespace: clusterState.Namespace, Name: clusterState.Name}] = clusterState
+}
+
+// Delete forgets a hosted cluster
+func (s *Store) Delete(name types.NamespacedName) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clusters, name)
+}
+
+// Get returns the state of a hosted cluster and whether it is known
+func (s *Store) Get(name types.NamespacedName) (ClusterState, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clusterState, ok := s.clusters[name]
+	return clusterState, ok
+}
+
+// List returns the state of every known hosted cluster sorted by namespace and name
+func (s *Store) List() []ClusterState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clusters := make([]ClusterState, 0, len(s.clusters))
+	for _, clusterState := range s.clusters {
+		clusters = append(clusters, clusterState)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Namespace != clusters[j].Namespace {
+			return clusters[i].Namespace < clusters[j].Namespace
+		}
+		return clusters[i].Name < clusters[j].Name
+	})
+	return clusters
+}
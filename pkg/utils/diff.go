@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ignoredMetadataFields are server populated fields which are not part of the desired state of an object
+var ignoredMetadataFields = []string{"resourceVersion", "uid", "creationTimestamp", "generation", "managedFields", "selfLink"}
+
+// DiffObjects gets the current and the desired state of an object
+// The function returns a sorted list of human readable changes needed to move from current to desired,
+// one line per changed field, e.g. "~ users: [a] -> [b]". A nil current object means the object will be created
+func DiffObjects(current runtime.Object, desired runtime.Object) ([]string, error) {
+	desiredMap, err := toComparableMap(desired)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil || reflect.ValueOf(current).IsNil() {
+		return []string{"+ object will be created"}, nil
+	}
+	currentMap, err := toComparableMap(current)
+	if err != nil {
+		return nil, err
+	}
+	var changes []string
+	diffValues("", currentMap, desiredMap, &changes)
+	sort.Strings(changes)
+	return changes, nil
+}
+
+// toComparableMap converts the object to a map without status, type meta and server populated metadata
+func toComparableMap(obj runtime.Object) (map[string]interface{}, error) {
+	// unstructured objects are converted to their own content, the copy keeps the fields deleted below
+	objMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj.DeepCopyObject())
+	if err != nil {
+		return nil, err
+	}
+	delete(objMap, "status")
+	delete(objMap, "apiVersion")
+	delete(objMap, "kind")
+	if metadata, ok := objMap["metadata"].(map[string]interface{}); ok {
+		for _, field := range ignoredMetadataFields {
+			delete(metadata, field)
+		}
+	}
+	return objMap, nil
+}
+
+// diffValues recursively compares maps and appends a line for every added, removed or changed field
+func diffValues(path string, current interface{}, desired interface{}, changes *[]string) {
+	currentMap, currentIsMap := current.(map[string]interface{})
+	desiredMap, desiredIsMap := desired.(map[string]interface{})
+	if currentIsMap && desiredIsMap {
+		for key, desiredValue := range desiredMap {
+			diffValues(joinPath(path, key), currentMap[key], desiredValue, changes)
+		}
+		for key, currentValue := range currentMap {
+			if _, ok := desiredMap[key]; !ok && !isEmpty(currentValue) {
+				*changes = append(*changes, fmt.Sprintf("- %s: %v", joinPath(path, key), currentValue))
+			}
+		}
+		return
+	}
+	switch {
+	case isEmpty(current) && isEmpty(desired):
+	case isEmpty(current):
+		*changes = append(*changes, fmt.Sprintf("+ %s: %v", path, desired))
+	case isEmpty(desired):
+		*changes = append(*changes, fmt.Sprintf("- %s: %v", path, current))
+	case !reflect.DeepEqual(current, desired):
+		*changes = append(*changes, fmt.Sprintf("~ %s: %v -> %v", path, current, desired))
+	}
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// isEmpty treats missing fields, empty maps and empty lists as equal
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	case string:
+		return v == ""
+	}
+	return false
+}
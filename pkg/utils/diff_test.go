@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	userv1 "github.com/openshift/api/user/v1"
+	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestDiffObjects(t *testing.T) {
+	tests := []struct {
+		name    string
+		current runtime.Object
+		desired runtime.Object
+		want    []string
+	}{
+		{
+			name:    "create",
+			current: nil,
+			desired: &userv1.Group{ObjectMeta: v1api.ObjectMeta{Name: "admins"}},
+			want:    []string{"+ object will be created"},
+		},
+		{
+			name: "no changes",
+			current: &userv1.Group{ObjectMeta: v1api.ObjectMeta{Name: "admins", ResourceVersion: "3"},
+				Users: []string{"a"}},
+			desired: &userv1.Group{ObjectMeta: v1api.ObjectMeta{Name: "admins"}, Users: []string{"a"}},
+			want:    nil,
+		},
+		{
+			name: "changes",
+			current: &userv1.Group{ObjectMeta: v1api.ObjectMeta{Name: "admins", Labels: map[string]string{"old": "x"}},
+				Users: []string{"a"}},
+			desired: &userv1.Group{ObjectMeta: v1api.ObjectMeta{Name: "admins", Labels: map[string]string{"new": "y"}},
+				Users: []string{"b"}},
+			want: []string{"+ metadata.labels.new: y", "- metadata.labels.old: x", "~ users: [a] -> [b]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DiffObjects(tt.current, tt.desired)
+			if err != nil {
+				t.Fatalf("DiffObjects() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffObjects() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,8 +2,14 @@ package utils
 
 import (
 	"context"
+	"fmt"
+	rbacmanagerv1beta1 "github.com/fairwindsops/rbac-manager/pkg/apis/rbacmanager/v1beta1"
+	userv1 "github.com/openshift/api/user/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -12,8 +18,16 @@ import (
 var (
 	KubeConfigSecretName = "admin-kubeconfig"
 	KubeConfigSecretKey  = "kubeconfig"
+	// HostedScheme holds the types the controller reads and writes at the hosted clusters
+	HostedScheme = runtime.NewScheme()
 )
 
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(HostedScheme))
+	utilruntime.Must(userv1.AddToScheme(HostedScheme))
+	utilruntime.Must(rbacmanagerv1beta1.AddToScheme(HostedScheme))
+}
+
 // GetHostedKubeConfig get infra cluster client and HostedCluster name
 // The function gets the secret contains the kubeconfig of the HostedCluster from the
 // infra cluster and returns it
@@ -42,3 +56,35 @@ func GetHostedKubeRestConfig(c client.Client, hostedclustername string) (*rest.C
 	}
 	return clientConfig.ClientConfig()
 }
+
+// GetHostedClient get infra cluster client and HostedCluster name and creates
+// a client for the HostedCluster using HostedScheme
+func GetHostedClient(c client.Client, hostedclustername string) (client.Client, error) {
+	config, err := GetHostedKubeRestConfig(c, hostedclustername)
+	if err != nil {
+		return nil, err
+	}
+	return client.New(config, client.Options{Scheme: HostedScheme})
+}
+
+// GetHostedAPIURL get infra cluster client and HostedCluster name
+// The function returns the API server URL of the current context of the HostedCluster kubeconfig
+func GetHostedAPIURL(c client.Client, hostedclustername string) (string, error) {
+	config, err := GetHostedKubeConfig(c, hostedclustername)
+	if err != nil {
+		return "", err
+	}
+	kubeconfig, err := clientcmd.Load(config)
+	if err != nil {
+		return "", err
+	}
+	kubeContext, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return "", fmt.Errorf("kubeconfig of hosted cluster %s has no current context", hostedclustername)
+	}
+	cluster, ok := kubeconfig.Clusters[kubeContext.Cluster]
+	if !ok {
+		return "", fmt.Errorf("kubeconfig of hosted cluster %s has no cluster %s", hostedclustername, kubeContext.Cluster)
+	}
+	return cluster.Server, nil
+}
@@ -0,0 +1,5 @@
+package version
+
+// Version of the controller, set at build time with
+// -ldflags "-X github.com/dana-team/permission-granter-controller/pkg/version.Version=<version>"
+var Version = "dev"
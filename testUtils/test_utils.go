@@ -1,6 +1,7 @@
 package testUtils
 
 import (
+	userv1 "github.com/openshift/api/user/v1"
 	"github.com/openshift/hypershift/api/v1alpha1"
 	v1 "k8s.io/api/rbac/v1"
 	v1api "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -41,3 +42,18 @@ func GetClusterRoleBinding(name string) v1.ClusterRoleBinding {
 	}
 	return clusterRoleBinding
 }
+
+func GetGroup(name string, labels map[string]string, users ...string) *userv1.Group {
+	group := &userv1.Group{
+		TypeMeta: v1api.TypeMeta{
+			Kind:       "Group",
+			APIVersion: "user.openshift.io/v1",
+		},
+		ObjectMeta: v1api.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Users: users,
+	}
+	return group
+}